@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"orders-service/logging"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// committer commits the offsets of messages it has read; *kafka.Reader is one
+type committer interface {
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// commitBatcher collects the messages handled so far and commits them once
+// size have piled up or interval has passed since the oldest one, whichever
+// comes first. Only handled messages are added, so a crash redelivers at
+// worst the pending ones. Commits are made by run, so adding never waits for
+// a round trip to Kafka
+type commitBatcher struct {
+	size     int
+	interval time.Duration
+	kick     chan struct{} // signals run that a batch is due
+
+	mu      sync.Mutex
+	reader  committer     // reader the pending messages were read from
+	highest map[int]int64 // highest offset added per partition for reader
+	pending []kafka.Message
+	since   time.Time     // when the oldest pending message was added
+	due     []commitBatch // batches waiting to be committed, oldest first
+
+	commitMu sync.Mutex // serializes commits so batches land in order
+}
+
+// commitBatch is a batch of messages sealed for committing through reader
+type commitBatch struct {
+	reader committer
+	msgs   []kafka.Message
+}
+
+// newCommitBatcher creates a batcher; a size below 2 commits every message
+// right away
+func newCommitBatcher(size int, interval time.Duration) *commitBatcher {
+	return &commitBatcher{
+		size:     max(size, 1),
+		interval: interval,
+		kick:     make(chan struct{}, 1),
+	}
+}
+
+// add queues msgs, read from reader, for committing and hands the batch to
+// run if it is due. Messages of a previous reader are sealed into a batch of
+// their own, since offsets can only be committed through the reader that
+// read them. Messages at or below an offset already added for their
+// partition are skipped: committing them after the higher one would move
+// the committed offset back
+func (b *commitBatcher) add(reader committer, msgs ...kafka.Message) {
+	b.mu.Lock()
+	if b.reader != reader {
+		b.sealLocked()
+		b.reader = reader
+		b.highest = make(map[int]int64)
+	}
+	if len(b.pending) == 0 {
+		b.since = time.Now()
+	}
+	for _, msg := range msgs {
+		if highest, ok := b.highest[msg.Partition]; ok && msg.Offset <= highest {
+			continue
+		}
+		b.highest[msg.Partition] = msg.Offset
+		b.pending = append(b.pending, msg)
+	}
+	if len(b.pending) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	due := len(b.pending) >= b.size || (b.interval > 0 && time.Since(b.since) >= b.interval)
+	if due {
+		b.sealLocked()
+	}
+	b.mu.Unlock()
+
+	if due {
+		select {
+		case b.kick <- struct{}{}:
+		default: // run is already signalled
+		}
+	}
+}
+
+// sealLocked moves the pending messages into a due batch. b.mu must be held
+func (b *commitBatcher) sealLocked() {
+	if len(b.pending) == 0 {
+		return
+	}
+	b.due = append(b.due, commitBatch{reader: b.reader, msgs: b.pending})
+	b.pending = nil
+}
+
+// run commits due batches until ctx is done. Every interval it also seals
+// a pending batch that has waited long enough, so a batch doesn't wait for
+// more messages on a quiet topic, and retries batches whose commit failed
+func (b *commitBatcher) run(ctx context.Context) {
+	var tick <-chan time.Time
+	if b.interval > 0 {
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-b.kick:
+		case <-tick:
+			b.mu.Lock()
+			if len(b.pending) > 0 && time.Since(b.since) >= b.interval {
+				b.sealLocked()
+			}
+			b.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+		b.commitDue(ctx)
+	}
+}
+
+// flush commits all pending messages, returning the error of a commit that
+// failed; its messages stay pending
+func (b *commitBatcher) flush(ctx context.Context) error {
+	b.mu.Lock()
+	b.sealLocked()
+	b.mu.Unlock()
+	return b.commitDue(ctx)
+}
+
+// commitDue commits the due batches in order. A failed batch stays first in
+// line, holding back the later ones, and is retried by the next call; only
+// the batches of a replaced reader, which can no longer commit them, are
+// dropped, leaving their messages to be redelivered
+func (b *commitBatcher) commitDue(ctx context.Context) error {
+	b.commitMu.Lock()
+	defer b.commitMu.Unlock()
+
+	for {
+		b.mu.Lock()
+		if len(b.due) == 0 {
+			b.mu.Unlock()
+			return nil
+		}
+		batch := b.due[0]
+		b.mu.Unlock()
+
+		last := batch.msgs[len(batch.msgs)-1]
+		err := batch.reader.CommitMessages(ctx, batch.msgs...)
+
+		b.mu.Lock()
+		stale := batch.reader != b.reader
+		if err == nil || stale {
+			b.due = b.due[1:]
+		}
+		b.mu.Unlock()
+
+		switch {
+		case err == nil:
+			slog.Info("Committed messages", append(logging.Message(last), "count", len(batch.msgs))...)
+		case stale:
+			slog.Warn("Dropping commit of a replaced reader, messages will be redelivered",
+				append(logging.Message(last), "count", len(batch.msgs), "error", err)...)
+		default:
+			slog.Error("Failed to commit messages, will retry",
+				append(logging.Message(last), "count", len(batch.msgs), "error", err)...)
+			return err
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"orders-service/config"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestCommitBatcher(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          int
+		interval      time.Duration
+		messages      int
+		wantCommitted int // committed before the flush
+	}{
+		{name: "below size", size: 3, messages: 2, wantCommitted: 0},
+		{name: "at size", size: 3, messages: 3, wantCommitted: 3},
+		{name: "past size", size: 3, messages: 5, wantCommitted: 3},
+		{name: "every message", size: 1, messages: 4, wantCommitted: 4},
+		{name: "interval not reached", size: 10, interval: time.Hour, messages: 4, wantCommitted: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newFakeReader()
+			b := newCommitBatcher(tt.size, tt.interval)
+			for i := range tt.messages {
+				b.add(reader, kafka.Message{Partition: 0, Offset: int64(i)})
+			}
+
+			if err := b.commitDue(context.Background()); err != nil {
+				t.Fatalf("commitDue: %v", err)
+			}
+			if got := len(reader.Committed()); got != tt.wantCommitted {
+				t.Errorf("committed %d messages before the flush, want %d", got, tt.wantCommitted)
+			}
+			if err := b.flush(context.Background()); err != nil {
+				t.Fatalf("flush: %v", err)
+			}
+			committed := reader.Committed()
+			if len(committed) != tt.messages {
+				t.Fatalf("committed %d messages after the flush, want %d", len(committed), tt.messages)
+			}
+			for i, msg := range committed {
+				if msg.Offset != int64(i) {
+					t.Errorf("commit %d is offset %d, want %d", i, msg.Offset, i)
+				}
+			}
+		})
+	}
+}
+
+func TestCommitBatcherInterval(t *testing.T) {
+	reader := newFakeReader()
+	b := newCommitBatcher(100, 20*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.run(ctx)
+
+	b.add(reader, kafka.Message{Offset: 0}, kafka.Message{Offset: 1})
+	waitFor(t, 5*time.Second, "the interval to commit the batch", func() bool {
+		return len(reader.Committed()) == 2
+	})
+}
+
+func TestConsumerFlushesCommitsOnClose(t *testing.T) {
+	tests := []struct {
+		name     string
+		batch    int
+		messages int
+	}{
+		{name: "partial batch", batch: 10, messages: 3},
+		{name: "full batch and a partial one", batch: 4, messages: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []readResult
+			for i := range tt.messages {
+				results = append(results, readResult{msg: kafka.Message{Key: []byte("batch"), Offset: int64(i)}})
+			}
+			reader := newFakeReader(results...)
+			f := &readerFactory{readers: []*fakeReader{reader}}
+			var handled sync.WaitGroup
+			handled.Add(tt.messages)
+			c, err := newConsumer(f.newReader, handlerFunc(func(context.Context, kafka.Message) error {
+				handled.Done()
+				return nil
+			}), nil, config.Consumer{Workers: 1, CommitBatch: tt.batch, CommitInterval: time.Hour})
+			if err != nil {
+				t.Fatalf("newConsumer: %v", err)
+			}
+
+			c.start()
+			handled.Wait()
+			full := tt.messages / tt.batch * tt.batch
+			waitFor(t, 5*time.Second, "the full batches to be committed", func() bool {
+				return len(reader.Committed()) >= full
+			})
+			if got := len(reader.Committed()); got != full {
+				t.Errorf("committed %d messages before Close, want %d", got, full)
+			}
+
+			if err := c.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if got := len(reader.Committed()); got != tt.messages {
+				t.Errorf("committed %d messages after Close, want %d", got, tt.messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"orders-service/config"
+	"orders-service/handler"
+	"orders-service/maintenance"
+	"orders-service/metrics"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	reconnectBaseDelay = 1 * time.Second
+	reconnectMaxDelay  = 30 * time.Second
+	readRetryBaseDelay = 100 * time.Millisecond
+	readRetryMaxDelay  = 5 * time.Second
+	// A message failing to be handled is retried in place with a backoff
+	// between these delays
+	handleRetryBaseDelay = 500 * time.Millisecond
+	handleRetryMaxDelay  = 30 * time.Second
+	probeInterval        = 5 * time.Second
+	// commitFlushTimeout bounds committing the pending messages on Close
+	commitFlushTimeout = 5 * time.Second
+	// drainTimeout bounds waiting on Close for the messages being handled;
+	// handling still going on after it is cancelled
+	drainTimeout = 10 * time.Second
+	// readFailuresBeforeReconnect is the number of consecutive read errors
+	// after which the reader is recreated even if none looked fatal
+	readFailuresBeforeReconnect = 5
+)
+
+// messageReader is the part of *kafka.Reader the consumer uses. Messages are
+// fetched rather than read: with a consumer group ReadMessage commits each
+// offset as soon as it is read, while offsets must only be committed once
+// the message is handled, through the offset tracker and the commit batcher
+type messageReader interface {
+	committer
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	Config() kafka.ReaderConfig
+	Close() error
+}
+
+// orderHandler handles consumed messages; *handler.Handler is one
+type orderHandler interface {
+	HandleOrder(ctx context.Context, msg kafka.Message) error
+}
+
+// Consumer reads order messages from Kafka and passes them to the handler,
+// recreating the underlying reader when it ends up in a broken state
+type Consumer struct {
+	handler     orderHandler
+	newReader   func() (messageReader, error)
+	maintenance *maintenance.Switch
+
+	// ctx stops the read loop; workCtx, which handling and committing run
+	// on, outlives it so Close can drain the messages already read
+	ctx      context.Context
+	cancel   context.CancelFunc
+	workCtx  context.Context
+	stopWork context.CancelFunc
+	errRate  *errorRate
+	commits  *commitBatcher
+
+	// Messages are handled by a pool of workers; inflight counts the ones
+	// dispatched but not yet handled
+	workers  int
+	queues   []chan job
+	offsets  *offsetTracker
+	inflight sync.WaitGroup
+	// running is held by the read loop, the only caller of dispatch, so
+	// Close can wait for it to stop before waiting on inflight
+	running sync.WaitGroup
+
+	// connected is set once a broker has been reached
+	connected atomic.Bool
+
+	mu     sync.Mutex
+	reader messageReader
+}
+
+// NewConsumer creates a consumer that builds its readers with newReader
+func NewConsumer(newReader func() (*kafka.Reader, error), h *handler.Handler, sw *maintenance.Switch, opts config.Consumer) (*Consumer, error) {
+	return newConsumer(func() (messageReader, error) { return newReader() }, h, sw, opts)
+}
+
+func newConsumer(newReader func() (messageReader, error), h orderHandler, sw *maintenance.Switch, opts config.Consumer) (*Consumer, error) {
+	reader, err := newReader()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	workCtx, stopWork := context.WithCancel(context.Background())
+	return &Consumer{
+		handler:     h,
+		newReader:   newReader,
+		maintenance: sw,
+		ctx:         ctx,
+		cancel:      cancel,
+		workCtx:     workCtx,
+		stopWork:    stopWork,
+		errRate:     newErrorRate(opts.ErrorWindow, opts.ErrorThreshold, opts.ErrorMinMessages),
+		commits:     newCommitBatcher(opts.CommitBatch, opts.CommitInterval),
+		workers:     opts.Workers,
+		offsets:     newOffsetTracker(),
+		reader:      reader,
+	}, nil
+}
+
+// Ready returns an error until a Kafka broker has been reached, and while
+// message handling fails above the configured rate
+func (c *Consumer) Ready() error {
+	if !c.connected.Load() {
+		return errors.New("kafka reader has not connected yet")
+	}
+	return c.errRate.check()
+}
+
+// probeConnection dials the reader's brokers until one answers, so readiness
+// doesn't depend on a message arriving first
+func (c *Consumer) probeConnection() {
+	for !c.connected.Load() {
+		config := c.currentReader().Config()
+		dialer := config.Dialer
+		if dialer == nil {
+			dialer = kafka.DefaultDialer
+		}
+		for _, broker := range config.Brokers {
+			conn, err := dialer.DialContext(c.ctx, "tcp", broker)
+			if err != nil {
+				continue
+			}
+			conn.Close()
+			if !c.connected.Swap(true) {
+				slog.Info("Kafka broker reachable", "broker", broker)
+			}
+			return
+		}
+
+		select {
+		case <-time.After(probeInterval):
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// currentReader returns the reader currently in use
+func (c *Consumer) currentReader() messageReader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reader
+}
+
+// Close stops the read loop, lets the messages already read be handled,
+// commits them and closes the current reader
+func (c *Consumer) Close() error {
+	c.cancel()
+	c.running.Wait()
+	if !c.waitInflight(drainTimeout) {
+		slog.Warn("Messages still being handled on shutdown, cancelling them", "timeout", drainTimeout)
+		c.stopWork()
+		c.inflight.Wait()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commitFlushTimeout)
+	if err := c.commits.flush(ctx); err != nil {
+		slog.Error("Failed to commit handled messages on shutdown, they will be redelivered", "error", err)
+	}
+	cancel()
+	c.stopWork()
+	return c.currentReader().Close()
+}
+
+// waitInflight waits up to timeout for the dispatched messages to be
+// handled and reports whether they all were
+func (c *Consumer) waitInflight(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// start launches the read loop in a goroutine
+func (c *Consumer) start() {
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		c.run()
+	}()
+}
+
+// run reads, handles and commits messages until the consumer is closed
+func (c *Consumer) run() {
+	go c.probeConnection()
+	go c.commits.run(c.workCtx)
+	c.startWorkers(c.workers)
+	defer c.stopWorkers()
+
+	ctx := c.ctx
+	reconnects, failures := 0, 0
+	for {
+		if !c.waitWritable() {
+			slog.Info("Kafka consumer stopped")
+			return
+		}
+
+		reader := c.currentReader()
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if c.stopped(err) {
+				slog.Info("Kafka consumer stopped")
+				return
+			}
+			slog.Error("Failed to read message", "error", err)
+			failures++
+			if isFatalReadError(err) || failures >= readFailuresBeforeReconnect {
+				reconnects++
+				failures = 0
+				if !c.reconnect(reader, reconnects) {
+					slog.Info("Kafka consumer stopped")
+					return
+				}
+			} else if !c.sleep(backoff(readRetryBaseDelay, readRetryMaxDelay, failures)) {
+				slog.Info("Kafka consumer stopped")
+				return
+			}
+			continue
+		}
+		reconnects, failures = 0, 0
+		c.connected.Store(true)
+
+		c.dispatch(reader, msg)
+	}
+}
+
+// waitWritable blocks while read-only mode is on, so no new messages are
+// consumed; it returns false if the consumer is closed meanwhile
+func (c *Consumer) waitWritable() bool {
+	if !c.maintenance.ReadOnly() {
+		return true
+	}
+
+	slog.Info("Read-only mode: Kafka consumer paused")
+	for c.maintenance.ReadOnly() {
+		select {
+		case <-time.After(time.Second):
+		case <-c.ctx.Done():
+			return false
+		}
+	}
+	slog.Info("Read-only mode off: Kafka consumer resumed")
+	return true
+}
+
+// stopped reports whether a read error was caused by Close rather than by
+// a problem with the reader: the context is cancelled and kafka-go returns
+// io.EOF from a closed reader
+func (c *Consumer) stopped(err error) bool {
+	if c.ctx.Err() == nil {
+		return false
+	}
+	return errors.Is(err, context.Canceled) || errors.Is(err, io.EOF)
+}
+
+// reconnect waits out an exponential backoff for the given attempt and
+// replaces the broken reader with a fresh one; it returns false without
+// reconnecting if the consumer is closed meanwhile
+func (c *Consumer) reconnect(broken messageReader, attempt int) bool {
+	delay := backoff(reconnectBaseDelay, reconnectMaxDelay, attempt)
+	slog.Warn("Kafka reader is in a bad state, recreating", "delay", delay, "attempt", attempt)
+	if !c.sleep(delay) {
+		return false
+	}
+
+	// Salvage what the broken reader may still be able to commit
+	c.inflight.Wait()
+	c.commits.flush(c.workCtx)
+	// The new reader resumes from the committed offsets, so the messages
+	// still tracked, which were fetched but never committed, will be read again
+	c.offsets.reset()
+	if err := broken.Close(); err != nil {
+		slog.Error("Failed to close broken reader", "error", err)
+	}
+
+	reader, err := c.newReader()
+	if err != nil {
+		// Keep the closed reader; its next read fails and triggers another attempt
+		slog.Error("Failed to recreate Kafka reader", "error", err)
+		return true
+	}
+
+	c.mu.Lock()
+	c.reader = reader
+	c.mu.Unlock()
+	metrics.ReaderReconnects.Inc()
+	return true
+}
+
+// backoff returns the delay before the given attempt, doubling from base and
+// capped at max
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	delay := base << (attempt - 1)
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+	return delay
+}
+
+// sleep waits for d, returning false early if the consumer is closed meanwhile
+func (c *Consumer) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// isFatalReadError reports whether a read error means the reader's connection
+// or group membership is gone and won't recover by retrying on the same reader
+func isFatalReadError(err error) bool {
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, kafka.UnknownMemberId),
+		errors.Is(err, kafka.IllegalGeneration),
+		errors.Is(err, kafka.RebalanceInProgress),
+		errors.As(err, &opErr):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,427 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"orders-service/config"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// readResult is what one FetchMessage call of a fakeReader returns
+type readResult struct {
+	msg kafka.Message
+	err error
+}
+
+// fakeReader is a messageReader whose reads return the results sent on
+// reads, blocking until one arrives
+type fakeReader struct {
+	reads chan readResult
+
+	mu        sync.Mutex
+	committed []kafka.Message
+	closed    bool
+}
+
+func newFakeReader(results ...readResult) *fakeReader {
+	r := &fakeReader{reads: make(chan readResult, 64)}
+	for _, res := range results {
+		r.reads <- res
+	}
+	return r
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		return kafka.Message{}, io.EOF
+	}
+	select {
+	case res := <-r.reads:
+		return res.msg, res.err
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+// ReadMessage behaves like kafka-go's with a consumer group, committing the
+// message as soon as it is read; the consumer must not use it
+func (r *fakeReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	msg, err := r.FetchMessage(ctx)
+	if err == nil {
+		err = r.CommitMessages(ctx, msg)
+	}
+	return msg, err
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Config() kafka.ReaderConfig { return kafka.ReaderConfig{} }
+
+func (r *fakeReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+// Closed reports whether r has been closed
+func (r *fakeReader) Closed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// Committed returns the messages committed through r so far
+func (r *fakeReader) Committed() []kafka.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]kafka.Message(nil), r.committed...)
+}
+
+// handlerFunc adapts a function to orderHandler
+type handlerFunc func(ctx context.Context, msg kafka.Message) error
+
+func (f handlerFunc) HandleOrder(ctx context.Context, msg kafka.Message) error { return f(ctx, msg) }
+
+// readerFactory hands out the given readers in turn, counting the calls
+type readerFactory struct {
+	mu      sync.Mutex
+	readers []*fakeReader
+	calls   int
+}
+
+func (f *readerFactory) newReader() (messageReader, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if len(f.readers) == 0 {
+		return nil, errors.New("no reader left")
+	}
+	r := f.readers[0]
+	f.readers = f.readers[1:]
+	return r, nil
+}
+
+func (f *readerFactory) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// newTestConsumer creates a consumer over the factory's readers, closing it
+// when the test ends
+func newTestConsumer(t *testing.T, f *readerFactory, h orderHandler, opts config.Consumer) *Consumer {
+	t.Helper()
+	c, err := newConsumer(f.newReader, h, nil, opts)
+	if err != nil {
+		t.Fatalf("newConsumer: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// waitFor polls cond until it holds, failing the test after timeout
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// logRecorder is a slog.Handler keeping the records logged
+type logRecorder struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+// captureLogs routes the default logger to a recorder until the test ends
+func captureLogs(t *testing.T) *logRecorder {
+	t.Helper()
+	rec := &logRecorder{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(rec))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return rec
+}
+
+func (l *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+func (l *logRecorder) WithAttrs([]slog.Attr) slog.Handler       { return l }
+func (l *logRecorder) WithGroup(string) slog.Handler            { return l }
+
+func (l *logRecorder) Handle(_ context.Context, r slog.Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, r)
+	return nil
+}
+
+// Messages returns the messages logged at level or above
+func (l *logRecorder) Messages(level slog.Level) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var msgs []string
+	for _, r := range l.records {
+		if r.Level >= level {
+			msgs = append(msgs, r.Message)
+		}
+	}
+	return msgs
+}
+
+func TestIsFatalReadError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection reset", err: syscall.ECONNRESET, want: true},
+		{name: "connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: true},
+		{name: "broken pipe", err: syscall.EPIPE, want: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, want: true},
+		{name: "unknown member", err: kafka.UnknownMemberId, want: true},
+		{name: "illegal generation", err: kafka.IllegalGeneration, want: true},
+		{name: "rebalance", err: kafka.RebalanceInProgress, want: true},
+		{name: "net op error", err: &net.OpError{Op: "read", Err: errors.New("boom")}, want: true},
+		{name: "timeout", err: context.DeadlineExceeded, want: false},
+		{name: "leader not available", err: kafka.LeaderNotAvailable, want: false},
+		{name: "other", err: errors.New("something else"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFatalReadError(tt.err); got != tt.want {
+				t.Errorf("isFatalReadError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsumerRecreatesReaderOnFatalError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "connection reset", err: syscall.ECONNRESET},
+		{name: "group membership lost", err: kafka.UnknownMemberId},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broken := newFakeReader(readResult{err: tt.err})
+			fresh := newFakeReader()
+			f := &readerFactory{readers: []*fakeReader{broken, fresh}}
+			c := newTestConsumer(t, f, handlerFunc(func(context.Context, kafka.Message) error { return nil }), config.Consumer{Workers: 1})
+
+			c.start()
+			waitFor(t, 5*time.Second, "the reader to be recreated", func() bool {
+				return c.currentReader() == messageReader(fresh)
+			})
+			if !broken.Closed() {
+				t.Error("broken reader was not closed")
+			}
+			if calls := f.Calls(); calls != 2 {
+				t.Errorf("reader factory called %d times, want 2", calls)
+			}
+		})
+	}
+}
+
+func TestConsumerCloseStopsCleanly(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages int
+	}{
+		{name: "idle reader", messages: 0},
+		{name: "messages in flight", messages: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			var results []readResult
+			for i := range tt.messages {
+				results = append(results, readResult{msg: kafka.Message{Key: []byte("close"), Offset: int64(i)}})
+			}
+			reader := newFakeReader(results...)
+			f := &readerFactory{readers: []*fakeReader{reader}}
+			var handled sync.WaitGroup
+			handled.Add(tt.messages)
+			c, err := newConsumer(f.newReader, handlerFunc(func(context.Context, kafka.Message) error {
+				handled.Done()
+				return nil
+			}), nil, config.Consumer{Workers: 2})
+			if err != nil {
+				t.Fatalf("newConsumer: %v", err)
+			}
+
+			c.start()
+			handled.Wait()
+			done := make(chan error, 1)
+			go func() { done <- c.Close() }()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("Close: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Close did not return")
+			}
+
+			if !reader.Closed() {
+				t.Error("reader was not closed")
+			}
+			if got := len(reader.Committed()); got != tt.messages {
+				t.Errorf("committed %d messages, want %d", got, tt.messages)
+			}
+			if msgs := logs.Messages(slog.LevelWarn); len(msgs) > 0 {
+				t.Errorf("shutdown logged warnings or errors: %q", msgs)
+			}
+			if calls := f.Calls(); calls != 1 {
+				t.Errorf("reader recreated %d times on shutdown", calls-1)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 100 * time.Millisecond},
+		{attempt: 2, want: 200 * time.Millisecond},
+		{attempt: 4, want: 800 * time.Millisecond},
+		{attempt: 6, want: 3200 * time.Millisecond},
+		{attempt: 7, want: 5 * time.Second},
+		{attempt: 100, want: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoff(readRetryBaseDelay, readRetryMaxDelay, tt.attempt); got != tt.want {
+			t.Errorf("backoff(attempt %d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestConsumerBacksOffOnReadErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		errors        int
+		wantRecreated bool
+	}{
+		{name: "recovers on the same reader", errors: 3},
+		{name: "recreated after repeated errors", errors: readFailuresBeforeReconnect, wantRecreated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []readResult
+			for range tt.errors {
+				results = append(results, readResult{err: kafka.LeaderNotAvailable})
+			}
+			msg := kafka.Message{Key: []byte("resume"), Offset: 7}
+			flaky := newFakeReader(results...)
+			fresh := newFakeReader()
+			if tt.wantRecreated {
+				fresh.reads <- readResult{msg: msg}
+			} else {
+				flaky.reads <- readResult{msg: msg}
+			}
+			f := &readerFactory{readers: []*fakeReader{flaky, fresh}}
+			handled := make(chan kafka.Message, 1)
+			c := newTestConsumer(t, f, handlerFunc(func(_ context.Context, msg kafka.Message) error {
+				handled <- msg
+				return nil
+			}), config.Consumer{Workers: 1})
+
+			// Every error but the one triggering the reconnect is followed by a backoff
+			var wantDelay time.Duration
+			for attempt := 1; attempt <= tt.errors && attempt < readFailuresBeforeReconnect; attempt++ {
+				wantDelay += backoff(readRetryBaseDelay, readRetryMaxDelay, attempt)
+			}
+			if tt.wantRecreated {
+				wantDelay += reconnectBaseDelay
+			}
+
+			start := time.Now()
+			c.start()
+			select {
+			case got := <-handled:
+				if got.Offset != msg.Offset {
+					t.Errorf("handled offset %d, want %d", got.Offset, msg.Offset)
+				}
+			case <-time.After(wantDelay + 5*time.Second):
+				t.Fatal("message after the errors was not handled")
+			}
+			if elapsed := time.Since(start); elapsed < wantDelay {
+				t.Errorf("resumed after %v, want a backoff of at least %v", elapsed, wantDelay)
+			}
+			if recreated := f.Calls() == 2; recreated != tt.wantRecreated {
+				t.Errorf("reader recreated = %v, want %v", recreated, tt.wantRecreated)
+			}
+		})
+	}
+}
+
+func TestConsumerCommitsOnlyHandledMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int // attempts failing before the handler succeeds
+	}{
+		{name: "handled on the first attempt"},
+		{name: "retried in place", failures: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newFakeReader(readResult{msg: kafka.Message{Key: []byte("commit"), Offset: 3}})
+			f := &readerFactory{readers: []*fakeReader{reader}}
+			var attempts atomic.Int32
+			release := make(chan struct{})
+			c := newTestConsumer(t, f, handlerFunc(func(ctx context.Context, _ kafka.Message) error {
+				if attempts.Add(1) <= int32(tt.failures) {
+					return errors.New("database unavailable")
+				}
+				select {
+				case <-release:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}), config.Consumer{Workers: 1})
+
+			c.start()
+			waitFor(t, 10*time.Second, "the last attempt to start", func() bool {
+				return attempts.Load() == int32(tt.failures)+1
+			})
+			// The fetch itself must not commit, nor the failed attempts
+			if got := reader.Committed(); len(got) != 0 {
+				t.Fatalf("committed %d messages before the handler succeeded", len(got))
+			}
+
+			close(release)
+			waitFor(t, 5*time.Second, "the handled message to be committed", func() bool {
+				return len(reader.Committed()) == 1
+			})
+			if got := reader.Committed()[0].Offset; got != 3 {
+				t.Errorf("committed offset %d, want 3", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// errorRate tracks the share of failed messages over a sliding window using
+// one bucket per second
+type errorRate struct {
+	mu        sync.Mutex
+	threshold float64 // failure ratio that trips the tracker, 0 disables it
+	minEvents int     // fewer events than this in the window never trip it
+	buckets   []rateBucket
+	tripped   bool
+}
+
+type rateBucket struct {
+	second int64
+	total  int
+	failed int
+}
+
+func newErrorRate(window time.Duration, threshold float64, minEvents int) *errorRate {
+	seconds := int(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &errorRate{
+		threshold: threshold,
+		minEvents: minEvents,
+		buckets:   make([]rateBucket, seconds),
+	}
+}
+
+// record adds the outcome of one message
+func (e *errorRate) record(failed bool) {
+	if e.threshold <= 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b := &e.buckets[now%int64(len(e.buckets))]
+	if b.second != now {
+		*b = rateBucket{second: now}
+	}
+	b.total++
+	if failed {
+		b.failed++
+	}
+	e.update(now)
+}
+
+// check returns an error while the failure ratio is above the threshold
+func (e *errorRate) check() error {
+	if e.threshold <= 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ratio, total := e.update(time.Now().Unix())
+	if e.tripped {
+		return fmt.Errorf("%.0f%% of %d messages failed in the last %ds", ratio*100, total, len(e.buckets))
+	}
+	return nil
+}
+
+// update recomputes the ratio over buckets still inside the window and logs
+// state transitions (caller must hold lock)
+func (e *errorRate) update(now int64) (float64, int) {
+	total, failed := 0, 0
+	for _, b := range e.buckets {
+		if now-b.second < int64(len(e.buckets)) {
+			total += b.total
+			failed += b.failed
+		}
+	}
+
+	ratio := 0.0
+	if total > 0 {
+		ratio = float64(failed) / float64(total)
+	}
+
+	tripped := total >= e.minEvents && ratio > e.threshold
+	if tripped != e.tripped {
+		if tripped {
+			slog.Error("Consumer error rate above threshold, reporting not ready",
+				"failed", failed, "total", total, "window_seconds", len(e.buckets), "threshold", e.threshold)
+		} else {
+			slog.Info("Consumer error rate back below threshold, reporting ready", "ratio", ratio)
+		}
+		e.tripped = tripped
+	}
+	return ratio, total
+}
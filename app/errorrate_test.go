@@ -0,0 +1,74 @@
+package app
+
+import (
+	"orders-service/config"
+	"testing"
+	"time"
+)
+
+func TestErrorRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float64
+		minEvents int
+		failed    int
+		succeeded int
+		wantReady bool
+	}{
+		{name: "above threshold", threshold: 0.5, minEvents: 10, failed: 6, succeeded: 4, wantReady: false},
+		{name: "at threshold", threshold: 0.5, minEvents: 10, failed: 5, succeeded: 5, wantReady: true},
+		{name: "below threshold", threshold: 0.5, minEvents: 10, failed: 2, succeeded: 8, wantReady: true},
+		{name: "too few messages", threshold: 0.5, minEvents: 10, failed: 5, succeeded: 0, wantReady: true},
+		{name: "all failing", threshold: 0.1, minEvents: 1, failed: 3, succeeded: 0, wantReady: false},
+		{name: "disabled", threshold: 0, minEvents: 1, failed: 10, succeeded: 0, wantReady: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newErrorRate(time.Minute, tt.threshold, tt.minEvents)
+			for range tt.failed {
+				e.record(true)
+			}
+			for range tt.succeeded {
+				e.record(false)
+			}
+			if err := e.check(); (err == nil) != tt.wantReady {
+				t.Errorf("check() = %v, want ready %v", err, tt.wantReady)
+			}
+		})
+	}
+}
+
+func TestConsumerReadinessFollowsErrorRate(t *testing.T) {
+	f := &readerFactory{readers: []*fakeReader{newFakeReader()}}
+	c := newTestConsumer(t, f, handlerFunc(nil), configWithErrorRate(0.5, 4))
+	c.connected.Store(true)
+
+	steps := []struct {
+		name      string
+		failed    int
+		succeeded int
+		wantReady bool
+	}{
+		{name: "healthy", succeeded: 4, wantReady: true},
+		{name: "errors pile up", failed: 6, wantReady: false},
+		{name: "still failing", failed: 2, succeeded: 2, wantReady: false},
+		{name: "recovered", succeeded: 20, wantReady: true},
+	}
+	for _, step := range steps {
+		for range step.failed {
+			c.errRate.record(true)
+		}
+		for range step.succeeded {
+			c.errRate.record(false)
+		}
+		if err := c.Ready(); (err == nil) != step.wantReady {
+			t.Errorf("%s: Ready() = %v, want ready %v", step.name, err, step.wantReady)
+		}
+	}
+}
+
+// configWithErrorRate returns consumer settings failing readiness above
+// threshold over a one-minute window
+func configWithErrorRate(threshold float64, minMessages int) config.Consumer {
+	return config.Consumer{ErrorWindow: time.Minute, ErrorThreshold: threshold, ErrorMinMessages: minMessages, Workers: 1}
+}
@@ -1,57 +1,202 @@
 package app
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"orders-service/cache"
+	"orders-service/config"
 	"orders-service/database"
+	"orders-service/dlq"
+	"orders-service/events"
+	"orders-service/handler"
+	"orders-service/logging"
+	"orders-service/maintenance"
+	"orders-service/model"
+	"orders-service/server"
+	"orders-service/tracing"
+	"orders-service/webhook"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// InitializeLogging switches logging to structured JSON at the configured level
+func InitializeLogging(cfg *config.Config) {
+	logging.Setup(cfg.LogLevel)
+}
+
+// InitializeTracing sets up OpenTelemetry tracing from the standard OTEL_*
+// variables; without an OTLP endpoint spans are discarded
+func InitializeTracing() {
+	if err := tracing.Setup(context.Background()); err != nil {
+		slog.Error("Failed to set up tracing, spans will be discarded", "error", err)
+		return
+	}
+	if tracing.Enabled() {
+		slog.Info("Tracing enabled")
+	}
+}
+
 // InitializeDatabase connects to PostgreSQL and returns a new Database instance
-func InitializeDatabase() (*database.Database, error) {
-	db, err := database.New()
+func InitializeDatabase(cfg config.Database) (*database.Database, error) {
+	db, err := database.New(cfg.URL, cfg.Pool)
 	if err != nil {
 		return nil, err
 	}
+	if cfg.ReplicaURL != "" {
+		if err = db.ConnectReplica(cfg.ReplicaURL, cfg.Pool); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	db.SlowTransaction = cfg.SlowTransaction
+	db.ItemBatchSize = cfg.ItemBatchSize
+	db.LoadWorkers = cfg.LoadWorkers
 	return db, nil
 }
 
-// InitializeCache loads cached orders from file or falls back to DB
-func InitializeCache(db *database.Database) (*cache.Cache, error) {
-	c := cache.New("order_cache.gob")
+// InitializeCache warms the cache from the file and/or DB per the configured strategy
+func InitializeCache(cfg config.Cache, db *database.Database) (*cache.Cache, error) {
+	opts := cfg.Options
+	opts.Refresh.Load = db.GetOrder
+	c := cache.New(cfg.File, opts)
+
+	slog.Info("Warming cache", "strategy", cfg.WarmStrategy)
+
+	switch cfg.WarmStrategy {
+	case config.WarmFileOnly:
+		loadCacheFile(c)
+	case config.WarmDBOnly:
+		loadCacheDB(c, db, true)
+	case config.WarmFileThenDB:
+		loadCacheFile(c)
+		loadCacheDB(c, db, false)
+	case config.WarmDBThenFile:
+		// The file replaces the whole map, so load it first and let DB orders overwrite
+		loadCacheFile(c)
+		loadCacheDB(c, db, true)
+	}
+
+	return c, nil
+}
 
+// loadCacheFile restores the cache from its persisted file
+func loadCacheFile(c *cache.Cache) {
 	if err := c.LoadFromFile(); err != nil {
-		log.Printf("No cache file found, loading from DB: %v", err)
+		slog.Warn("No cache file loaded", "error", err)
 	}
+}
 
-	ordersFromDB, err := db.GetAllOrders()
+// loadCacheDB streams all DB orders into the cache; with overwrite unset,
+// orders already in the cache are kept as they are, otherwise they are
+// replaced but keep the TTL they were cached with
+func loadCacheDB(c *cache.Cache, db *database.Database, overwrite bool) {
+	loaded := 0
+	err := db.StreamAllOrders(context.Background(), func(order model.Order) error {
+		if _, found := c.Peek(order.OrderUID); found && !overwrite {
+			return nil
+		}
+		c.SetKeepTTL(order, cache.NoExpiration)
+		loaded++
+		return nil
+	})
 	if err != nil {
-		log.Printf("Failed to load orders from DB: %v", err)
-	} else {
-		loaded := 0
-		for _, order := range ordersFromDB {
-			if _, found := c.Get(order.OrderUID); !found {
-				c.Set(order, cache.NoExpiration)
-				loaded++
-			}
+		slog.Error("Failed to load orders from DB", "error", err)
+	}
+	slog.Info("Loaded orders from DB into cache", "count", loaded)
+}
+
+// ReaderFactory returns a function creating Kafka readers for the configured
+// topic and consumer group, used to recreate a broken reader
+func ReaderFactory(cfg config.Kafka) func() (*kafka.Reader, error) {
+	return func() (*kafka.Reader, error) {
+		dialer, err := kafkaDialer(cfg)
+		if err != nil {
+			return nil, err
 		}
-		log.Printf("Loaded %d orders from DB into cache", loaded)
+
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        cfg.Brokers,
+			Dialer:         dialer,
+			Topic:          cfg.Topic,
+			GroupID:        cfg.GroupID,
+			CommitInterval: 0,
+			MaxWait:        1 * time.Second,
+		})
+
+		return reader, nil
 	}
+}
 
-	return c, nil
+// InitializeDLQ creates a producer for the dead-letter topic
+func InitializeDLQ(cfg config.Kafka) (*dlq.Producer, error) {
+	transport, err := kafkaTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return dlq.New(cfg.Brokers, cfg.DLQTopic, transport), nil
 }
 
-// InitializeReader creates a Kafka reader for the "orders" topic
-func InitializeReader() *kafka.Reader {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        []string{"kafka:9092"},
-		Topic:          "orders",
-		GroupID:        "order-service-group",
-		CommitInterval: 0,
-		MaxWait:        1 * time.Second,
-	})
+// InitializeReview creates a producer for the conflicting-duplicate review topic,
+// or returns nil when no review topic is configured
+func InitializeReview(cfg config.Kafka) (*dlq.Producer, error) {
+	if cfg.ReviewTopic == "" {
+		return nil, nil
+	}
+	transport, err := kafkaTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return dlq.New(cfg.Brokers, cfg.ReviewTopic, transport), nil
+}
+
+// InitializeEvents creates the order events publisher, or returns nil when no
+// events topic is configured
+func InitializeEvents(cfg config.Kafka) (*events.Publisher, error) {
+	if cfg.EventsTopic == "" {
+		return nil, nil
+	}
+	transport, err := kafkaTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return events.New(cfg.Brokers, cfg.EventsTopic, transport), nil
+}
+
+// InitializeWebhook creates the order webhook notifier, or returns nil when
+// no webhook URL is configured
+func InitializeWebhook(cfg config.Webhook) *webhook.Notifier {
+	if cfg.URL == "" {
+		return nil
+	}
+	return webhook.New(cfg.URL, cfg.Secret, cfg.QueueSize)
+}
 
-	return reader
-}
\ No newline at end of file
+// InitializeHandler creates the Kafka message handler with its options and sinks
+func InitializeHandler(cfg *config.Config, db *database.Database, c *cache.Cache) (*handler.Handler, error) {
+	h := handler.New(db, c, cfg.Handler)
+	var err error
+	if h.DLQ, err = InitializeDLQ(cfg.Kafka); err != nil {
+		return nil, err
+	}
+	if h.Review, err = InitializeReview(cfg.Kafka); err != nil {
+		return nil, err
+	}
+	if h.Events, err = InitializeEvents(cfg.Kafka); err != nil {
+		return nil, err
+	}
+	h.Webhook = InitializeWebhook(cfg.Webhook)
+	return h, nil
+}
+
+// InitializeMaintenance creates the read-only mode switch in its configured initial state
+func InitializeMaintenance(cfg *config.Config) *maintenance.Switch {
+	return maintenance.New(cfg.ReadOnly)
+}
+
+// InitializeServer creates the HTTP server with its configured options
+func InitializeServer(cfg *config.Config, c *cache.Cache, db *database.Database, consumer *Consumer, sw *maintenance.Switch) *server.Server {
+	s := server.New(c, db, sw, cfg.Server)
+	s.Consumer = consumer
+	return s
+}
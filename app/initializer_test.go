@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"orders-service/cache"
+	"orders-service/config"
+	"orders-service/database"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testDatabase connects to TEST_DATABASE_URL, a database with the service's
+// schema and migrations applied, skipping the test when it is unset
+func testDatabase(t *testing.T) *database.Database {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := database.New(url, database.PoolOptions{})
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+// storeTestOrder stores order in db, deleting it when the test ends
+func storeTestOrder(t *testing.T, db *database.Database, order model.Order) {
+	t.Helper()
+	ctx := context.Background()
+	_ = db.DeleteOrder(ctx, order.OrderUID)
+	if err := db.MakeOrder(ctx, order); err != nil {
+		t.Fatalf("storing order %s: %v", order.OrderUID, err)
+	}
+	t.Cleanup(func() { _ = db.DeleteOrder(context.Background(), order.OrderUID) })
+}
+
+func TestInitializeCacheWarmStrategy(t *testing.T) {
+	db := testDatabase(t)
+
+	// The file and the DB disagree on the shared order, and each has an
+	// order the other lacks
+	fromFile := ordertest.Order("warm-shared")
+	fromFile.Delivery.City = "From File"
+	fromDB := ordertest.Order("warm-shared")
+	fromDB.Delivery.City = "From DB"
+	fileOnly := ordertest.Order("warm-file-only")
+	dbOnly := ordertest.Order("warm-db-only")
+	storeTestOrder(t, db, fromDB)
+	storeTestOrder(t, db, dbOnly)
+
+	tests := []struct {
+		strategy   config.WarmStrategy
+		wantCity   string // city of the shared order
+		wantFile   bool   // whether the order only in the file is cached
+		wantDBOnly bool   // whether the order only in the DB is cached
+	}{
+		{strategy: config.WarmFileOnly, wantCity: "From File", wantFile: true},
+		{strategy: config.WarmDBOnly, wantCity: "From DB", wantDBOnly: true},
+		{strategy: config.WarmFileThenDB, wantCity: "From File", wantFile: true, wantDBOnly: true},
+		{strategy: config.WarmDBThenFile, wantCity: "From DB", wantFile: true, wantDBOnly: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "cache.gob")
+			saved := cache.New(file, cache.Options{})
+			saved.Set(fromFile, cache.DefaultTTL)
+			saved.Set(fileOnly, cache.DefaultTTL)
+			if _, err := saved.SaveToFile(); err != nil {
+				t.Fatalf("saving cache file: %v", err)
+			}
+			saved.Stop()
+
+			c, err := InitializeCache(config.Cache{File: file, WarmStrategy: tt.strategy}, db)
+			if err != nil {
+				t.Fatalf("InitializeCache: %v", err)
+			}
+			t.Cleanup(c.Stop)
+
+			shared, found := c.Peek(fromDB.OrderUID)
+			if !found {
+				t.Fatal("shared order not cached")
+			}
+			if shared.Delivery.City != tt.wantCity {
+				t.Errorf("shared order city = %q, want %q", shared.Delivery.City, tt.wantCity)
+			}
+			if _, found := c.Peek(fileOnly.OrderUID); found != tt.wantFile {
+				t.Errorf("file-only order cached = %v, want %v", found, tt.wantFile)
+			}
+			if _, found := c.Peek(dbOnly.OrderUID); found != tt.wantDBOnly {
+				t.Errorf("DB-only order cached = %v, want %v", found, tt.wantDBOnly)
+			}
+		})
+	}
+}
+
+// cachedExpirations saves c as JSON and returns the expiration of each entry
+func cachedExpirations(t *testing.T, c *cache.Cache) map[string]int64 {
+	t.Helper()
+	if _, err := c.SaveToFile(); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+	data, err := os.ReadFile(c.File())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items map[string]cache.Item
+	if err := json.Unmarshal(data, &items); err != nil {
+		t.Fatalf("decoding cache file: %v", err)
+	}
+	expirations := make(map[string]int64, len(items))
+	for _, item := range items {
+		expirations[item.Order.OrderUID] = item.Expiration
+	}
+	return expirations
+}
+
+func TestInitializeCacheDropsExpiredEntries(t *testing.T) {
+	expired := ordertest.Order("startup-expired")
+	valid := ordertest.Order("startup-valid")
+
+	tests := []struct {
+		strategy config.WarmStrategy
+		database bool
+	}{
+		{strategy: config.WarmFileOnly},
+		{strategy: config.WarmFileThenDB, database: true},
+		{strategy: config.WarmDBThenFile, database: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			var db *database.Database
+			if tt.database {
+				db = testDatabase(t)
+				storeTestOrder(t, db, valid)
+				_ = db.DeleteOrder(context.Background(), expired.OrderUID)
+			}
+
+			// Written by hand, as a cache never saves entries past their expiration
+			validExpiration := time.Now().Add(time.Hour).UnixNano()
+			file := filepath.Join(t.TempDir(), "cache.json")
+			data, err := json.Marshal(map[string]cache.Item{
+				expired.OrderUID: {Order: expired, Expiration: time.Now().Add(-time.Minute).UnixNano()},
+				valid.OrderUID:   {Order: valid, Expiration: validExpiration},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := InitializeCache(config.Cache{
+				File:         file,
+				WarmStrategy: tt.strategy,
+				Options:      cache.Options{Format: cache.FormatJSON, NoCompression: true},
+			}, db)
+			if err != nil {
+				t.Fatalf("InitializeCache: %v", err)
+			}
+			t.Cleanup(c.Stop)
+
+			expirations := cachedExpirations(t, c)
+			if _, found := expirations[expired.OrderUID]; found {
+				t.Error("expired entry survived startup")
+			}
+			if got, found := expirations[valid.OrderUID]; !found || got != validExpiration {
+				t.Errorf("valid entry expiration = %d (cached %v), want it kept at %d", got, found, validExpiration)
+			}
+		})
+	}
+}
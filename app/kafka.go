@@ -0,0 +1,71 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"orders-service/config"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// kafkaSASL builds the configured SASL mechanism (plain, scram-sha-256 or
+// scram-sha-512), or returns nil when none is set
+func kafkaSASL(cfg config.Kafka) (sasl.Mechanism, error) {
+	user, pass := cfg.SASLUsername, cfg.SASLPassword
+	switch m := cfg.SASLMechanism; m {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: user, Password: pass}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, user, pass)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, user, pass)
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism %q", m)
+	}
+}
+
+// kafkaTLS returns the TLS config for broker connections when TLS is
+// enabled, or nil for plaintext
+func kafkaTLS(cfg config.Kafka) *tls.Config {
+	if !cfg.TLS {
+		return nil
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
+
+// kafkaDialer returns the dialer used by readers, honoring the TLS and SASL settings
+func kafkaDialer(cfg config.Kafka) (*kafka.Dialer, error) {
+	mechanism, err := kafkaSASL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           kafkaTLS(cfg),
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// kafkaTransport returns the transport used by writers, honoring the TLS and
+// SASL settings, or nil for the default plaintext one
+func kafkaTransport(cfg config.Kafka) (kafka.RoundTripper, error) {
+	mechanism, err := kafkaSASL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := kafkaTLS(cfg)
+	if mechanism == nil && tlsConfig == nil {
+		return nil, nil
+	}
+	return &kafka.Transport{
+		TLS:  tlsConfig,
+		SASL: mechanism,
+	}, nil
+}
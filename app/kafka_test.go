@@ -0,0 +1,66 @@
+package app
+
+import (
+	"orders-service/config"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKafkaDialer(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantTLS       bool
+		wantSASL      string // mechanism name; empty for none
+		wantTransport bool
+	}{
+		{name: "plaintext"},
+		{name: "TLS", env: map[string]string{"KAFKA_TLS_ENABLE": "true"}, wantTLS: true, wantTransport: true},
+		{name: "SASL plain", env: map[string]string{
+			"KAFKA_SASL_MECHANISM": "plain", "KAFKA_SASL_USERNAME": "orders", "KAFKA_SASL_PASSWORD": "secret",
+		}, wantSASL: "PLAIN", wantTransport: true},
+		{name: "TLS and SCRAM", env: map[string]string{
+			"KAFKA_TLS_ENABLE":     "true",
+			"KAFKA_SASL_MECHANISM": "scram-sha-512", "KAFKA_SASL_USERNAME": "orders", "KAFKA_SASL_PASSWORD": "secret",
+		}, wantTLS: true, wantSASL: "SCRAM-SHA-512", wantTransport: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", "postgres://localhost/orders")
+			for _, key := range []string{"KAFKA_TLS_ENABLE", "KAFKA_SASL_MECHANISM", "KAFKA_SASL_USERNAME", "KAFKA_SASL_PASSWORD"} {
+				t.Setenv(key, tt.env[key])
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			dialer, err := kafkaDialer(cfg.Kafka)
+			if err != nil {
+				t.Fatalf("kafkaDialer: %v", err)
+			}
+			if got := dialer.TLS != nil; got != tt.wantTLS {
+				t.Errorf("dialer TLS = %v, want %v", got, tt.wantTLS)
+			}
+			gotSASL := ""
+			if dialer.SASLMechanism != nil {
+				gotSASL = dialer.SASLMechanism.Name()
+			}
+			if gotSASL != tt.wantSASL {
+				t.Errorf("dialer SASL mechanism = %q, want %q", gotSASL, tt.wantSASL)
+			}
+
+			transport, err := kafkaTransport(cfg.Kafka)
+			if err != nil {
+				t.Fatalf("kafkaTransport: %v", err)
+			}
+			if got := transport != nil; got != tt.wantTransport {
+				t.Fatalf("transport configured = %v, want %v", got, tt.wantTransport)
+			}
+			if transport != nil && (transport.(*kafka.Transport).TLS != nil) != tt.wantTLS {
+				t.Errorf("transport TLS = %v, want %v", !tt.wantTLS, tt.wantTLS)
+			}
+		})
+	}
+}
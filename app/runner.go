@@ -2,63 +2,59 @@ package app
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"orders-service/cache"
 	"orders-service/database"
 	"orders-service/handler"
 	"orders-service/server"
+	"orders-service/tracing"
 	"os"
 	"os/signal"
 	"syscall"
-
-	"github.com/segmentio/kafka-go"
+	"time"
 )
 
-// RunHTTPServer starts the HTTP server in a goroutine
-func RunHTTPServer(c *cache.Cache, db *database.Database) {
+// RunHTTPServer starts the HTTP server on addr in a goroutine
+func RunHTTPServer(httpServer *server.Server, addr string) {
 	go func() {
-		httpServer := server.New(c, db)
-		httpServer.Start(":8080")
+		httpServer.Start(addr)
 	}()
 }
 
 // RunKafkaReader starts consuming Kafka messages in a goroutine
-func RunKafkaReader(reader *kafka.Reader, c *cache.Cache, db *database.Database) {
-	ctx := context.Background()
-	go func() {
-		for {
-			msg, err := reader.ReadMessage(ctx)
-			if err != nil {
-				log.Printf("Error reading message: %v", err)
-				continue
-			}
-
-			if err := handler.HandleOrder(msg, db, c); err != nil {
-				log.Printf("Failed to process message: %v", err)
-				continue
-			}
-
-			if err := reader.CommitMessages(ctx, msg); err != nil {
-				log.Printf("Failed to commit message: %v", err)
-			} else {
-				log.Printf("Committed message for order %s", msg.Key)
-			}
-		}
-	}()
+func RunKafkaReader(consumer *Consumer) {
+	consumer.start()
 }
 
-// SetupGracefulShutdown handles SIGTERM to save cache and close resources
-func SetupGracefulShutdown(c *cache.Cache, reader *kafka.Reader) {
+// SetupGracefulShutdown handles SIGTERM: drains HTTP requests for up to
+// timeout, then saves the cache and closes resources, giving queued webhook
+// notifications up to timeout as well
+func SetupGracefulShutdown(srv *server.Server, c *cache.Cache, consumer *Consumer, h *handler.Handler, db *database.Database, timeout time.Duration) {
 	go func() {
 		ch := make(chan os.Signal, 1)
 		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 		<-ch
-		log.Println("Shutting down... Saving cache to file")
+		slog.Info("Shutting down, draining HTTP requests")
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("HTTP server did not shut down cleanly", "error", err)
+		}
+		cancel()
+		slog.Info("Saving cache to file", "file", c.File())
 		c.Stop()
-		if err := c.SaveToFile(); err != nil {
-			log.Printf("Failed to save cache: %v", err)
+		if _, err := c.SaveToFile(); err != nil {
+			slog.Error("Failed to save cache", "error", err, "reason", cache.SaveErrorReason(err))
+		}
+		consumer.Close()
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		h.Close(ctx)
+		cancel()
+		db.Close()
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		if err := tracing.Shutdown(ctx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
 		}
-		reader.Close()
+		cancel()
 		os.Exit(0)
 	}()
 }
\ No newline at end of file
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"orders-service/logging"
+	"strconv"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// workerQueueSize is the number of messages buffered per worker before the
+// read loop blocks
+const workerQueueSize = 16
+
+// job is a message waiting to be handled, along with the reader it came from
+type job struct {
+	reader  messageReader
+	msg     kafka.Message
+	pending *pendingOffset
+}
+
+// startWorkers launches n workers, each handling the messages of its queue in
+// order. Messages are spread over the workers by key, so messages of the same
+// order are never handled concurrently
+func (c *Consumer) startWorkers(n int) {
+	c.queues = make([]chan job, max(n, 1))
+	for i := range c.queues {
+		c.queues[i] = make(chan job, workerQueueSize)
+		go c.work(c.queues[i])
+	}
+}
+
+// stopWorkers lets the workers exit once their queues are drained
+func (c *Consumer) stopWorkers() {
+	for _, q := range c.queues {
+		close(q)
+	}
+}
+
+// dispatch queues msg for the worker owning its key; messages without a key
+// keep the order of their partition instead
+func (c *Consumer) dispatch(reader messageReader, msg kafka.Message) {
+	h := fnv.New32a()
+	if len(msg.Key) > 0 {
+		h.Write(msg.Key)
+	} else {
+		h.Write([]byte(strconv.Itoa(msg.Partition)))
+	}
+
+	c.inflight.Add(1)
+	c.queues[h.Sum32()%uint32(len(c.queues))] <- job{
+		reader:  reader,
+		msg:     msg,
+		pending: c.offsets.track(msg),
+	}
+}
+
+// work handles the jobs of one queue until it is closed
+func (c *Consumer) work(queue <-chan job) {
+	for j := range queue {
+		err := c.handle(j.msg)
+		if msgs := c.offsets.complete(j.pending, err != nil); len(msgs) > 0 {
+			c.commits.add(j.reader, msgs...)
+		}
+		c.inflight.Done()
+	}
+}
+
+// handle passes msg to the handler, retrying it in place with backoff while
+// it fails, so a message failing on a transient error (e.g. the DB being
+// down) is neither skipped nor committed past. Retrying stops when the
+// consumer is closing; the message is then left uncommitted for redelivery
+func (c *Consumer) handle(msg kafka.Message) error {
+	for attempt := 1; ; attempt++ {
+		err := c.handler.HandleOrder(c.workCtx, msg)
+		c.errRate.record(err != nil)
+		if err == nil {
+			return nil
+		}
+
+		delay := backoff(handleRetryBaseDelay, handleRetryMaxDelay, attempt)
+		slog.Error("Failed to process message, retrying",
+			append(logging.Message(msg), "error", err, "attempt", attempt, "retry_in", delay)...)
+		if !c.sleep(delay) {
+			return err
+		}
+	}
+}
+
+// pendingOffset is a message whose handling may not have finished yet
+type pendingOffset struct {
+	msg    kafka.Message
+	done   bool
+	failed bool
+}
+
+// offsetTracker releases messages for committing in partition order: a
+// message handled by a fast worker waits until every earlier message of its
+// partition is done too, so a committed offset never skips unhandled messages
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int][]*pendingOffset
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int][]*pendingOffset)}
+}
+
+// track registers msg; messages must be tracked in the order they were read
+func (t *offsetTracker) track(msg kafka.Message) *pendingOffset {
+	p := &pendingOffset{msg: msg}
+	t.mu.Lock()
+	t.partitions[msg.Partition] = append(t.partitions[msg.Partition], p)
+	t.mu.Unlock()
+	return p
+}
+
+// complete marks p done and returns the messages of its partition that are
+// now done in sequence, to be committed. A failed message, given up on only
+// when the consumer is closing, holds back the rest of its partition, since
+// committing a later message would skip it. Batches of one partition may
+// reach the committer out of order; it skips offsets below ones it has
+// already seen
+func (t *offsetTracker) complete(p *pendingOffset, failed bool) []kafka.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p.done, p.failed = true, failed
+	queue := t.partitions[p.msg.Partition]
+	n := 0
+	for n < len(queue) && queue[n].done && !queue[n].failed {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	msgs := make([]kafka.Message, n)
+	for i, done := range queue[:n] {
+		msgs[i] = done.msg
+	}
+	t.partitions[p.msg.Partition] = queue[n:]
+	return msgs
+}
+
+// reset forgets all tracked messages
+func (t *offsetTracker) reset() {
+	t.mu.Lock()
+	t.partitions = make(map[int][]*pendingOffset)
+	t.mu.Unlock()
+}
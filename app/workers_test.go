@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"orders-service/config"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// keyTracker is a handler recording how many messages of each key are being
+// handled at once
+type keyTracker struct {
+	mu      sync.Mutex
+	active  map[string]int
+	overlap []string // keys seen handled concurrently
+	handled sync.WaitGroup
+}
+
+func (k *keyTracker) HandleOrder(_ context.Context, msg kafka.Message) error {
+	defer k.handled.Done()
+	key := string(msg.Key)
+	k.mu.Lock()
+	k.active[key]++
+	if k.active[key] > 1 {
+		k.overlap = append(k.overlap, key)
+	}
+	k.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	k.mu.Lock()
+	k.active[key]--
+	k.mu.Unlock()
+	return nil
+}
+
+func TestWorkersSerializeSameKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		keys    int
+		perKey  int
+	}{
+		{name: "single worker", workers: 1, keys: 3, perKey: 5},
+		{name: "fewer workers than keys", workers: 4, keys: 10, perKey: 5},
+		{name: "more workers than keys", workers: 16, keys: 2, perKey: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []readResult
+			for i := range tt.perKey {
+				for k := range tt.keys {
+					results = append(results, readResult{msg: kafka.Message{
+						Key:       []byte(fmt.Sprintf("order-%d", k)),
+						Partition: k % 3,
+						Offset:    int64(i*tt.keys + k),
+					}})
+				}
+			}
+			tracker := &keyTracker{active: make(map[string]int)}
+			tracker.handled.Add(len(results))
+			reader := newFakeReader(results...)
+			c := newTestConsumer(t, &readerFactory{readers: []*fakeReader{reader}}, tracker, config.Consumer{Workers: tt.workers})
+
+			c.start()
+			tracker.handled.Wait()
+			if len(tracker.overlap) > 0 {
+				t.Errorf("messages of the same key handled concurrently: %v", tracker.overlap)
+			}
+		})
+	}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tests := []struct {
+		name     string
+		offsets  []int64 // tracked in this order, all on one partition
+		complete []int   // indexes into offsets, completed in this order
+		failed   int     // index of a failed message; -1 for none
+		want     [][]int64
+	}{
+		{name: "in order", offsets: []int64{1, 2, 3}, complete: []int{0, 1, 2}, failed: -1,
+			want: [][]int64{{1}, {2}, {3}}},
+		{name: "out of order", offsets: []int64{1, 2, 3}, complete: []int{2, 1, 0}, failed: -1,
+			want: [][]int64{nil, nil, {1, 2, 3}}},
+		{name: "gap filled", offsets: []int64{1, 2, 3, 4}, complete: []int{0, 2, 3, 1}, failed: -1,
+			want: [][]int64{{1}, nil, nil, {2, 3, 4}}},
+		{name: "failure holds back the rest", offsets: []int64{1, 2, 3}, complete: []int{0, 1, 2}, failed: 1,
+			want: [][]int64{{1}, nil, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			pending := make([]*pendingOffset, len(tt.offsets))
+			for i, offset := range tt.offsets {
+				pending[i] = tracker.track(kafka.Message{Offset: offset})
+			}
+
+			for step, i := range tt.complete {
+				var got []int64
+				for _, msg := range tracker.complete(pending[i], i == tt.failed) {
+					got = append(got, msg.Offset)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(tt.want[step]) {
+					t.Errorf("completing offset %d released %v, want %v", tt.offsets[i], got, tt.want[step])
+				}
+			}
+		})
+	}
+}
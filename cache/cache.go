@@ -2,8 +2,10 @@
 package cache
 
 import (
-	"encoding/gob"
+	"log/slog"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,9 +27,13 @@ func (item Item) IsExpired() bool {
 }
 
 const (
-	NoExpiration     = -1 * time.Second
-	DefaultTTL       = 10 * time.Minute // Default time-to-live for cached orders
-	gcInterval       = 30 * time.Second // GC runs every 30 seconds
+	NoExpiration    = -1 * time.Second
+	DefaultTTL      = 10 * time.Minute // Default time-to-live for cached orders
+	gcInterval      = 30 * time.Second // GC runs every 30 seconds
+	metricsInterval = 5 * time.Second  // size gauges are refreshed every 5 seconds
+	// MaxTTL is the longest TTL the service sets; loaded entries expiring
+	// later than this are clamped
+	MaxTTL = 24 * time.Hour
 )
 
 // Cache is a thread-safe in-memory cache for orders with TTL and persistence
@@ -37,25 +43,107 @@ type Cache struct {
 	gcInterval   time.Duration
 	stopGC       chan bool
 	cacheFile    string
+	fallbackFile string
+	legacyFile   string
+	keyPrefix    string
+	lazyItems    bool
+	allowPartial bool
+	itemsTTL     time.Duration
+	itemSets     map[string]itemSet
+	maxItems     int
+	lru          *lru
+	stats        counters
+	expiration   ExpirationStrategy
+	format       Format
+	compress     bool
+	refresh      RefreshOptions
+	accessMu     sync.Mutex       // guards accessed, which Get updates without holding mu
+	accessed     map[string]int64 // last read per key, Unix nanoseconds; only with refresh-ahead
 }
 
-// gcLoop runs periodic cleanup of expired items in the background
+// itemSet holds an order's items cached separately from the order itself
+type itemSet struct {
+	Items      []model.Item
+	Expiration int64
+}
+
+// Options controls optional cache behavior
+type Options struct {
+	// KeyPrefix namespaces entries (e.g. "orders:") so several logical datasets
+	// can share a backend; callers keep using plain order UIDs
+	KeyPrefix string
+	// LazyItems caches orders without their items; items are cached
+	// separately via SetItems, with ItemsTTL, when a request loads them
+	LazyItems bool
+	ItemsTTL  time.Duration
+	// FallbackFile is written when saving to the cache file fails for lack
+	// of disk space or permissions; empty disables the fallback
+	FallbackFile string
+	// LegacyFile is loaded while the cache file doesn't exist yet, for a file
+	// written under an older default name; saves always go to the cache file
+	LegacyFile string
+	// MaxItems caps the number of entries; when full, Set evicts the least
+	// recently used one. 0 means unlimited
+	MaxItems int
+	// Expiration selects when expired entries are removed; empty means ExpireBoth
+	Expiration ExpirationStrategy
+	// Format is the cache file serialization; empty means FormatGob
+	Format Format
+	// NoCompression writes the cache file uncompressed; by default it is
+	// gzipped. Files are loaded either way
+	NoCompression bool
+	// Refresh reloads popular entries before they expire
+	Refresh RefreshOptions
+	// AllowPartial keeps orders missing delivery or payment when loading the
+	// cache file, as the ingest stores them unless PARTIAL_ORDER_POLICY
+	// rejects them
+	AllowPartial bool
+}
+
+// gcLoop runs periodic cleanup of expired items, unless expiration is lazy,
+// refresh-ahead if enabled, and refreshes the size gauges in the background
 func (c *Cache) gcLoop() {
 	ticker := time.NewTicker(c.gcInterval)
+	metricsTicker := time.NewTicker(metricsInterval)
+
+	// With lazy expiration and no refresh-ahead the sweep never fires; the
+	// loop only refreshes metrics
+	var sweep <-chan time.Time
+	if c.expiration.sweeps() || c.refresh.enabled() {
+		sweep = ticker.C
+	}
+
 	for {
 		select {
-		case <-ticker.C:
-			c.DeleteExpired()
+		case <-sweep:
+			if c.refresh.enabled() {
+				c.refreshAhead()
+			}
+			if c.expiration.sweeps() {
+				c.DeleteExpired()
+			}
+		case <-metricsTicker.C:
+			c.updateSizeMetrics()
 		case <-c.stopGC:
 			ticker.Stop()
+			metricsTicker.Stop()
 			return
 		}
 	}
 }
 
-// delete removes an item from the map (caller must hold lock)
+// key maps an order UID to its namespaced cache key
+func (c *Cache) key(orderUID string) string {
+	return c.keyPrefix + orderUID
+}
+
+// delete removes an item and its separately cached items from the maps
+// (caller must hold lock)
 func (c *Cache) delete(k string) {
 	delete(c.items, k)
+	delete(c.itemSets, k)
+	c.forget(k)
+	c.forgetAccess(k)
 }
 
 // DeleteExpired removes all expired items from the cache
@@ -67,21 +155,47 @@ func (c *Cache) DeleteExpired() {
 	for k, v := range c.items {
 		if v.Expiration > 0 && now > v.Expiration {
 			c.delete(k)
+			c.stats.expirations.Add(1)
+		}
+	}
+	for k, v := range c.itemSets {
+		if v.Expiration > 0 && now > v.Expiration {
+			delete(c.itemSets, k)
 		}
 	}
 }
 
 // New creates a new in-memory cache with GC and file persistence support
-func New(cacheFile string) *Cache {
+func New(cacheFile string, opts Options) *Cache {
 	if cacheFile == "" {
-		cacheFile = "order_cache.gob"
+		cacheFile = DefaultFile(opts.Format, !opts.NoCompression)
 	}
 
 	cache := &Cache{
-		items:      make(map[string]Item),
-		gcInterval: gcInterval,
-		stopGC:     make(chan bool),
-		cacheFile:  cacheFile,
+		items:        make(map[string]Item),
+		gcInterval:   gcInterval,
+		stopGC:       make(chan bool),
+		cacheFile:    cacheFile,
+		fallbackFile: opts.FallbackFile,
+		legacyFile:   opts.LegacyFile,
+		keyPrefix:    opts.KeyPrefix,
+		lazyItems:    opts.LazyItems,
+		allowPartial: opts.AllowPartial,
+		itemsTTL:     opts.ItemsTTL,
+		itemSets:     make(map[string]itemSet),
+		maxItems:     opts.MaxItems,
+		lru:          newLRU(),
+		expiration:   opts.Expiration,
+		format:       opts.Format,
+		compress:     !opts.NoCompression,
+		refresh:      opts.Refresh,
+		accessed:     make(map[string]int64),
+	}
+	if cache.expiration == "" {
+		cache.expiration = ExpireBoth
+	}
+	if cache.format == "" {
+		cache.format = FormatGob
 	}
 
 	go cache.gcLoop()
@@ -99,33 +213,255 @@ func (c *Cache) Set(order model.Order, d time.Duration) {
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.items[order.OrderUID] = Item{
-		Order: order,
+	k := c.key(order.OrderUID)
+	c.items[k] = Item{
+		Order:      c.strip(order),
 		Expiration: e,
 	}
+	delete(c.itemSets, k) // may be outdated now
+	c.touch(k)
+	c.evict()
+}
+
+// SetKeepTTL adds an order like Set, but an entry already cached for it
+// keeps its expiration; d only applies to new entries
+func (c *Cache) SetKeepTTL(order model.Order, d time.Duration) {
+	c.mu.Lock()
+	k := c.key(order.OrderUID)
+	existing, found := c.items[k]
+	if found && !existing.IsExpired() {
+		c.items[k] = Item{
+			Order:      c.strip(order),
+			Expiration: existing.Expiration,
+		}
+		delete(c.itemSets, k)
+		c.touch(k)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	c.Set(order, d)
+}
+
+// Update applies fn to the cached order with the given UID in place; the
+// entry keeps its expiration and separately cached items. It reports whether
+// a live entry was found
+func (c *Cache) Update(orderUID string, fn func(*model.Order)) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := c.key(orderUID)
+	item, found := c.items[k]
+	if !found || item.IsExpired() {
+		return false
+	}
+	fn(&item.Order)
+	c.items[k] = item
+	return true
+}
+
+// strip drops the order's items when they are cached lazily
+func (c *Cache) strip(order model.Order) model.Order {
+	if c.lazyItems {
+		order.Items = nil
+	}
+	return order
+}
+
+// LazyItems reports whether cached orders come without their items
+func (c *Cache) LazyItems() bool {
+	return c.lazyItems
+}
+
+// SetItems caches an order's items separately from the order, with ItemsTTL
+func (c *Cache) SetItems(orderUID string, items []model.Item) {
+	var e int64
+	if c.itemsTTL > 0 {
+		e = time.Now().Add(c.itemsTTL).UnixNano()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.itemSets[c.key(orderUID)] = itemSet{Items: items, Expiration: e}
+}
+
+// GetItems retrieves an order's separately cached items if they have not expired
+func (c *Cache) GetItems(orderUID string) ([]model.Item, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	set, found := c.itemSets[c.key(orderUID)]
+	if !found || (set.Expiration > 0 && time.Now().UnixNano() > set.Expiration) {
+		return nil, false
+	}
+	return set.Items, true
 }
 
 // Get retrieves an order from the cache if it exists and is not expired
 func (c *Cache) Get(orderUID string) (model.Order, bool) {
+	k := c.key(orderUID)
+	// Lookups share the read lock; the write lock is only taken to remove an
+	// expired entry or to move a hit to the front of the LRU order
 	c.mu.RLock()
-	defer c.mu.RUnlock()
+	item, found := c.items[k]
+	expired := found && item.IsExpired()
+	touch := found && !expired && c.maxItems > 0 && !c.mostRecent(k)
+	c.mu.RUnlock()
 
-	item, found := c.items[orderUID]
+	if expired {
+		if c.expiration.expiresOnAccess() {
+			c.expire(k)
+		}
+		found = false
+	}
 	if !found {
+		c.stats.misses.Add(1)
 		return model.Order{}, false
 	}
+	c.stats.hits.Add(1)
+	if touch {
+		c.mu.Lock()
+		// The entry may have been removed since the read lock was released
+		if _, ok := c.items[k]; ok {
+			c.touch(k)
+		}
+		c.mu.Unlock()
+	}
+	c.recordAccess(k)
 	return item.Order, true
 }
 
-// DeleteExpired removes all expired items from the cache
+// expire removes the entry at k if it is still expired once the write lock
+// is held, so concurrent reads of it count a single expiration
+func (c *Cache) expire(k string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok := c.items[k]; ok && item.IsExpired() {
+		c.delete(k)
+		c.stats.expirations.Add(1)
+	}
+}
+
+// Peek retrieves an order like Get, but without counting a hit or miss,
+// refreshing its LRU position or recording an access; it is meant for the
+// service's own lookups, which shouldn't skew stats or keep entries alive
+func (c *Cache) Peek(orderUID string) (model.Order, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, found := c.items[c.key(orderUID)]
+	if !found || item.IsExpired() {
+		return model.Order{}, false
+	}
+	return item.Order, true
+}
+
+// Delete removes an order from the cache
 func (c *Cache) Delete(orderUID string) {
 	c.mu.Lock()
-	delete(c.items, orderUID)
+	c.delete(c.key(orderUID))
+	c.mu.Unlock()
+}
+
+// DeleteReturning removes an order from the cache and returns it, reporting
+// whether an entry existed
+func (c *Cache) DeleteReturning(orderUID string) (model.Order, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := c.key(orderUID)
+	item, found := c.items[key]
+	if !found {
+		return model.Order{}, false
+	}
+	c.delete(key)
+	return item.Order, true
+}
+
+// Flush empties the cache and resets its stats, returning the number of
+// entries removed
+func (c *Cache) Flush() int {
+	c.mu.Lock()
+	n := len(c.items)
+	c.items = make(map[string]Item)
+	c.itemSets = make(map[string]itemSet)
+	c.resetLRU()
+	c.resetAccess()
+	c.stats.reset()
+	c.mu.Unlock()
+
+	c.updateSizeMetrics()
+	return n
+}
+
+// Reload replaces the whole cache with the orders passed to add by load, each
+// with TTL d. The new contents are built off-lock, so reads are only blocked
+// for the final swap; if load fails the current contents are kept
+func (c *Cache) Reload(d time.Duration, load func(add func(model.Order)) error) (int, error) {
+	var e int64
+	if d > 0 {
+		e = time.Now().Add(d).UnixNano()
+	}
+
+	items := make(map[string]Item)
+	err := load(func(order model.Order) {
+		items[c.key(order.OrderUID)] = Item{
+			Order:      c.strip(order),
+			Expiration: e,
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.items = items
+	c.itemSets = make(map[string]itemSet)
+	c.resetLRU()
+	c.resetAccess()
+	n := len(c.items)
 	c.mu.Unlock()
+
+	return n, nil
+}
+
+// Len returns the number of entries that have not expired
+func (c *Cache) Len() int {
+	now := time.Now().UnixNano()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	n := 0
+	for _, v := range c.items {
+		if v.Expiration == 0 || now <= v.Expiration {
+			n++
+		}
+	}
+	return n
+}
+
+// Keys returns the UIDs of the entries that have not expired, sorted; the
+// slice is a snapshot the caller owns
+func (c *Cache) Keys() []string {
+	now := time.Now().UnixNano()
+	c.mu.RLock()
+	keys := make([]string, 0, len(c.items))
+	for k, v := range c.items {
+		if v.Expiration == 0 || now <= v.Expiration {
+			keys = append(keys, strings.TrimPrefix(k, c.keyPrefix))
+		}
+	}
+	c.mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys
 }
 
 // SaveToFile safely dumps the current cache state to a file for persistence
-func (c *Cache) SaveToFile() error {
+// and returns the number of entries written; a failed save keeps the
+// previously saved file
+func (c *Cache) SaveToFile() (int, error) {
 	c.mu.RLock()
 	items := make(map[string]Item, len(c.items))
 	for k, v := range c.items {
@@ -133,14 +469,15 @@ func (c *Cache) SaveToFile() error {
 	}
 	c.mu.RUnlock()
 
-	file, err := os.Create(c.cacheFile)
-	if err != nil {
-		return err
+	if err := c.saveWithFallback(items); err != nil {
+		return 0, err
 	}
-	defer file.Close()
+	return len(items), nil
+}
 
-	encoder := gob.NewEncoder(file)
-	return encoder.Encode(items)
+// File returns the path the cache is persisted to
+func (c *Cache) File() string {
+	return c.cacheFile
 }
 
 func (c *Cache) Stop() {
@@ -149,23 +486,109 @@ func (c *Cache) Stop() {
 
 // LoadFromFile restores the cache from a persisted file if it exists
 func (c *Cache) LoadFromFile() error {
-	file, err := os.Open(c.cacheFile)
+	path := c.loadPath()
+	file, err := os.Open(path)
 	if err != nil {
 		return err // file may not exist on first run
 	}
 	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
-
-	var items map[string]Item
-
-	if err := decoder.Decode(&items); err != nil {
+	r, err := decompress(file)
+	if err != nil {
+		return err
+	}
+	items, err := c.format.decode(r)
+	if err != nil {
 		return err
 	}
 
+	dropped := make(map[string]int) // per reason
+	expired, clamped := 0, 0
+	now := time.Now()
+	for k, v := range items {
+		if reason, err := c.checkEntry(k, v); reason != "" {
+			slog.Debug("Dropping corrupt cache entry", "key", k, "reason", reason, "error", err)
+			delete(items, k)
+			dropped[reason]++
+			continue
+		}
+		if v.IsExpired() {
+			// Expired while the service was down
+			delete(items, k)
+			expired++
+			continue
+		}
+		if e, ok := clampExpiration(v.Expiration, now); ok {
+			v.Expiration = e
+			items[k] = v
+			clamped++
+		}
+		if c.lazyItems && v.Order.Items != nil {
+			v.Order.Items = nil
+			items[k] = v
+		}
+	}
+	if len(dropped) > 0 {
+		total := 0
+		for _, n := range dropped {
+			total += n
+		}
+		slog.Warn("Dropped corrupt entries from cache file", "count", total, "reasons", dropped, "file", path)
+	}
+	if expired > 0 {
+		slog.Info("Dropped expired entries from cache file", "count", expired, "file", path)
+	}
+	if clamped > 0 {
+		slog.Warn("Clamped implausible expirations from cache file", "count", clamped, "file", path)
+	}
+
 	c.mu.Lock()
 	c.items = items
+	c.resetLRU()
+	c.resetAccess()
 	c.mu.Unlock()
 
 	return nil
-}
\ No newline at end of file
+}
+
+// clampExpiration caps an expiration further in the future than any TTL the
+// service sets, which happens when the file was written on a machine whose
+// clock ran ahead; such entries get DefaultTTL from now instead
+func clampExpiration(expiration int64, now time.Time) (int64, bool) {
+	if expiration == 0 || expiration <= now.Add(MaxTTL).UnixNano() {
+		return expiration, false
+	}
+	return now.Add(DefaultTTL).UnixNano(), true
+}
+
+// checkEntry returns why a persisted entry is unsafe to serve, or "" if it is
+// fine: it must have an order UID matching the key it is stored under in this
+// cache's namespace, a plausible expiration and an order passing validation,
+// whose error is returned with the "invalid_order" reason
+func (c *Cache) checkEntry(key string, item Item) (string, error) {
+	switch {
+	case item.Order.OrderUID == "":
+		return "empty_uid", nil
+	case key != c.key(item.Order.OrderUID):
+		return "key_mismatch", nil
+	case item.Expiration < 0:
+		return "negative_expiration", nil
+	}
+	if err := c.validateOrder(item.Order); err != nil {
+		return "invalid_order", err
+	}
+	return "", nil
+}
+
+// validateOrder validates a loaded order like the ingest validates orders
+// from Kafka. Lazily cached orders come without items, which are checked when
+// they are loaded from the DB, so only the rest of such an order is validated
+func (c *Cache) validateOrder(order model.Order) error {
+	if c.lazyItems && len(order.Items) == 0 {
+		order.Items = make([]model.Item, 1)
+	}
+	if c.allowPartial {
+		return order.ValidatePartial()
+	}
+	return order.Validate()
+}
@@ -0,0 +1,445 @@
+package cache
+
+import (
+	"fmt"
+	"orders-service/metrics"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestCache returns a cache persisted under the test's temp dir, stopped
+// when the test ends
+func newTestCache(t *testing.T, opts Options) *Cache {
+	t.Helper()
+	c := New(filepath.Join(t.TempDir(), DefaultFile(opts.Format, !opts.NoCompression)), opts)
+	t.Cleanup(c.Stop)
+	return c
+}
+
+func TestLoadFromFileDropsCorruptEntries(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).UnixNano()
+	noTrack := ordertest.Order("no-track")
+	noTrack.TrackNumber = ""
+	noItems := ordertest.Order("no-items")
+	noItems.Items = nil
+	partial := ordertest.Order("partial")
+	partial.Payment = model.Payment{}
+	tests := []struct {
+		name    string
+		key     string
+		corrupt Item
+	}{
+		{name: "empty UID", key: "empty-uid", corrupt: Item{Expiration: expiration}},
+		{name: "key mismatch", key: "other-key", corrupt: Item{Order: ordertest.Order("mismatch"), Expiration: expiration}},
+		{name: "negative expiration", key: "negative", corrupt: Item{Order: ordertest.Order("negative"), Expiration: -1}},
+		{name: "missing required field", key: "no-track", corrupt: Item{Order: noTrack, Expiration: expiration}},
+		{name: "without items", key: "no-items", corrupt: Item{Order: noItems, Expiration: expiration}},
+		{name: "partial rejected", key: "partial", corrupt: Item{Order: partial, Expiration: expiration}},
+	}
+	for _, format := range []Format{FormatGob, FormatJSON} {
+		for _, tt := range tests {
+			t.Run(string(format)+"/"+tt.name, func(t *testing.T) {
+				opts := Options{Format: format}
+				saved := newTestCache(t, opts)
+				saved.Set(ordertest.Order("good-1"), DefaultTTL)
+				saved.Set(ordertest.Order("good-2"), DefaultTTL)
+				saved.mu.Lock()
+				saved.items[tt.key] = tt.corrupt
+				saved.mu.Unlock()
+				if _, err := saved.SaveToFile(); err != nil {
+					t.Fatalf("SaveToFile: %v", err)
+				}
+
+				loaded := New(saved.File(), opts)
+				t.Cleanup(loaded.Stop)
+				if err := loaded.LoadFromFile(); err != nil {
+					t.Fatalf("LoadFromFile: %v", err)
+				}
+				if n := loaded.Len(); n != 2 {
+					t.Errorf("loaded %d entries, want the 2 good ones", n)
+				}
+				for _, uid := range []string{"good-1", "good-2"} {
+					if _, found := loaded.Peek(uid); !found {
+						t.Errorf("good entry %s not loaded", uid)
+					}
+				}
+				if _, found := loaded.Peek(tt.corrupt.Order.OrderUID); found && tt.corrupt.Order.OrderUID != "" {
+					t.Errorf("corrupt entry %s loaded", tt.corrupt.Order.OrderUID)
+				}
+			})
+		}
+	}
+}
+
+func TestLoadFromFileKeepsValidEntries(t *testing.T) {
+	partial := ordertest.Order("keep-partial")
+	partial.Delivery = model.Delivery{}
+	tests := []struct {
+		name  string
+		order model.Order
+		opts  Options
+	}{
+		{name: "partial allowed", order: partial, opts: Options{AllowPartial: true}},
+		{name: "lazy items", order: ordertest.Order("keep-lazy"), opts: Options{LazyItems: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := newTestCache(t, tt.opts)
+			saved.Set(tt.order, DefaultTTL)
+			if _, err := saved.SaveToFile(); err != nil {
+				t.Fatalf("SaveToFile: %v", err)
+			}
+
+			loaded := New(saved.File(), tt.opts)
+			t.Cleanup(loaded.Stop)
+			if err := loaded.LoadFromFile(); err != nil {
+				t.Fatalf("LoadFromFile: %v", err)
+			}
+			if _, found := loaded.Peek(tt.order.OrderUID); !found {
+				t.Errorf("valid entry %s dropped", tt.order.OrderUID)
+			}
+		})
+	}
+}
+
+func TestSizeMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		inserts int
+		deletes int
+	}{
+		{name: "empty", inserts: 0},
+		{name: "after inserts", inserts: 5},
+		{name: "after deletes", inserts: 5, deletes: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, Options{})
+			for i := range tt.inserts {
+				c.Set(ordertest.Order(fmt.Sprintf("size-%d", i)), DefaultTTL)
+			}
+			for i := range tt.deletes {
+				c.Delete(fmt.Sprintf("size-%d", i))
+			}
+			c.updateSizeMetrics()
+
+			snapshot, err := metrics.Snapshot("cache_")
+			if err != nil {
+				t.Fatalf("gathering metrics: %v", err)
+			}
+			if got, want := snapshot["cache_entries"], float64(tt.inserts-tt.deletes); got != want {
+				t.Errorf("cache_entries = %v, want %v", got, want)
+			}
+			if got, want := snapshot["cache_estimated_bytes"], float64(c.EstimatedBytes()); got != want {
+				t.Errorf("cache_estimated_bytes = %v, want %v", got, want)
+			}
+			if tt.inserts > tt.deletes && snapshot["cache_estimated_bytes"] <= 0 {
+				t.Error("cache_estimated_bytes is zero for a non-empty cache")
+			}
+		})
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name       string
+		saver      string // prefix of the cache saving the shared file
+		loader     string // prefix of the cache loading it
+		wantShared bool
+	}{
+		{name: "same prefix", saver: "orders:", loader: "orders:", wantShared: true},
+		{name: "different prefixes", saver: "orders:", loader: "archive:", wantShared: false},
+		{name: "prefixed and unprefixed", saver: "orders:", loader: "", wantShared: false},
+		{name: "no prefixes", saver: "", loader: "", wantShared: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saver := newTestCache(t, Options{KeyPrefix: tt.saver})
+			order := ordertest.Order("prefixed")
+			saver.Set(order, DefaultTTL)
+
+			// Callers keep using plain order UIDs
+			if _, found := saver.Get(order.OrderUID); !found {
+				t.Fatal("entry not found by its order UID")
+			}
+			if keys := saver.Keys(); len(keys) != 1 || keys[0] != order.OrderUID {
+				t.Errorf("Keys() = %v, want [%s]", keys, order.OrderUID)
+			}
+			if _, err := saver.SaveToFile(); err != nil {
+				t.Fatalf("SaveToFile: %v", err)
+			}
+
+			// Both caches share the file, as they would a shared backend
+			loader := New(saver.File(), Options{KeyPrefix: tt.loader})
+			t.Cleanup(loader.Stop)
+			if err := loader.LoadFromFile(); err != nil {
+				t.Fatalf("LoadFromFile: %v", err)
+			}
+			if _, found := loader.Peek(order.OrderUID); found != tt.wantShared {
+				t.Errorf("entry visible to the loading cache = %v, want %v", found, tt.wantShared)
+			}
+
+			saver.Delete(order.OrderUID)
+			if _, found := saver.Peek(order.OrderUID); found {
+				t.Error("entry still cached after Delete")
+			}
+		})
+	}
+}
+
+func TestDeleteReturning(t *testing.T) {
+	tests := []struct {
+		name      string
+		cached    []string
+		delete    string
+		wantFound bool
+	}{
+		{name: "present", cached: []string{"del-1", "del-2"}, delete: "del-1", wantFound: true},
+		{name: "absent", cached: []string{"del-1"}, delete: "del-missing", wantFound: false},
+		{name: "empty cache", delete: "del-1", wantFound: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, Options{})
+			for _, uid := range tt.cached {
+				c.Set(ordertest.Order(uid), DefaultTTL)
+			}
+
+			order, found := c.DeleteReturning(tt.delete)
+			if found != tt.wantFound {
+				t.Fatalf("DeleteReturning(%s) found = %v, want %v", tt.delete, found, tt.wantFound)
+			}
+			if tt.wantFound && order.OrderUID != tt.delete {
+				t.Errorf("returned order %q, want %q", order.OrderUID, tt.delete)
+			}
+			if !tt.wantFound && order.OrderUID != "" {
+				t.Errorf("returned order %q for an absent entry", order.OrderUID)
+			}
+			if _, still := c.Peek(tt.delete); still {
+				t.Error("entry still cached")
+			}
+			if _, again := c.DeleteReturning(tt.delete); again {
+				t.Error("second DeleteReturning reported an entry")
+			}
+			if want := len(tt.cached) - boolInt(tt.wantFound); c.Len() != want {
+				t.Errorf("Len() = %d, want %d", c.Len(), want)
+			}
+		})
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestLoadFromFileSkewedExpirations(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		expiration int64
+		loaded     bool
+		clamped    bool
+	}{
+		{name: "no expiration", expiration: 0, loaded: true},
+		{name: "within TTL", expiration: now.Add(time.Hour).UnixNano(), loaded: true},
+		{name: "at max TTL", expiration: now.Add(MaxTTL - time.Minute).UnixNano(), loaded: true},
+		{name: "far future", expiration: now.Add(365 * 24 * time.Hour).UnixNano(), loaded: true, clamped: true},
+		{name: "already expired", expiration: now.Add(-time.Hour).UnixNano()},
+		{name: "negative", expiration: -now.UnixNano()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := newTestCache(t, Options{})
+			order := ordertest.Order("skewed")
+			saved.mu.Lock()
+			saved.items[saved.key(order.OrderUID)] = Item{Order: order, Expiration: tt.expiration}
+			saved.mu.Unlock()
+			if _, err := saved.SaveToFile(); err != nil {
+				t.Fatalf("SaveToFile: %v", err)
+			}
+
+			loaded := New(saved.File(), Options{})
+			t.Cleanup(loaded.Stop)
+			if err := loaded.LoadFromFile(); err != nil {
+				t.Fatalf("LoadFromFile: %v", err)
+			}
+			loaded.mu.RLock()
+			item, found := loaded.items[loaded.key(order.OrderUID)]
+			loaded.mu.RUnlock()
+			if found != tt.loaded {
+				t.Fatalf("entry loaded = %v, want %v", found, tt.loaded)
+			}
+			if !found {
+				return
+			}
+			if item.IsExpired() {
+				t.Error("loaded entry is already expired")
+			}
+			switch {
+			case tt.clamped:
+				limit := time.Now().Add(DefaultTTL).UnixNano()
+				if item.Expiration <= 0 || item.Expiration > limit {
+					t.Errorf("expiration %v not clamped to DefaultTTL from now", time.Unix(0, item.Expiration))
+				}
+			case item.Expiration != tt.expiration:
+				t.Errorf("expiration = %d, want it kept at %d", item.Expiration, tt.expiration)
+			}
+		})
+	}
+}
+
+func TestLazyItems(t *testing.T) {
+	tests := []struct {
+		name      string
+		lazy      bool
+		itemsTTL  time.Duration
+		wait      time.Duration
+		wantItems bool // whether the cached order keeps its items
+		wantSet   bool // whether separately cached items are found
+	}{
+		{name: "eager", wantItems: true, wantSet: true},
+		{name: "lazy", lazy: true, itemsTTL: time.Minute, wantSet: true},
+		{name: "lazy without items TTL", lazy: true, wantSet: true},
+		{name: "lazy items expired", lazy: true, itemsTTL: time.Millisecond, wait: 5 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, Options{LazyItems: tt.lazy, ItemsTTL: tt.itemsTTL})
+			order := ordertest.Order("lazy-items")
+			c.Set(order, DefaultTTL)
+
+			cached, found := c.Peek(order.OrderUID)
+			if !found {
+				t.Fatal("order not cached")
+			}
+			if got := cached.Items != nil; got != tt.wantItems {
+				t.Errorf("cached order has items = %v, want %v", got, tt.wantItems)
+			}
+			cached.Items = order.Items
+			if !reflect.DeepEqual(cached, order) {
+				t.Errorf("cached header differs from the order:\ngot:  %+v\nwant: %+v", cached, order)
+			}
+			if _, found := c.GetItems(order.OrderUID); found {
+				t.Error("items found before they were cached")
+			}
+
+			c.SetItems(order.OrderUID, order.Items)
+			time.Sleep(tt.wait)
+			items, found := c.GetItems(order.OrderUID)
+			if found != tt.wantSet {
+				t.Fatalf("items found = %v, want %v", found, tt.wantSet)
+			}
+			if found && !reflect.DeepEqual(items, order.Items) {
+				t.Errorf("cached items = %+v, want %+v", items, order.Items)
+			}
+
+			// Replacing the order drops items that may be outdated now
+			c.Set(order, DefaultTTL)
+			if _, found := c.GetItems(order.OrderUID); found {
+				t.Error("items kept after the order was replaced")
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		orders int
+	}{
+		{name: "empty", orders: 0},
+		{name: "populated", orders: 5},
+		{name: "lazy items", opts: Options{LazyItems: true, ItemsTTL: time.Minute}, orders: 3},
+		{name: "bounded", opts: Options{MaxItems: 4}, orders: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, tt.opts)
+			var uids []string
+			for i := range tt.orders {
+				order := ordertest.Order(fmt.Sprintf("flush-%d", i))
+				c.Set(order, DefaultTTL)
+				c.SetItems(order.OrderUID, order.Items)
+				c.Get(order.OrderUID)
+				uids = append(uids, order.OrderUID)
+			}
+
+			if n := c.Flush(); n != tt.orders {
+				t.Errorf("Flush removed %d entries, want %d", n, tt.orders)
+			}
+			if stats := c.Stats(); stats != (CacheStats{}) {
+				t.Errorf("stats after Flush = %+v, want zero", stats)
+			}
+			for _, uid := range uids {
+				if _, found := c.Get(uid); found {
+					t.Errorf("order %s found after Flush", uid)
+				}
+				if _, found := c.GetItems(uid); found {
+					t.Errorf("items of %s found after Flush", uid)
+				}
+			}
+			if c.Len() != 0 || len(c.Keys()) != 0 {
+				t.Errorf("Len = %d, Keys = %v after Flush, want empty", c.Len(), c.Keys())
+			}
+
+			// The emptied cache keeps working
+			c.Set(ordertest.Order("flush-after"), DefaultTTL)
+			if _, found := c.Get("flush-after"); !found {
+				t.Error("order set after Flush not found")
+			}
+		})
+	}
+}
+
+func TestLenKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		live     []string
+		expired  []string
+		wantKeys []string
+	}{
+		{name: "empty", wantKeys: []string{}},
+		{name: "all live", live: []string{"keys-c", "keys-a", "keys-b"}, wantKeys: []string{"keys-a", "keys-b", "keys-c"}},
+		{name: "one expired", live: []string{"keys-b", "keys-a"}, expired: []string{"keys-c"},
+			wantKeys: []string{"keys-a", "keys-b"}},
+		{name: "all expired", expired: []string{"keys-a", "keys-b"}, wantKeys: []string{}},
+		{name: "key prefix", opts: Options{KeyPrefix: "orders:"}, live: []string{"keys-a"}, expired: []string{"keys-b"},
+			wantKeys: []string{"keys-a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Lazy expiration leaves the expired entries in place for the
+			// duration of the test, so Len and Keys must skip them
+			tt.opts.Expiration = ExpireLazy
+			c := newTestCache(t, tt.opts)
+			for _, uid := range tt.expired {
+				c.Set(ordertest.Order(uid), time.Millisecond)
+			}
+			for _, uid := range tt.live {
+				c.Set(ordertest.Order(uid), DefaultTTL)
+			}
+			time.Sleep(5 * time.Millisecond)
+			for _, uid := range tt.expired {
+				if !stored(c, uid) {
+					t.Fatalf("expired entry %s already removed", uid)
+				}
+			}
+
+			if got := c.Len(); got != len(tt.wantKeys) {
+				t.Errorf("Len() = %d, want %d", got, len(tt.wantKeys))
+			}
+			if got := c.Keys(); !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("Keys() = %v, want %v", got, tt.wantKeys)
+			}
+		})
+	}
+}
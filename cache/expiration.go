@@ -0,0 +1,38 @@
+package cache
+
+import "fmt"
+
+// ExpirationStrategy selects how expired entries are removed
+type ExpirationStrategy string
+
+const (
+	// ExpireLazy removes expired entries only when they are accessed, with no
+	// periodic sweep; Get takes the write lock only for an expired entry
+	ExpireLazy ExpirationStrategy = "lazy"
+	// ExpireEager removes expired entries with a periodic sweep only; Get
+	// reports them as missing but leaves them for the sweep
+	ExpireEager ExpirationStrategy = "eager"
+	// ExpireBoth sweeps periodically and removes expired entries on access
+	ExpireBoth ExpirationStrategy = "both"
+)
+
+// ParseExpirationStrategy validates a strategy name; empty means ExpireBoth
+func ParseExpirationStrategy(v string) (ExpirationStrategy, error) {
+	switch s := ExpirationStrategy(v); s {
+	case ExpireLazy, ExpireEager, ExpireBoth:
+		return s, nil
+	case "":
+		return ExpireBoth, nil
+	}
+	return ExpireBoth, fmt.Errorf("unknown expiration strategy %q", v)
+}
+
+// sweeps reports whether expired entries are removed periodically
+func (s ExpirationStrategy) sweeps() bool {
+	return s != ExpireLazy
+}
+
+// expiresOnAccess reports whether Get removes the expired entries it finds
+func (s ExpirationStrategy) expiresOnAccess() bool {
+	return s != ExpireEager
+}
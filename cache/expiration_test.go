@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"orders-service/ordertest"
+	"testing"
+	"time"
+)
+
+func TestParseExpirationStrategy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ExpirationStrategy
+		wantErr bool
+	}{
+		{in: "", want: ExpireBoth},
+		{in: "lazy", want: ExpireLazy},
+		{in: "eager", want: ExpireEager},
+		{in: "both", want: ExpireBoth},
+		{in: "never", want: ExpireBoth, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseExpirationStrategy(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseExpirationStrategy(%q) = %q, %v, want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// stored reports whether the cache still holds an entry for uid, expired or not
+func stored(c *Cache, uid string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.items[c.key(uid)]
+	return ok
+}
+
+func TestExpirationStrategy(t *testing.T) {
+	tests := []struct {
+		strategy ExpirationStrategy
+		onAccess bool // Get removes the expired entry it finds
+		swept    bool // the periodic sweep removes expired entries
+	}{
+		{strategy: ExpireLazy, onAccess: true},
+		{strategy: ExpireEager, swept: true},
+		{strategy: ExpireBoth, onAccess: true, swept: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			t.Run("on access", func(t *testing.T) {
+				// The default sweep interval is far longer than the test
+				c := newTestCache(t, Options{Expiration: tt.strategy})
+				order := ordertest.Order("expire-on-access")
+				c.Set(order, time.Millisecond)
+				time.Sleep(5 * time.Millisecond)
+
+				if _, found := c.Get(order.OrderUID); found {
+					t.Fatal("Get returned an expired entry")
+				}
+				if got := !stored(c, order.OrderUID); got != tt.onAccess {
+					t.Errorf("removed on access = %v, want %v", got, tt.onAccess)
+				}
+			})
+
+			t.Run("sweep", func(t *testing.T) {
+				c := newTestCache(t, Options{Expiration: tt.strategy})
+				// Restart the loop with a short sweep interval
+				c.stopGC <- true
+				c.gcInterval = 10 * time.Millisecond
+				go c.gcLoop()
+
+				order := ordertest.Order("expire-sweep")
+				c.Set(order, time.Millisecond)
+				time.Sleep(100 * time.Millisecond)
+				if got := !stored(c, order.OrderUID); got != tt.swept {
+					t.Errorf("removed by the sweep = %v, want %v", got, tt.swept)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Format selects how the cache is serialized to its file
+type Format string
+
+const (
+	// FormatGob is compact but opaque; it is the default
+	FormatGob Format = "gob"
+	// FormatJSON can be inspected and edited by hand
+	FormatJSON Format = "json"
+)
+
+// ParseFormat validates a format name; empty means FormatGob
+func ParseFormat(v string) (Format, error) {
+	switch f := Format(v); f {
+	case FormatGob, FormatJSON:
+		return f, nil
+	case "":
+		return FormatGob, nil
+	}
+	return FormatGob, fmt.Errorf("unknown cache file format %q", v)
+}
+
+// DefaultFile returns the cache file name used when none is configured:
+// order_cache with the format as extension, plus .gz when compressed
+func DefaultFile(format Format, compress bool) string {
+	if format == "" {
+		format = FormatGob
+	}
+	name := "order_cache." + string(format)
+	if compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// encode writes items to w in the format
+func (f Format) encode(w io.Writer, items map[string]Item) error {
+	if f == FormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	}
+	return gob.NewEncoder(w).Encode(items)
+}
+
+// decode reads items from r in the format
+func (f Format) decode(r io.Reader) (map[string]Item, error) {
+	var items map[string]Item
+	var err error
+	if f == FormatJSON {
+		err = json.NewDecoder(r).Decode(&items)
+	} else {
+		err = gob.NewDecoder(r).Decode(&items)
+	}
+	return items, err
+}
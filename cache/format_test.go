@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"orders-service/model"
+	"orders-service/ordertest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDefaultFile(t *testing.T) {
+	tests := []struct {
+		format   Format
+		compress bool
+		want     string
+	}{
+		{format: "", want: "order_cache.gob"},
+		{format: FormatGob, want: "order_cache.gob"},
+		{format: FormatGob, compress: true, want: "order_cache.gob.gz"},
+		{format: FormatJSON, want: "order_cache.json"},
+		{format: FormatJSON, compress: true, want: "order_cache.json.gz"},
+	}
+	for _, tt := range tests {
+		if got := DefaultFile(tt.format, tt.compress); got != tt.want {
+			t.Errorf("DefaultFile(%q, %v) = %q, want %q", tt.format, tt.compress, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	partial := ordertest.Order("round-trip-partial")
+	partial.Delivery = model.Delivery{}
+	partial.Payment = model.Payment{}
+	local := ordertest.Order("round-trip-local-time")
+	local.DateCreated = time.Date(2024, 3, 9, 15, 4, 5, 0, time.FixedZone("IDT", 3*60*60))
+	orders := []struct {
+		order model.Order
+		ttl   time.Duration
+	}{
+		{order: ordertest.Order("round-trip-full"), ttl: DefaultTTL},
+		{order: partial, ttl: time.Hour},
+		{order: local, ttl: NoExpiration},
+	}
+
+	for _, format := range []Format{FormatGob, FormatJSON} {
+		for _, compress := range []bool{false, true} {
+			// Partial orders are only kept when the ingest stores them
+			opts := Options{Format: format, NoCompression: !compress, AllowPartial: true}
+			t.Run(DefaultFile(format, compress), func(t *testing.T) {
+				saved := newTestCache(t, opts)
+				for _, o := range orders {
+					saved.Set(o.order, o.ttl)
+				}
+				if n, err := saved.SaveToFile(); err != nil || n != len(orders) {
+					t.Fatalf("SaveToFile = %d, %v, want %d entries", n, err, len(orders))
+				}
+
+				loaded := New(saved.File(), opts)
+				t.Cleanup(loaded.Stop)
+				if err := loaded.LoadFromFile(); err != nil {
+					t.Fatalf("LoadFromFile: %v", err)
+				}
+				if loaded.Len() != len(orders) {
+					t.Errorf("loaded %d entries, want %d", loaded.Len(), len(orders))
+				}
+				for _, o := range orders {
+					got, found := loaded.Peek(o.order.OrderUID)
+					if !found {
+						t.Errorf("order %s not loaded", o.order.OrderUID)
+						continue
+					}
+					if diff := got.Diff(o.order); len(diff) > 0 {
+						t.Errorf("order %s differs after the round trip in %v", o.order.OrderUID, diff)
+					}
+				}
+				saved.mu.RLock()
+				loaded.mu.RLock()
+				for k, item := range saved.items {
+					if loaded.items[k].Expiration != item.Expiration {
+						t.Errorf("expiration of %s = %d, want %d", k, loaded.items[k].Expiration, item.Expiration)
+					}
+				}
+				loaded.mu.RUnlock()
+				saved.mu.RUnlock()
+
+				data, err := os.ReadFile(saved.File())
+				if err != nil {
+					t.Fatal(err)
+				}
+				readable := len(data) > 0 && data[0] == '{'
+				if want := format == FormatJSON && !compress; readable != want {
+					t.Errorf("file is plain JSON = %v, want %v", readable, want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"container/list"
+	"orders-service/metrics"
+)
+
+// lru tracks the access order of cache keys, most recently used first;
+// it is only maintained when the cache has a maximum size
+type lru struct {
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newLRU() *lru {
+	return &lru{order: list.New(), elems: make(map[string]*list.Element)}
+}
+
+// touch marks k as the most recently used key (caller must hold lock)
+func (c *Cache) touch(k string) {
+	if c.maxItems <= 0 {
+		return
+	}
+	if e, ok := c.lru.elems[k]; ok {
+		c.lru.order.MoveToFront(e)
+		return
+	}
+	c.lru.elems[k] = c.lru.order.PushFront(k)
+}
+
+// mostRecent reports whether k is already the most recently used key, which
+// spares Get the write lock for repeated reads of a hot entry (caller must
+// hold lock)
+func (c *Cache) mostRecent(k string) bool {
+	front := c.lru.order.Front()
+	return front != nil && front.Value.(string) == k
+}
+
+// forget stops tracking k (caller must hold lock)
+func (c *Cache) forget(k string) {
+	if e, ok := c.lru.elems[k]; ok {
+		c.lru.order.Remove(e)
+		delete(c.lru.elems, k)
+	}
+}
+
+// evict removes least recently used entries until the cache is within its
+// maximum size (caller must hold lock)
+func (c *Cache) evict() {
+	if c.maxItems <= 0 {
+		return
+	}
+	for len(c.items) > c.maxItems {
+		back := c.lru.order.Back()
+		if back == nil {
+			return
+		}
+		c.delete(back.Value.(string))
+		c.stats.evictions.Add(1)
+		metrics.CacheEvictions.Inc()
+	}
+}
+
+// resetLRU rebuilds the access order after the items map was replaced and
+// trims it to the maximum size; the relative order of the new entries is
+// arbitrary (caller must hold lock)
+func (c *Cache) resetLRU() {
+	c.lru = newLRU()
+	if c.maxItems <= 0 {
+		return
+	}
+	for k := range c.items {
+		c.touch(k)
+	}
+	c.evict()
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"fmt"
+	"orders-service/ordertest"
+	"testing"
+)
+
+func TestLRUEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxItems int
+		hot      int // orders read after every insert, which must survive
+	}{
+		{name: "no reads", maxItems: 10},
+		{name: "hot orders", maxItems: 10, hot: 3},
+		{name: "larger cache", maxItems: 50, hot: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, Options{MaxItems: tt.maxItems})
+			uid := func(i int) string { return fmt.Sprintf("lru-%d", i) }
+
+			total := tt.maxItems + 100
+			for i := range total {
+				c.Set(ordertest.Order(uid(i)), DefaultTTL)
+				for h := range min(tt.hot, i+1) {
+					c.Get(uid(h))
+				}
+				c.mu.RLock()
+				size := len(c.items)
+				c.mu.RUnlock()
+				if size > tt.maxItems {
+					t.Fatalf("cache holds %d entries after %d inserts, cap is %d", size, i+1, tt.maxItems)
+				}
+			}
+
+			// The hot orders and the most recently inserted ones remain
+			want := make(map[string]bool)
+			for h := range tt.hot {
+				want[uid(h)] = true
+			}
+			for i := total - 1; len(want) < tt.maxItems; i-- {
+				want[uid(i)] = true
+			}
+			for i := range total {
+				if _, found := c.Peek(uid(i)); found != want[uid(i)] {
+					t.Errorf("order %s cached = %v, want %v", uid(i), found, want[uid(i)])
+				}
+			}
+			if evictions := c.Stats().Evictions; evictions != int64(total-tt.maxItems) {
+				t.Errorf("counted %d evictions, want %d", evictions, total-tt.maxItems)
+			}
+		})
+	}
+}
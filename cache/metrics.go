@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"orders-service/metrics"
+	"orders-service/model"
+	"unsafe"
+)
+
+// updateSizeMetrics publishes the current entry count and estimated size
+func (c *Cache) updateSizeMetrics() {
+	metrics.CacheEntries.Set(float64(c.Len()))
+	metrics.CacheEstimatedBytes.Set(float64(c.EstimatedBytes()))
+}
+
+// EstimatedBytes roughly estimates the memory held by cached orders: struct
+// sizes plus string contents, ignoring map and allocator overhead
+func (c *Cache) EstimatedBytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var total int64
+	for k, v := range c.items {
+		total += int64(len(k)) + int64(unsafe.Sizeof(v)) + orderBytes(v.Order)
+	}
+	return total
+}
+
+// orderBytes sums the string contents and item storage of an order
+func orderBytes(o model.Order) int64 {
+	n := len(o.OrderUID) + len(o.TrackNumber) + len(o.Entry) + len(o.Locale) +
+		len(o.InternalSignature) + len(o.CustomerID) + len(o.DeliveryService) +
+		len(o.Shardkey) + len(o.OofShard)
+
+	d := o.Delivery
+	n += len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) + len(d.Address) + len(d.Region) + len(d.Email)
+
+	p := o.Payment
+	n += len(p.Transaction) + len(p.RequestID) + len(p.Currency) + len(p.Provider) + len(p.Bank)
+
+	n += len(o.Items) * int(unsafe.Sizeof(model.Item{}))
+	for _, it := range o.Items {
+		n += len(it.TrackNumber) + len(it.RID) + len(it.Name) + len(it.Size) + len(it.Brand)
+	}
+	return int64(n)
+}
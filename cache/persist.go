@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"orders-service/metrics"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Reasons a cache save can fail, as reported by SaveErrorReason
+const (
+	SaveDiskFull   = "disk_full"
+	SavePermission = "permission"
+	SaveOther      = "other"
+)
+
+// SaveErrorReason classifies a SaveToFile error
+func SaveErrorReason(err error) string {
+	switch {
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return SaveDiskFull
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, syscall.EROFS):
+		return SavePermission
+	}
+	return SaveOther
+}
+
+// tempWriter returns the writer for a save's temporary file; tests replace
+// it to simulate failing writes such as a full disk
+var tempWriter = func(f *os.File) io.Writer { return f }
+
+// save writes items to a temporary file next to path, gzipped if compress is
+// set, flushes it to disk and renames it over path, so a failed or
+// interrupted write leaves the previous file intact
+func save(path string, format Format, compress bool, items map[string]Item) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	w := tempWriter(tmp)
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	if err := format.encode(w, items); err != nil {
+		tmp.Close()
+		return err
+	}
+	if zw != nil {
+		// Close flushes the compressed data and writes the gzip footer
+		if err := zw.Close(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// decompress returns a reader for a cache file, gunzipping it when it starts
+// with the gzip magic bytes, so files saved with and without compression load
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// syncDir flushes a directory so a rename within it survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// saveWithFallback saves items to the cache file; if that fails for lack of
+// space or permissions and a fallback file is configured, it is tried instead
+func (c *Cache) saveWithFallback(items map[string]Item) error {
+	err := save(c.cacheFile, c.format, c.compress, items)
+	if err == nil {
+		return nil
+	}
+
+	reason := SaveErrorReason(err)
+	metrics.CacheSaveErrors.WithLabelValues(reason).Inc()
+	slog.Error("Failed to save cache, cached orders will be lost on restart",
+		"file", c.cacheFile, "reason", reason, "error", err)
+
+	if c.fallbackFile == "" || reason == SaveOther {
+		return err
+	}
+	if ferr := save(c.fallbackFile, c.format, c.compress, items); ferr != nil {
+		metrics.CacheSaveErrors.WithLabelValues(SaveErrorReason(ferr)).Inc()
+		slog.Error("Failed to save cache to fallback file", "file", c.fallbackFile, "error", ferr)
+		return errors.Join(err, ferr)
+	}
+	slog.Warn("Cache saved to fallback file instead", "file", c.fallbackFile)
+	return nil
+}
+
+// loadPath returns the file to restore from: the fallback file when it was
+// written more recently than the cache file, otherwise the cache file
+func (c *Cache) loadPath() string {
+	if c.fallbackFile == "" {
+		return c.primaryPath()
+	}
+	fallback, err := os.Stat(c.fallbackFile)
+	if err != nil {
+		return c.primaryPath()
+	}
+	primary, err := os.Stat(c.cacheFile)
+	if err != nil || fallback.ModTime().After(primary.ModTime()) {
+		return c.fallbackFile
+	}
+	return c.cacheFile
+}
+
+// primaryPath returns the cache file, or the legacy file while the cache file
+// doesn't exist and the legacy one does
+func (c *Cache) primaryPath() string {
+	if c.legacyFile == "" {
+		return c.cacheFile
+	}
+	if _, err := os.Stat(c.cacheFile); !errors.Is(err, fs.ErrNotExist) {
+		return c.cacheFile
+	}
+	if _, err := os.Stat(c.legacyFile); err != nil {
+		return c.cacheFile
+	}
+	slog.Info("Cache file not found, loading the legacy file", "file", c.cacheFile, "legacy", c.legacyFile)
+	return c.legacyFile
+}
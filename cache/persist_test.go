@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"orders-service/metrics"
+	"orders-service/ordertest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// failingWriter fails every write with err
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, w.err }
+
+// failWritesIn makes saves to files in dir fail with errno until the test ends
+func failWritesIn(t *testing.T, dir string, errno syscall.Errno) {
+	t.Helper()
+	prev := tempWriter
+	tempWriter = func(f *os.File) io.Writer {
+		if filepath.Dir(f.Name()) == dir {
+			return failingWriter{&fs.PathError{Op: "write", Path: f.Name(), Err: errno}}
+		}
+		return f
+	}
+	t.Cleanup(func() { tempWriter = prev })
+}
+
+func TestSaveErrorReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &fs.PathError{Op: "write", Path: "cache.gob", Err: syscall.ENOSPC}, want: SaveDiskFull},
+		{err: fmt.Errorf("saving: %w", syscall.EDQUOT), want: SaveDiskFull},
+		{err: &fs.PathError{Op: "open", Path: "cache.gob", Err: syscall.EACCES}, want: SavePermission},
+		{err: syscall.EPERM, want: SavePermission},
+		{err: syscall.EROFS, want: SavePermission},
+		{err: syscall.EIO, want: SaveOther},
+		{err: errors.New("gob: type not registered"), want: SaveOther},
+	}
+	for _, tt := range tests {
+		if got := SaveErrorReason(tt.err); got != tt.want {
+			t.Errorf("SaveErrorReason(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSaveFailureKeepsPreviousFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		errno        syscall.Errno
+		fallback     bool
+		wantReason   string
+		wantFallback bool // whether the save lands in the fallback file
+	}{
+		{name: "disk full", errno: syscall.ENOSPC, wantReason: SaveDiskFull},
+		{name: "permission denied", errno: syscall.EACCES, wantReason: SavePermission},
+		{name: "disk full with fallback", errno: syscall.ENOSPC, fallback: true, wantReason: SaveDiskFull, wantFallback: true},
+		{name: "I/O error with fallback", errno: syscall.EIO, fallback: true, wantReason: SaveOther},
+	}
+	for _, compress := range []bool{true, false} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/compress=%v", tt.name, compress), func(t *testing.T) {
+				dir := t.TempDir()
+				opts := Options{NoCompression: !compress}
+				if tt.fallback {
+					opts.FallbackFile = filepath.Join(t.TempDir(), "fallback.gob")
+				}
+				c := New(filepath.Join(dir, DefaultFile(FormatGob, compress)), opts)
+				t.Cleanup(c.Stop)
+				c.Set(ordertest.Order("saved-before"), DefaultTTL)
+				if _, err := c.SaveToFile(); err != nil {
+					t.Fatalf("first SaveToFile: %v", err)
+				}
+				// File times are coarse; date the previous save back so a
+				// fallback written now is recognizably newer
+				past := time.Now().Add(-time.Minute)
+				if err := os.Chtimes(c.File(), past, past); err != nil {
+					t.Fatal(err)
+				}
+
+				failWritesIn(t, dir, tt.errno)
+				c.Set(ordertest.Order("saved-after"), DefaultTTL)
+				key := fmt.Sprintf("cache_save_errors_total{reason=%q}", tt.wantReason)
+				before := saveErrors(t, key)
+				_, err := c.SaveToFile()
+				if got := saveErrors(t, key) - before; got != 1 {
+					t.Errorf("%s rose by %v, want 1", key, got)
+				}
+				if tt.wantFallback {
+					if err != nil {
+						t.Fatalf("SaveToFile with fallback: %v", err)
+					}
+				} else {
+					if err == nil {
+						t.Fatal("SaveToFile succeeded, want an error")
+					}
+					if reason := SaveErrorReason(err); reason != tt.wantReason {
+						t.Errorf("error %v classified as %s, want %s", err, reason, tt.wantReason)
+					}
+				}
+
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 1 {
+					t.Errorf("cache dir holds %d files, want only the previous cache file", len(entries))
+				}
+				previous := New(c.File(), Options{NoCompression: !compress})
+				t.Cleanup(previous.Stop)
+				if err := previous.LoadFromFile(); err != nil {
+					t.Fatalf("loading the previous file: %v", err)
+				}
+				if _, found := previous.Peek("saved-before"); !found || previous.Len() != 1 {
+					t.Errorf("previous cache file damaged: %d entries", previous.Len())
+				}
+
+				restarted := New(c.File(), opts)
+				t.Cleanup(restarted.Stop)
+				if err := restarted.LoadFromFile(); err != nil {
+					t.Fatalf("LoadFromFile after the failed save: %v", err)
+				}
+				if _, found := restarted.Peek("saved-after"); found != tt.wantFallback {
+					t.Errorf("entry saved after the failure restored = %v, want %v", found, tt.wantFallback)
+				}
+			})
+		}
+	}
+}
+
+// saveErrors returns the current value of a cache save error counter
+func saveErrors(t *testing.T, key string) float64 {
+	t.Helper()
+	values, err := metrics.Snapshot("cache_save_errors_total")
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	return values[key]
+}
+
+// limitedWriter writes through to w until limit bytes were written, then fails
+// as if the process died mid-write
+type limitedWriter struct {
+	w     io.Writer
+	limit int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.limit {
+		n, _ := l.w.Write(p[:l.limit])
+		l.limit = 0
+		return n, io.ErrShortWrite
+	}
+	l.limit -= len(p)
+	return l.w.Write(p)
+}
+
+func TestSavePartialWriteKeepsOriginal(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		limit  int
+	}{
+		{name: "gob nothing written", format: FormatGob, limit: 0},
+		{name: "gob truncated", format: FormatGob, limit: 64},
+		{name: "json truncated", format: FormatJSON, limit: 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Format: tt.format, NoCompression: true}
+			c := newTestCache(t, opts)
+			c.Set(ordertest.Order("original"), DefaultTTL)
+			if _, err := c.SaveToFile(); err != nil {
+				t.Fatalf("first SaveToFile: %v", err)
+			}
+			original, err := os.ReadFile(c.File())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			prev := tempWriter
+			tempWriter = func(f *os.File) io.Writer { return &limitedWriter{w: f, limit: tt.limit} }
+			t.Cleanup(func() { tempWriter = prev })
+			c.Set(ordertest.Order("unsaved"), DefaultTTL)
+			if _, err := c.SaveToFile(); err == nil {
+				t.Fatal("SaveToFile succeeded despite the partial write")
+			}
+
+			after, err := os.ReadFile(c.File())
+			if err != nil {
+				t.Fatalf("cache file gone after the partial write: %v", err)
+			}
+			if string(after) != string(original) {
+				t.Error("cache file changed by the partial write")
+			}
+			entries, err := os.ReadDir(filepath.Dir(c.File()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("temp file left behind: %d files next to the cache file", len(entries))
+			}
+
+			loaded := New(c.File(), opts)
+			t.Cleanup(loaded.Stop)
+			if err := loaded.LoadFromFile(); err != nil {
+				t.Fatalf("LoadFromFile: %v", err)
+			}
+			if _, found := loaded.Peek("original"); !found {
+				t.Error("original entry not restored")
+			}
+		})
+	}
+}
+
+func TestCompressedFileSmaller(t *testing.T) {
+	const orders = 200
+	for _, format := range []Format{FormatGob, FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			sizes := make(map[bool]int64)
+			files := make(map[bool]string)
+			for _, compress := range []bool{true, false} {
+				c := newTestCache(t, Options{Format: format, NoCompression: !compress})
+				for i := range orders {
+					c.Set(ordertest.Order(fmt.Sprintf("compressed-%d", i)), DefaultTTL)
+				}
+				if n, err := c.SaveToFile(); err != nil || n != orders {
+					t.Fatalf("SaveToFile = %d, %v, want %d entries", n, err, orders)
+				}
+				info, err := os.Stat(c.File())
+				if err != nil {
+					t.Fatal(err)
+				}
+				sizes[compress], files[compress] = info.Size(), c.File()
+			}
+			if sizes[true] >= sizes[false] {
+				t.Errorf("compressed file is %d bytes, uncompressed %d", sizes[true], sizes[false])
+			}
+
+			// Files load whichever way the loading cache would save them
+			for _, compress := range []bool{true, false} {
+				for _, loadCompressed := range []bool{true, false} {
+					loaded := New(files[compress], Options{Format: format, NoCompression: !loadCompressed})
+					t.Cleanup(loaded.Stop)
+					if err := loaded.LoadFromFile(); err != nil {
+						t.Errorf("loading the compress=%v file with compress=%v: %v", compress, loadCompressed, err)
+						continue
+					}
+					if loaded.Len() != orders {
+						t.Errorf("loading the compress=%v file with compress=%v restored %d entries, want %d",
+							compress, loadCompressed, loaded.Len(), orders)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLoadLegacyFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		primary    bool // whether the cache file was saved too
+		wantLegacy bool // whether the legacy entry is restored
+	}{
+		{name: "cache file missing", wantLegacy: true},
+		{name: "cache file present", primary: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			legacy := New(filepath.Join(dir, DefaultFile(FormatGob, false)), Options{NoCompression: true})
+			t.Cleanup(legacy.Stop)
+			legacy.Set(ordertest.Order("legacy"), DefaultTTL)
+			if _, err := legacy.SaveToFile(); err != nil {
+				t.Fatalf("saving the legacy file: %v", err)
+			}
+			file := filepath.Join(dir, DefaultFile(FormatGob, true))
+			if tt.primary {
+				current := New(file, Options{})
+				t.Cleanup(current.Stop)
+				current.Set(ordertest.Order("current"), DefaultTTL)
+				if _, err := current.SaveToFile(); err != nil {
+					t.Fatalf("saving the cache file: %v", err)
+				}
+			}
+
+			c := New(file, Options{LegacyFile: legacy.File()})
+			t.Cleanup(c.Stop)
+			if err := c.LoadFromFile(); err != nil {
+				t.Fatalf("LoadFromFile: %v", err)
+			}
+			if _, found := c.Peek("legacy"); found != tt.wantLegacy {
+				t.Errorf("legacy entry restored = %v, want %v", found, tt.wantLegacy)
+			}
+			if _, found := c.Peek("current"); found != tt.primary {
+				t.Errorf("cache file entry restored = %v, want %v", found, tt.primary)
+			}
+
+			// Saves go to the new file, which later loads prefer
+			if _, err := c.SaveToFile(); err != nil {
+				t.Fatalf("SaveToFile: %v", err)
+			}
+			if c.File() != file {
+				t.Errorf("saved to %s, want %s", c.File(), file)
+			}
+			if _, err := os.Stat(file); err != nil {
+				t.Errorf("cache file not written: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"orders-service/metrics"
+	"orders-service/model"
+	"time"
+)
+
+// refreshTimeout bounds reloading a single order ahead of its expiry
+const refreshTimeout = 5 * time.Second
+
+// RefreshOptions configures refresh-ahead: the periodic sweep reloads
+// entries that are about to expire but were read recently, so popular
+// orders don't drop out of the cache and make the next request wait on the DB
+type RefreshOptions struct {
+	// Window is how close to expiry an entry must be to get refreshed;
+	// 0 disables refresh-ahead
+	Window time.Duration
+	// RecentAccess is how recently an entry must have been read
+	RecentAccess time.Duration
+	// TTL is given to refreshed entries; 0 means DefaultTTL
+	TTL time.Duration
+	// Load fetches the current version of an order
+	Load func(ctx context.Context, orderUID string) (model.Order, error)
+}
+
+// enabled reports whether refresh-ahead is configured
+func (o RefreshOptions) enabled() bool {
+	return o.Window > 0 && o.Load != nil
+}
+
+// recordAccess notes that key was just read; a no-op without refresh-ahead
+func (c *Cache) recordAccess(k string) {
+	if !c.refresh.enabled() {
+		return
+	}
+	c.accessMu.Lock()
+	c.accessed[k] = time.Now().UnixNano()
+	c.accessMu.Unlock()
+}
+
+// forgetAccess drops the access time of key (caller must hold lock)
+func (c *Cache) forgetAccess(k string) {
+	if !c.refresh.enabled() {
+		return
+	}
+	c.accessMu.Lock()
+	delete(c.accessed, k)
+	c.accessMu.Unlock()
+}
+
+// refreshAhead reloads the entries expiring within the refresh window that
+// were read within RecentAccess, extending their TTL. Orders gone from the
+// DB are removed; on other errors the entry is left to expire
+func (c *Cache) refreshAhead() {
+	now := time.Now()
+	deadline := now.Add(c.refresh.Window).UnixNano()
+	recent := now.Add(-c.refresh.RecentAccess).UnixNano()
+
+	var due []string
+	c.mu.RLock()
+	c.accessMu.Lock()
+	for k, v := range c.items {
+		if v.Expiration > 0 && v.Expiration <= deadline && v.Expiration > now.UnixNano() && c.accessed[k] >= recent {
+			due = append(due, v.Order.OrderUID)
+		}
+	}
+	c.accessMu.Unlock()
+	c.mu.RUnlock()
+
+	ttl := c.refresh.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	for _, uid := range due {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		order, err := c.refresh.Load(ctx, uid)
+		cancel()
+		switch {
+		case errors.Is(err, model.ErrOrderNotFound):
+			c.Delete(uid)
+			metrics.CacheRefreshes.WithLabelValues("gone").Inc()
+		case err != nil:
+			slog.Error("Failed to refresh cached order", "order_uid", uid, "error", err)
+			metrics.CacheRefreshes.WithLabelValues("error").Inc()
+		default:
+			c.Set(order, ttl)
+			metrics.CacheRefreshes.WithLabelValues("refreshed").Inc()
+		}
+	}
+}
+
+// resetAccess forgets all access times after the entries were replaced
+// (caller must hold lock)
+func (c *Cache) resetAccess() {
+	c.accessMu.Lock()
+	c.accessed = make(map[string]int64)
+	c.accessMu.Unlock()
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"testing"
+	"time"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	errDown := errors.New("database is down")
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		access      bool
+		accessedAgo time.Duration
+		loadErr     error
+		wantLoad    bool
+		wantCached  bool
+		wantTTL     time.Duration // approximate TTL left after the sweep
+	}{
+		{name: "popular and near expiry", ttl: 30 * time.Second, access: true,
+			wantLoad: true, wantCached: true, wantTTL: time.Hour},
+		{name: "never read", ttl: 30 * time.Second,
+			wantCached: true, wantTTL: 30 * time.Second},
+		{name: "read long ago", ttl: 30 * time.Second, access: true, accessedAgo: 2 * time.Minute,
+			wantCached: true, wantTTL: 30 * time.Second},
+		{name: "far from expiry", ttl: 10 * time.Minute, access: true,
+			wantCached: true, wantTTL: 10 * time.Minute},
+		{name: "gone from the DB", ttl: 30 * time.Second, access: true, loadErr: model.ErrOrderNotFound,
+			wantLoad: true, wantCached: false},
+		{name: "DB error", ttl: 30 * time.Second, access: true, loadErr: errDown,
+			wantLoad: true, wantCached: true, wantTTL: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("refresh")
+			fresh := ordertest.Order("refresh")
+			fresh.Delivery.City = "Haifa"
+			loads := 0
+			c := newTestCache(t, Options{Refresh: RefreshOptions{
+				Window:       time.Minute,
+				RecentAccess: time.Minute,
+				TTL:          time.Hour,
+				Load: func(_ context.Context, uid string) (model.Order, error) {
+					loads++
+					if uid != order.OrderUID {
+						t.Errorf("loaded %s, want %s", uid, order.OrderUID)
+					}
+					return fresh, tt.loadErr
+				},
+			}})
+			c.Set(order, tt.ttl)
+			if tt.access {
+				c.Get(order.OrderUID)
+			}
+			if tt.accessedAgo > 0 {
+				c.accessMu.Lock()
+				c.accessed[c.key(order.OrderUID)] = time.Now().Add(-tt.accessedAgo).UnixNano()
+				c.accessMu.Unlock()
+			}
+
+			c.refreshAhead()
+
+			if got := loads > 0; got != tt.wantLoad {
+				t.Errorf("order loaded = %v, want %v", got, tt.wantLoad)
+			}
+			got, found := c.Peek(order.OrderUID)
+			if found != tt.wantCached {
+				t.Fatalf("order cached = %v, want %v", found, tt.wantCached)
+			}
+			if !found {
+				return
+			}
+			if refreshed := got.Delivery.City == "Haifa"; refreshed != (tt.wantLoad && tt.loadErr == nil) {
+				t.Errorf("cached order refreshed = %v", refreshed)
+			}
+			c.mu.RLock()
+			left := time.Until(time.Unix(0, c.items[c.key(order.OrderUID)].Expiration))
+			c.mu.RUnlock()
+			if left > tt.wantTTL || left < tt.wantTTL-5*time.Second {
+				t.Errorf("TTL left = %v, want about %v", left, tt.wantTTL)
+			}
+		})
+	}
+}
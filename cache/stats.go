@@ -0,0 +1,40 @@
+package cache
+
+import "sync/atomic"
+
+// CacheStats reports how effective the cache is
+type CacheStats struct {
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Evictions   int64 `json:"evictions"`
+	Expirations int64 `json:"expirations"`
+	Entries     int   `json:"entries"`
+}
+
+// counters are updated atomically since Get counts hits and misses without
+// holding the write lock
+type counters struct {
+	hits        atomic.Int64
+	misses      atomic.Int64
+	evictions   atomic.Int64
+	expirations atomic.Int64
+}
+
+// reset zeroes all counters
+func (s *counters) reset() {
+	s.hits.Store(0)
+	s.misses.Store(0)
+	s.evictions.Store(0)
+	s.expirations.Store(0)
+}
+
+// Stats returns the cache's counters since startup and its current size
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:        c.stats.hits.Load(),
+		Misses:      c.stats.misses.Load(),
+		Evictions:   c.stats.evictions.Load(),
+		Expirations: c.stats.expirations.Load(),
+		Entries:     c.Len(),
+	}
+}
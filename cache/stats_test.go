@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"fmt"
+	"orders-service/ordertest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		run  func(c *Cache)
+		want CacheStats
+	}{
+		{
+			name: "hits and misses",
+			run: func(c *Cache) {
+				c.Set(ordertest.Order("stats-1"), DefaultTTL)
+				c.Get("stats-1")
+				c.Get("stats-1")
+				c.Get("stats-missing")
+				c.Peek("stats-1") // internal lookups don't count
+				c.Peek("stats-missing")
+			},
+			want: CacheStats{Hits: 2, Misses: 1, Entries: 1},
+		},
+		{
+			name: "evictions",
+			opts: Options{MaxItems: 2},
+			run: func(c *Cache) {
+				for i := range 5 {
+					c.Set(ordertest.Order(fmt.Sprintf("stats-%d", i)), DefaultTTL)
+				}
+			},
+			want: CacheStats{Evictions: 3, Entries: 2},
+		},
+		{
+			name: "expired on access",
+			run: func(c *Cache) {
+				c.Set(ordertest.Order("stats-1"), time.Millisecond)
+				time.Sleep(5 * time.Millisecond)
+				c.Get("stats-1")
+			},
+			want: CacheStats{Misses: 1, Expirations: 1},
+		},
+		{
+			name: "expired left for the sweep",
+			opts: Options{Expiration: ExpireEager},
+			run: func(c *Cache) {
+				c.Set(ordertest.Order("stats-1"), time.Millisecond)
+				c.Set(ordertest.Order("stats-2"), time.Millisecond)
+				c.Set(ordertest.Order("stats-3"), DefaultTTL)
+				time.Sleep(5 * time.Millisecond)
+				c.Get("stats-1")
+				c.DeleteExpired()
+			},
+			want: CacheStats{Misses: 1, Expirations: 2, Entries: 1},
+		},
+		{
+			name: "flush resets",
+			run: func(c *Cache) {
+				c.Set(ordertest.Order("stats-1"), DefaultTTL)
+				c.Get("stats-1")
+				c.Get("stats-missing")
+				c.Flush()
+				c.Get("stats-1")
+			},
+			want: CacheStats{Misses: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, tt.opts)
+			tt.run(c)
+			if got := c.Stats(); got != tt.want {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsConcurrentGets(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "default", opts: Options{}},
+		{name: "lru", opts: Options{MaxItems: 10}},
+		{name: "lazy expiration", opts: Options{Expiration: ExpireLazy}},
+		{name: "eager expiration", opts: Options{Expiration: ExpireEager}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, tt.opts)
+			c.Set(ordertest.Order("stats-hit"), DefaultTTL)
+			c.Set(ordertest.Order("stats-other"), DefaultTTL)
+			c.Set(ordertest.Order("stats-expired"), time.Millisecond)
+			time.Sleep(5 * time.Millisecond)
+
+			const workers, gets = 8, 500
+			var wg sync.WaitGroup
+			for range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range gets {
+						c.Get("stats-hit")
+						c.Get("stats-other")
+						c.Get("stats-miss")
+						c.Get("stats-expired")
+					}
+				}()
+			}
+			wg.Wait()
+
+			stats := c.Stats()
+			if stats.Hits != 2*workers*gets || stats.Misses != 2*workers*gets {
+				t.Errorf("Stats() = %+v, want %d hits and misses", stats, 2*workers*gets)
+			}
+			// Concurrent reads of the expired entry remove it once
+			wantExpirations := int64(0)
+			if tt.opts.Expiration.expiresOnAccess() {
+				wantExpirations = 1
+			}
+			if stats.Expirations != wantExpirations {
+				t.Errorf("counted %d expirations, want %d", stats.Expirations, wantExpirations)
+			}
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			if tt.opts.MaxItems > 0 && len(c.lru.elems) != len(c.items) {
+				t.Errorf("LRU tracks %d keys for %d entries", len(c.lru.elems), len(c.items))
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Package config reads the service settings from the environment once at
+// startup into a typed Config that is passed to the initializers
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"orders-service/cache"
+	"orders-service/database"
+	"orders-service/handler"
+	"orders-service/logging"
+	"orders-service/server"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config holds every setting of the service
+type Config struct {
+	LogLevel slog.Level
+	// HTTPAddr is the address the HTTP server listens on
+	HTTPAddr string
+	// ReadOnly is the initial state of the maintenance switch
+	ReadOnly        bool
+	ShutdownTimeout time.Duration
+
+	Database Database
+	Kafka    Kafka
+	Consumer Consumer
+	Cache    Cache
+	Webhook  Webhook
+	Handler  handler.Options
+	Server   server.Options
+}
+
+// Database configures the PostgreSQL connection
+type Database struct {
+	URL string
+	// ReplicaURL points to a read replica serving reads; empty sends them to URL
+	ReplicaURL      string
+	Pool            database.PoolOptions
+	SlowTransaction time.Duration
+	ItemBatchSize   int
+	LoadWorkers     int
+}
+
+// Kafka configures the broker connection and the topics used
+type Kafka struct {
+	Brokers []string
+	Topic   string
+	GroupID string
+	// DLQTopic receives messages that cannot be processed
+	DLQTopic string
+	// ReviewTopic receives conflicting duplicates; empty disables it
+	ReviewTopic string
+	// EventsTopic receives order.persisted events; empty disables them
+	EventsTopic string
+	TLS         bool
+	// SASLMechanism is plain, scram-sha-256 or scram-sha-512; empty disables SASL
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+}
+
+// Consumer configures how messages are processed and committed
+type Consumer struct {
+	ErrorWindow      time.Duration
+	ErrorThreshold   float64
+	ErrorMinMessages int
+	CommitBatch      int
+	CommitInterval   time.Duration
+	Workers          int
+}
+
+// Cache configures the order cache and how it is warmed on startup; the
+// refresh loader is set by the caller
+type Cache struct {
+	File         string
+	WarmStrategy WarmStrategy
+	Options      cache.Options
+}
+
+// Webhook configures the order notifier; an empty URL disables it
+type Webhook struct {
+	URL       string
+	Secret    string
+	QueueSize int
+}
+
+// WarmStrategy selects the sources used to fill the cache on startup; in
+// "x-then-y" strategies x is loaded first and wins, y only fills in orders x lacks
+type WarmStrategy string
+
+const (
+	WarmFileOnly   WarmStrategy = "file-only"
+	WarmDBOnly     WarmStrategy = "db-only"
+	WarmFileThenDB WarmStrategy = "file-then-db"
+	WarmDBThenFile WarmStrategy = "db-then-file"
+)
+
+// ParseWarmStrategy validates a strategy name
+func ParseWarmStrategy(v string) (WarmStrategy, error) {
+	switch s := WarmStrategy(v); s {
+	case WarmFileOnly, WarmDBOnly, WarmFileThenDB, WarmDBThenFile:
+		return s, nil
+	}
+	return "", errors.New("unknown cache warm strategy")
+}
+
+// Load reads the configuration from the environment, including a .env file
+// whose values don't override variables already set. It validates all
+// settings up front and reports every missing or malformed one in a single error
+func Load() (*Config, error) {
+	_ = godotenv.Load()
+
+	e := &env{}
+	cfg := &Config{
+		LogLevel:        lookup(e, "LOG_LEVEL", slog.LevelInfo, logging.ParseLevel),
+		HTTPAddr:        e.string("HTTP_ADDR", ":8080"),
+		ReadOnly:        e.bool("READ_ONLY", false),
+		ShutdownTimeout: e.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		Database: Database{
+			URL:        e.require("DATABASE_URL"),
+			ReplicaURL: e.string("DATABASE_REPLICA_URL", ""),
+			Pool: database.PoolOptions{
+				MaxConns:        e.int("DB_MAX_CONNS", 10),
+				MinConns:        e.int("DB_MIN_CONNS", 0),
+				MaxConnLifetime: e.duration("DB_MAX_CONN_LIFETIME", time.Hour),
+				MaxConnIdleTime: e.duration("DB_MAX_CONN_IDLE_TIME", 30*time.Minute),
+			},
+			SlowTransaction: e.duration("DB_SLOW_TRANSACTION", time.Second),
+			ItemBatchSize:   e.int("DB_ITEM_BATCH_SIZE", database.DefaultItemBatchSize),
+			LoadWorkers:     e.int("DB_LOAD_WORKERS", 4),
+		},
+		Kafka: Kafka{
+			Brokers:       lookup(e, "KAFKA_BROKERS", []string{"kafka:9092"}, parseBrokers),
+			Topic:         e.string("KAFKA_TOPIC", "orders"),
+			GroupID:       e.string("KAFKA_GROUP_ID", "order-service-group"),
+			DLQTopic:      e.string("KAFKA_DLQ_TOPIC", "orders.dlq"),
+			ReviewTopic:   e.string("KAFKA_REVIEW_TOPIC", ""),
+			EventsTopic:   e.string("KAFKA_EVENTS_TOPIC", ""),
+			TLS:           e.bool("KAFKA_TLS_ENABLE", false),
+			SASLMechanism: lookup(e, "KAFKA_SASL_MECHANISM", "", parseSASLMechanism),
+			SASLUsername:  e.string("KAFKA_SASL_USERNAME", ""),
+			SASLPassword:  e.string("KAFKA_SASL_PASSWORD", ""),
+		},
+		Consumer: Consumer{
+			ErrorWindow:      e.duration("CONSUMER_ERROR_WINDOW", time.Minute),
+			ErrorThreshold:   lookup(e, "CONSUMER_ERROR_THRESHOLD", 0, parseRatio),
+			ErrorMinMessages: e.int("CONSUMER_ERROR_MIN_MESSAGES", 10),
+			CommitBatch:      e.int("KAFKA_COMMIT_BATCH", 1),
+			CommitInterval:   e.duration("KAFKA_COMMIT_INTERVAL", time.Second),
+			Workers:          e.int("KAFKA_WORKERS", 1),
+		},
+		Webhook: Webhook{
+			URL:       e.string("WEBHOOK_URL", ""),
+			Secret:    e.string("WEBHOOK_SECRET", ""),
+			QueueSize: e.int("WEBHOOK_QUEUE_SIZE", 1000),
+		},
+	}
+	cfg.Cache = loadCache(e)
+	cfg.Handler = loadHandler(e)
+	cfg.Server = loadServer(e)
+	// The API and the cache file accept the partial orders the ingest accepts
+	cfg.Server.AllowPartial = cfg.Handler.PartialPolicy != handler.PolicyReject
+	cfg.Cache.Options.AllowPartial = cfg.Server.AllowPartial
+
+	if len(e.problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration (%d problems):\n%w", len(e.problems), errors.Join(e.problems...))
+	}
+	return cfg, nil
+}
+
+func loadCache(e *env) Cache {
+	format := lookup(e, "CACHE_FILE_FORMAT", cache.FormatGob, cache.ParseFormat)
+	// JSON files stay readable unless compression is asked for
+	compress := e.bool("CACHE_FILE_COMPRESS", format != cache.FormatJSON)
+	file, legacyFile := e.string("CACHE_FILE", ""), ""
+	if file == "" {
+		file = cache.DefaultFile(format, compress)
+		// The default file had no .gz suffix before compression; it is still
+		// loaded until the first save writes the new one
+		if compress {
+			legacyFile = cache.DefaultFile(format, false)
+		}
+	}
+	return Cache{
+		File:         file,
+		WarmStrategy: lookup(e, "CACHE_WARM_STRATEGY", WarmFileThenDB, ParseWarmStrategy),
+		Options: cache.Options{
+			KeyPrefix:     e.string("CACHE_KEY_PREFIX", ""),
+			LazyItems:     e.bool("CACHE_LAZY_ITEMS", false),
+			ItemsTTL:      e.duration("CACHE_ITEMS_TTL", cache.DefaultTTL),
+			FallbackFile:  e.string("CACHE_FALLBACK_FILE", ""),
+			LegacyFile:    legacyFile,
+			MaxItems:      e.int("CACHE_MAX_ITEMS", 0),
+			Expiration:    lookup(e, "CACHE_EXPIRATION", cache.ExpireBoth, cache.ParseExpirationStrategy),
+			Format:        format,
+			NoCompression: !compress,
+			Refresh: cache.RefreshOptions{
+				Window:       e.duration("CACHE_REFRESH_WINDOW", 0),
+				RecentAccess: e.duration("CACHE_REFRESH_RECENT_ACCESS", time.Minute),
+			},
+		},
+	}
+}
+
+func loadHandler(e *env) handler.Options {
+	opts := handler.Options{
+		EmptyDLQThreshold: e.int("EMPTY_MESSAGE_DLQ_THRESHOLD", 0),
+		EmptyWindow:       e.duration("EMPTY_MESSAGE_WINDOW", time.Minute),
+		DetectConflicts:   e.bool("DUPLICATE_CONFLICT_CHECK", false),
+		ProcessTimeout:    e.duration("PROCESS_TIMEOUT", 0),
+		PartialPolicy:     lookup(e, "PARTIAL_ORDER_POLICY", handler.PolicyReject, handler.ParsePolicy),
+		PricePolicy:       lookup(e, "ITEM_PRICE_POLICY", handler.PolicyAllow, handler.ParsePolicy),
+		DefaultItemSize:   e.string("ITEM_DEFAULT_SIZE", ""),
+		SizePolicy:        lookup(e, "ITEM_SIZE_POLICY", handler.PolicyAllow, handler.ParsePolicy),
+		WriteAttempts:     e.int("DB_WRITE_ATTEMPTS", 3),
+		WriteBackoff:      e.duration("DB_WRITE_BACKOFF", 100*time.Millisecond),
+		Schema:            lookup(e, "ORDER_SCHEMA_FILE", nil, handler.LoadSchema),
+	}
+
+	var err error
+	if opts.SizeRule, err = handler.ParseSizeRule(e.string("ITEM_SIZES", ""), e.string("ITEM_SIZE_PATTERN", "")); err != nil {
+		e.problems = append(e.problems, fmt.Errorf("ITEM_SIZES/ITEM_SIZE_PATTERN: %w", err))
+	}
+	if opts.UIDFilter, err = handler.ParseUIDFilter(e.string("ORDER_UID_ALLOW", ""), e.string("ORDER_UID_DENY", "")); err != nil {
+		e.problems = append(e.problems, fmt.Errorf("ORDER_UID_ALLOW/ORDER_UID_DENY: %w", err))
+	}
+	return opts
+}
+
+func loadServer(e *env) server.Options {
+	return server.Options{
+		AdminToken:     e.string("ADMIN_TOKEN", ""),
+		EscapeHTML:     e.bool("JSON_ESCAPE_HTML", false),
+		EnablePprof:    e.bool("PPROF_ENABLE", false),
+		MaxConcurrent:  e.int("HTTP_MAX_CONCURRENT", 0),
+		CoalesceMisses: e.bool("HTTP_COALESCE_MISSES", true),
+		EnableExpvar:   e.bool("EXPVAR_ENABLE", false),
+		ReadAttempts:   e.int("HTTP_DB_READ_ATTEMPTS", 3),
+		CamelCase:      lookup(e, "JSON_KEY_CASE", false, parseKeyCase),
+		HealthTimeout:  e.duration("HEALTH_TIMEOUT", 2*time.Second),
+		RequestTimeout: e.duration("HTTP_REQUEST_TIMEOUT", 5*time.Second),
+		RateLimit:      lookup(e, "HTTP_RATE_LIMIT", 0, parseRate),
+		RateBurst:      e.int("HTTP_RATE_BURST", 0),
+		CORSOrigins:    e.list("CORS_ALLOWED_ORIGINS"),
+		Warmer: server.WarmerOptions{
+			Threshold: e.int("CACHE_WARM_MISS_THRESHOLD", 0),
+			Window:    e.duration("CACHE_WARM_MISS_WINDOW", 10*time.Second),
+			Batch:     e.int("CACHE_WARM_BATCH", 1000),
+			Cooldown:  e.duration("CACHE_WARM_COOLDOWN", time.Minute),
+		},
+	}
+}
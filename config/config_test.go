@@ -0,0 +1,224 @@
+package config
+
+import (
+	"orders-service/cache"
+	"orders-service/database"
+	"orders-service/handler"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string // substrings the error must contain, one per problem
+	}{
+		{
+			name: "valid",
+			env:  map[string]string{"DATABASE_URL": "postgres://localhost/orders"},
+		},
+		{
+			name: "missing database URL",
+			env:  map[string]string{"DATABASE_URL": ""},
+			want: []string{"DATABASE_URL is not set"},
+		},
+		{
+			name: "several problems",
+			env: map[string]string{
+				"DATABASE_URL":         "",
+				"DB_MAX_CONNS":         "many",
+				"SHUTDOWN_TIMEOUT":     "soon",
+				"KAFKA_SASL_MECHANISM": "gssapi",
+				"JSON_KEY_CASE":        "kebab",
+				"ITEM_SIZE_PATTERN":    "[",
+			},
+			want: []string{
+				"DATABASE_URL is not set",
+				`DB_MAX_CONNS="many": not an integer`,
+				`SHUTDOWN_TIMEOUT="soon": not a duration`,
+				`KAFKA_SASL_MECHANISM="gssapi"`,
+				`JSON_KEY_CASE="kebab"`,
+				"ITEM_SIZES/ITEM_SIZE_PATTERN",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := Load()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Load: %v", err)
+				}
+				if cfg.Database.URL != tt.env["DATABASE_URL"] {
+					t.Errorf("Database.URL = %q, want %q", cfg.Database.URL, tt.env["DATABASE_URL"])
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Load succeeded, want an error")
+			}
+			msg := err.Error()
+			for _, want := range tt.want {
+				if !strings.Contains(msg, want) {
+					t.Errorf("error does not mention %q:\n%s", want, msg)
+				}
+			}
+			if got := strings.Count(msg, "\n"); got != len(tt.want) {
+				t.Errorf("error lists %d problems, want %d:\n%s", got, len(tt.want), msg)
+			}
+		})
+	}
+}
+
+func TestLoadKafka(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    Kafka
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: Kafka{Brokers: []string{"kafka:9092"}, Topic: "orders", GroupID: "order-service-group"},
+		},
+		{
+			name: "configured",
+			env: map[string]string{
+				"KAFKA_BROKERS":  "broker-1:9092, broker-2:9092,,broker-3:9092",
+				"KAFKA_TOPIC":    "orders-staging",
+				"KAFKA_GROUP_ID": "orders-staging-group",
+			},
+			want: Kafka{Brokers: []string{"broker-1:9092", "broker-2:9092", "broker-3:9092"}, Topic: "orders-staging", GroupID: "orders-staging-group"},
+		},
+		{
+			name:    "no brokers",
+			env:     map[string]string{"KAFKA_BROKERS": " , ,"},
+			wantErr: `KAFKA_BROKERS=" , ,": lists no brokers`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", "postgres://localhost/orders")
+			for _, key := range []string{"KAFKA_BROKERS", "KAFKA_TOPIC", "KAFKA_GROUP_ID"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			got := Kafka{Brokers: cfg.Kafka.Brokers, Topic: cfg.Kafka.Topic, GroupID: cfg.Kafka.GroupID}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Kafka = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPool(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want database.PoolOptions
+	}{
+		{
+			name: "defaults",
+			want: database.PoolOptions{MaxConns: 10, MaxConnLifetime: time.Hour, MaxConnIdleTime: 30 * time.Minute},
+		},
+		{
+			name: "configured",
+			env: map[string]string{
+				"DB_MAX_CONNS":          "25",
+				"DB_MIN_CONNS":          "5",
+				"DB_MAX_CONN_LIFETIME":  "15m",
+				"DB_MAX_CONN_IDLE_TIME": "90s",
+			},
+			want: database.PoolOptions{MaxConns: 25, MinConns: 5, MaxConnLifetime: 15 * time.Minute, MaxConnIdleTime: 90 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", "postgres://localhost/orders")
+			for _, key := range []string{"DB_MAX_CONNS", "DB_MIN_CONNS", "DB_MAX_CONN_LIFETIME", "DB_MAX_CONN_IDLE_TIME"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Database.Pool != tt.want {
+				t.Errorf("Database.Pool = %+v, want %+v", cfg.Database.Pool, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string // a non-default setting
+		get   func(*Config) any
+		def   any
+		want  any // what value loads as
+	}{
+		{key: "HTTP_ADDR", value: ":9090", get: func(c *Config) any { return c.HTTPAddr }, def: ":8080", want: ":9090"},
+		{key: "SHUTDOWN_TIMEOUT", value: "30s", get: func(c *Config) any { return c.ShutdownTimeout },
+			def: 10 * time.Second, want: 30 * time.Second},
+		{key: "READ_ONLY", value: "true", get: func(c *Config) any { return c.ReadOnly }, def: false, want: true},
+		{key: "KAFKA_DLQ_TOPIC", value: "orders.dead", get: func(c *Config) any { return c.Kafka.DLQTopic },
+			def: "orders.dlq", want: "orders.dead"},
+		{key: "KAFKA_WORKERS", value: "8", get: func(c *Config) any { return c.Consumer.Workers }, def: 1, want: 8},
+		{key: "CACHE_FILE", value: "/var/lib/orders/cache.gob", get: func(c *Config) any { return c.Cache.File },
+			def: "order_cache.gob.gz", want: "/var/lib/orders/cache.gob"},
+		{key: "CACHE_FILE", value: "/var/lib/orders/cache.gob", get: func(c *Config) any { return c.Cache.Options.LegacyFile },
+			def: "order_cache.gob", want: ""},
+		{key: "CACHE_FILE_FORMAT", value: "json", get: func(c *Config) any { return c.Cache.File },
+			def: "order_cache.gob.gz", want: "order_cache.json"},
+		{key: "CACHE_ITEMS_TTL", value: "5m", get: func(c *Config) any { return c.Cache.Options.ItemsTTL },
+			def: cache.DefaultTTL, want: 5 * time.Minute},
+		{key: "CACHE_WARM_STRATEGY", value: "db-only", get: func(c *Config) any { return c.Cache.WarmStrategy },
+			def: WarmFileThenDB, want: WarmDBOnly},
+		{key: "PARTIAL_ORDER_POLICY", value: "warn", get: func(c *Config) any { return c.Handler.PartialPolicy },
+			def: handler.PolicyReject, want: handler.PolicyWarn},
+		{key: "PARTIAL_ORDER_POLICY", value: "allow", get: func(c *Config) any { return c.Server.AllowPartial },
+			def: false, want: true},
+		{key: "PARTIAL_ORDER_POLICY", value: "warn", get: func(c *Config) any { return c.Cache.Options.AllowPartial },
+			def: false, want: true},
+		{key: "HTTP_REQUEST_TIMEOUT", value: "1s", get: func(c *Config) any { return c.Server.RequestTimeout },
+			def: 5 * time.Second, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", "postgres://localhost/orders")
+			for _, value := range []string{"", tt.value} {
+				t.Setenv(tt.key, value)
+				want := tt.def
+				if value != "" {
+					want = tt.want
+				}
+
+				cfg, err := Load()
+				if err != nil {
+					t.Fatalf("Load with %s=%q: %v", tt.key, value, err)
+				}
+				if got := tt.get(cfg); got != want {
+					t.Errorf("with %s=%q loaded %v, want %v", tt.key, value, got, want)
+				}
+			}
+		})
+	}
+}
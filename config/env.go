@@ -0,0 +1,141 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// env reads settings from the environment, collecting every malformed value
+// so that Load can report them all at once instead of failing on the first
+type env struct {
+	problems []error
+}
+
+// lookup parses key with parse, falling back to def when it is unset; a
+// value that doesn't parse is recorded as a problem
+func lookup[T any](e *env, key string, def T, parse func(string) (T, error)) T {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	t, err := parse(v)
+	if err != nil {
+		e.problems = append(e.problems, fmt.Errorf("%s=%q: %w", key, v, err))
+		return def
+	}
+	return t
+}
+
+// require returns the value of key, recording a problem when it is unset
+func (e *env) require(key string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		e.problems = append(e.problems, fmt.Errorf("%s is not set", key))
+	}
+	return v
+}
+
+// string returns the value of key or def when it is unset
+func (e *env) string(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func (e *env) int(key string, def int) int {
+	return lookup(e, key, def, parseInt)
+}
+
+func (e *env) bool(key string, def bool) bool {
+	return lookup(e, key, def, parseBool)
+}
+
+func (e *env) duration(key string, def time.Duration) time.Duration {
+	return lookup(e, key, def, parseDuration)
+}
+
+// list splits key on commas, dropping blank entries; it is empty when unset
+func (e *env) list(key string) []string {
+	return splitList(os.Getenv(key))
+}
+
+func splitList(v string) []string {
+	var list []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func parseInt(v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.New("not an integer")
+	}
+	return n, nil
+}
+
+func parseBool(v string) (bool, error) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New("not a boolean")
+	}
+	return b, nil
+}
+
+func parseDuration(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.New("not a duration")
+	}
+	return d, nil
+}
+
+func parseRate(v string) (float64, error) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, errors.New("not a non-negative number")
+	}
+	return f, nil
+}
+
+func parseRatio(v string) (float64, error) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		return 0, errors.New("not a number between 0 and 1")
+	}
+	return f, nil
+}
+
+func parseBrokers(v string) ([]string, error) {
+	brokers := splitList(v)
+	if len(brokers) == 0 {
+		return nil, errors.New("lists no brokers")
+	}
+	return brokers, nil
+}
+
+func parseSASLMechanism(v string) (string, error) {
+	switch m := strings.ToLower(v); m {
+	case "plain", "scram-sha-256", "scram-sha-512":
+		return m, nil
+	}
+	return "", errors.New("must be plain, scram-sha-256 or scram-sha-512")
+}
+
+func parseKeyCase(v string) (bool, error) {
+	switch v {
+	case "snake":
+		return false, nil
+	case "camel":
+		return true, nil
+	}
+	return false, errors.New("must be snake or camel")
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"orders-service/model"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Audit actions, one per way an order can be changed through the API
+const (
+	AuditReplace = "replace" // PUT /order/{id}; the change is the new order
+	AuditPatch   = "patch"   // PATCH /order/{id}; the change is the JSON Patch
+	AuditStatus  = "status"  // PATCH /order/{id}/status; the change is {"from", "to"}
+)
+
+// AuditEntry is a recorded change of an order
+type AuditEntry struct {
+	ID        int64           `json:"id" db:"id"`
+	OrderUID  string          `json:"order_uid" db:"order_uid"`
+	Action    string          `json:"action" db:"action"`
+	Change    json.RawMessage `json:"change" db:"change"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// recordAudit adds an audit entry for the order within tx, so the change and
+// its record are committed together
+func recordAudit(ctx context.Context, tx pgx.Tx, uid, action string, change any) error {
+	value, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit change: %w", err)
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO order_audit (order_uid, action, change) VALUES ($1, $2, $3)",
+		uid, action, value)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// PatchOrder applies patch to the stored order in a single transaction: the
+// order is read and locked, apply computes the patched order, which is
+// written like UpdateOrder does, and patch is recorded in the audit trail.
+// An error from apply is returned as is. It returns the patched order, with
+// the stored status, or model.ErrOrderNotFound if the order doesn't exist
+func (db *Database) PatchOrder(ctx context.Context, uid string, patch json.RawMessage,
+	apply func(model.Order) (model.Order, error)) (model.Order, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("cannot start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, orderSelect+" WHERE o.order_uid = $1 FOR UPDATE OF o", uid)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to query order: %w", err)
+	}
+	order, err := pgx.CollectOneRow(rows, scanOrder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Order{}, model.ErrOrderNotFound
+	}
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to scan order row: %w", err)
+	}
+
+	rows, err = tx.Query(ctx, itemsSelect, []string{uid})
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to query items: %w", err)
+	}
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[orderItemRow])
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to scan item rows: %w", err)
+	}
+	for _, item := range items {
+		order.Items = append(order.Items, item.Item)
+	}
+
+	patched, err := apply(order)
+	if err != nil {
+		return model.Order{}, err
+	}
+	patched.Status = order.Status
+
+	if err = updateOrder(ctx, tx, patched); err != nil {
+		return model.Order{}, err
+	}
+	if err = recordAudit(ctx, tx, uid, AuditPatch, patch); err != nil {
+		return model.Order{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return model.Order{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return patched, nil
+}
+
+// OrderAudit returns the audit trail of an order, oldest entry first
+func (db *Database) OrderAudit(ctx context.Context, uid string) ([]AuditEntry, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, order_uid, action, change, created_at
+		FROM order_audit WHERE order_uid = $1 ORDER BY id
+	`, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit trail: %w", err)
+	}
+	entries, err := pgx.CollectRows(rows, pgx.RowToStructByName[AuditEntry])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan audit rows: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"testing"
+)
+
+// auditRows counts the audit entries stored for uid
+func auditRows(t *testing.T, db *Database, uid string) int {
+	t.Helper()
+	var n int
+	err := db.Pool.QueryRow(context.Background(), "SELECT count(*) FROM order_audit WHERE order_uid = $1", uid).Scan(&n)
+	if err != nil {
+		t.Fatalf("counting audit rows: %v", err)
+	}
+	return n
+}
+
+func TestDeleteRemovesAudit(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name   string
+		orders int
+		delete func(ctx context.Context, db *Database, orders []model.Order) error
+	}{
+		{name: "DeleteOrder", orders: 1, delete: func(ctx context.Context, db *Database, orders []model.Order) error {
+			return db.DeleteOrder(ctx, orders[0].OrderUID)
+		}},
+		{name: "DeleteByCustomer", orders: 3, delete: func(ctx context.Context, db *Database, orders []model.Order) error {
+			uids, err := db.DeleteByCustomer(ctx, orders[0].CustomerID)
+			if err == nil && len(uids) != len(orders) {
+				err = fmt.Errorf("deleted %d orders, want %d", len(uids), len(orders))
+			}
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var orders []model.Order
+			for i := range tt.orders {
+				order := ordertest.Order(fmt.Sprintf("audit-delete-%s-%d", tt.name, i))
+				order.CustomerID = "audit-delete-" + tt.name
+				storeTestOrder(t, db, order)
+				// Both kinds of entries hold the customer's data or point to it
+				order.Delivery.City = "Haifa"
+				if err := db.UpdateOrder(ctx, order); err != nil {
+					t.Fatalf("UpdateOrder: %v", err)
+				}
+				if err := db.UpdateStatus(ctx, order.OrderUID, model.StatusPaid); err != nil {
+					t.Fatalf("UpdateStatus: %v", err)
+				}
+				if n := auditRows(t, db, order.OrderUID); n != 2 {
+					t.Fatalf("%d audit rows recorded, want 2", n)
+				}
+				orders = append(orders, order)
+			}
+
+			if err := tt.delete(ctx, db, orders); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			for _, order := range orders {
+				if n := auditRows(t, db, order.OrderUID); n != 0 {
+					t.Errorf("%d audit rows of %s left after deleting it", n, order.OrderUID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"orders-service/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultItemBatchSize is the number of order UIDs per item query when
+// Database.ItemBatchSize is not set
+const DefaultItemBatchSize = 500
+
+// itemBatchSize returns the configured item batch size or its default
+func (db *Database) itemBatchSize() int {
+	if db.ItemBatchSize <= 0 {
+		return DefaultItemBatchSize
+	}
+	return db.ItemBatchSize
+}
+
+// itemsSelect selects the items of the orders whose UIDs are given in $1
+const itemsSelect = `
+	SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size,
+		total_price, nm_id, brand, status
+	FROM items WHERE order_uid = ANY($1)
+`
+
+// orderItemRow is an item row together with the order it belongs to
+type orderItemRow struct {
+	OrderUID string `db:"order_uid"`
+	model.Item
+}
+
+// itemsForOrders loads the items of many orders, keyed by order UID. The UIDs
+// are queried in chunks of ItemBatchSize so a large list never turns into a
+// single huge array parameter
+func (db *Database) itemsForOrders(ctx context.Context, uids []string) (map[string][]model.Item, error) {
+	size := db.itemBatchSize()
+	result := make(map[string][]model.Item, len(uids))
+	for start := 0; start < len(uids); start += size {
+		end := min(start+size, len(uids))
+
+		rows, err := db.reader().Query(ctx, itemsSelect, uids[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to query items: %w", err)
+		}
+
+		items, err := pgx.CollectRows(rows, pgx.RowToStructByName[orderItemRow])
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan item rows: %w", err)
+		}
+		for _, item := range items {
+			result[item.OrderUID] = append(result[item.OrderUID], item.Item)
+		}
+	}
+	return result, nil
+}
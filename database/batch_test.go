@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"orders-service/ordertest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// itemQueries is a pgx tracer recording the number of UIDs passed to each
+// item query
+type itemQueries struct {
+	mu     sync.Mutex
+	chunks []int
+}
+
+func (q *itemQueries) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if data.SQL == itemsSelect && len(data.Args) == 1 {
+		if uids, ok := data.Args[0].([]string); ok {
+			q.mu.Lock()
+			q.chunks = append(q.chunks, len(uids))
+			q.mu.Unlock()
+		}
+	}
+	return ctx
+}
+
+func (q *itemQueries) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// Chunks returns the sizes of the item queries made so far
+func (q *itemQueries) Chunks() []int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]int(nil), q.chunks...)
+}
+
+// tracedDatabase connects to TEST_DATABASE_URL like testDatabase, with
+// tracer attached to its connections
+func tracedDatabase(t *testing.T, tracer pgx.QueryTracer) *Database {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parsing TEST_DATABASE_URL: %v", err)
+	}
+	cfg.ConnConfig.Tracer = tracer
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return &Database{Pool: pool}
+}
+
+func TestGetOrdersChunksItemQueries(t *testing.T) {
+	seed := testDatabase(t)
+	var uids []string
+	for i := range 5 {
+		order := ordertest.Order(fmt.Sprintf("item-batch-%d", i))
+		second := order.Items[0]
+		second.ChrtID++
+		second.RID += "2"
+		order.Items = append(order.Items, second)
+		storeTestOrder(t, seed, order)
+		uids = append(uids, order.OrderUID)
+	}
+
+	tests := []struct {
+		name       string
+		batchSize  int
+		wantChunks []int
+	}{
+		{name: "default", batchSize: 0, wantChunks: []int{5}},
+		{name: "exact fit", batchSize: 5, wantChunks: []int{5}},
+		{name: "chunked", batchSize: 2, wantChunks: []int{2, 2, 1}},
+		{name: "one per query", batchSize: 1, wantChunks: []int{1, 1, 1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := &itemQueries{}
+			db := tracedDatabase(t, queries)
+			db.ItemBatchSize = tt.batchSize
+
+			orders, err := db.GetOrders(context.Background(), uids)
+			if err != nil {
+				t.Fatalf("GetOrders: %v", err)
+			}
+			if len(orders) != len(uids) {
+				t.Fatalf("got %d orders, want %d", len(orders), len(uids))
+			}
+			for _, order := range orders {
+				if len(order.Items) != 2 {
+					t.Errorf("order %s has %d items, want 2", order.OrderUID, len(order.Items))
+				}
+			}
+			if got := queries.Chunks(); fmt.Sprint(got) != fmt.Sprint(tt.wantChunks) {
+				t.Errorf("item queries for %v UIDs, want %v", got, tt.wantChunks)
+			}
+		})
+	}
+}
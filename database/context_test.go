@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"orders-service/ordertest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// hangingDatabase returns a database whose server accepts connections but
+// never answers, so every query blocks until its context is done
+func hangingDatabase(t *testing.T) *Database {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	pool, err := pgxpool.New(context.Background(), "postgres://test:test@"+ln.Addr().String()+"/orders?sslmode=disable")
+	if err != nil {
+		t.Fatalf("creating pool: %v", err)
+	}
+	t.Cleanup(func() {
+		ln.Close()
+		mu.Lock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+		pool.Close()
+	})
+	return &Database{Pool: pool}
+}
+
+func TestQueriesStopOnCancel(t *testing.T) {
+	tests := []struct {
+		name  string
+		query func(ctx context.Context, db *Database) error
+	}{
+		{name: "MakeOrder", query: func(ctx context.Context, db *Database) error {
+			return db.MakeOrder(ctx, ordertest.Order("cancel-make"))
+		}},
+		{name: "ItemsInfo", query: func(ctx context.Context, db *Database) error {
+			_, err := db.ItemsInfo(ctx, "cancel-items")
+			return err
+		}},
+		{name: "DeleteOrder", query: func(ctx context.Context, db *Database) error {
+			return db.DeleteOrder(ctx, "cancel-delete")
+		}},
+		{name: "GetAllOrders", query: func(ctx context.Context, db *Database) error {
+			_, err := db.GetAllOrders(ctx)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := hangingDatabase(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			done := make(chan error, 1)
+			go func() { done <- tt.query(ctx, db) }()
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("error = %v, want context.Canceled", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("query did not return after its context was canceled")
+			}
+		})
+	}
+}
@@ -2,37 +2,128 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"orders-service/metrics"
 	"orders-service/model"
-	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 )
 
-var ctx = context.Background()
+// connectTimeout bounds connecting to and pinging the database on startup
+const connectTimeout = 10 * time.Second
 
 type Database struct {
 	Pool *pgxpool.Pool
+
+	// Replica, when set, serves the read-only queries so that cache warm-up
+	// and cache misses don't compete with writes; writes, transactions and
+	// the duplicate check always use Pool
+	Replica *pgxpool.Pool
+
+	// ItemBatchSize caps the number of orders whose items are loaded by a
+	// single query; 0 means DefaultItemBatchSize
+	ItemBatchSize int
+
+	// LoadWorkers is the number of pages StreamAllOrders loads concurrently;
+	// values below 1 mean one at a time
+	LoadWorkers int
+
+	// SlowTransaction is the MakeOrder duration above which a warning is
+	// logged; 0 disables the warning
+	SlowTransaction time.Duration
 }
 
-// New initializes a connection pool to PostgreSQL using DATABASE_URL
-func New() (*Database, error) {
-	if err := godotenv.Load(); err != nil {
-		if !os.IsNotExist(err) {
-			log.Printf("Warning: failed to load .env file: %v", err)
-		} else {
-			log.Println("No .env file found, using environment variables from Docker")
-		}
+// PoolOptions tunes the connection pool; zero or negative values keep the
+// pgxpool defaults
+type PoolOptions struct {
+	MaxConns        int
+	MinConns        int
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
+
+// apply copies the set options onto cfg
+func (o PoolOptions) apply(cfg *pgxpool.Config) {
+	if o.MaxConns > 0 {
+		cfg.MaxConns = int32(o.MaxConns)
+	}
+	if o.MinConns > 0 {
+		cfg.MinConns = int32(o.MinConns)
+	}
+	if cfg.MinConns > cfg.MaxConns {
+		slog.Warn("Pool min connections exceed max, using max", "min_conns", cfg.MinConns, "max_conns", cfg.MaxConns)
+		cfg.MinConns = cfg.MaxConns
+	}
+	if o.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = o.MaxConnLifetime
+	}
+	if o.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = o.MaxConnIdleTime
+	}
+}
+
+// New initializes a connection pool to the PostgreSQL database at url
+func New(url string, opts PoolOptions) (*Database, error) {
+	pool, err := connect(url, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Connected to PostgreSQL")
+
+	return &Database{
+		Pool: pool,
+	}, nil
+}
+
+// ConnectReplica opens a pool to the read replica at url and routes reads to it
+func (db *Database) ConnectReplica(url string, opts PoolOptions) error {
+	pool, err := connect(url, opts)
+	if err != nil {
+		return fmt.Errorf("replica: %w", err)
+	}
+	slog.Info("Connected to PostgreSQL read replica")
+	db.Replica = pool
+	return nil
+}
+
+// reader returns the pool for read-only queries: the replica when one is
+// connected, the primary otherwise
+func (db *Database) reader() *pgxpool.Pool {
+	if db.Replica != nil {
+		return db.Replica
 	}
+	return db.Pool
+}
 
-	database_url := os.Getenv("DATABASE_URL")
-	if database_url == "" {
-		return nil, fmt.Errorf("database_url is not set")
+// connect opens a pool with opts and checks that the database answers
+func connect(url string, opts PoolOptions) (*pgxpool.Pool, error) {
+	if url == "" {
+		return nil, fmt.Errorf("database url is not set")
 	}
 
-	pool, err := pgxpool.New(ctx, database_url)
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database url: %w", err)
+	}
+	opts.apply(cfg)
+	cfg.ConnConfig.Tracer = queryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
@@ -41,77 +132,197 @@ func New() (*Database, error) {
 		pool.Close()
 		return nil, fmt.Errorf("unable to ping database: %w", err)
 	}
+	return pool, nil
+}
 
-	fmt.Println("Connected to PostgreSQL database!")
+// Close closes all pool connections, logging the pools' final stats
+func (db *Database) Close() {
+	closePool("database", db.Pool)
+	if db.Replica != nil {
+		closePool("replica", db.Replica)
+	}
+}
 
-	return &Database{
-		Pool: pool,
-	}, nil
+func closePool(name string, pool *pgxpool.Pool) {
+	stat := pool.Stat()
+	slog.Info("Closing pool", "pool", name, "conns", stat.TotalConns(), "in_use", stat.AcquiredConns(),
+		"idle", stat.IdleConns(), "acquired_total", stat.AcquireCount())
+	pool.Close()
 }
 
-// MakeOrder inserts a complete order (with delivery, payment, items) in a single transaction
-func (db *Database) MakeOrder(order model.Order) error {
+// MakeOrder inserts a complete order (with delivery, payment, items) in a single transaction.
+// A missing (zero) delivery or payment gets no row rather than one of zero values
+func (db *Database) MakeOrder(ctx context.Context, order model.Order) (err error) {
+	defer db.observeMakeOrder(order, time.Now())
+	ctx, span := tracer.Start(ctx, "MakeOrder", trace.WithAttributes(
+		attribute.String("order_uid", order.OrderUID),
+		attribute.Int("items", len(order.Items)),
+	))
+	defer func() {
+		if err != nil && !errors.Is(err, model.ErrOrderExists) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("cannot start transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	// Проверка на дубль
-	var exists bool
-	err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM orders WHERE order_uid = $1)", order.OrderUID).
-		Scan(&exists)
+	// Duplicates are detected by the unique order_uid, which unlike a prior
+	// existence check holds for concurrent inserts too
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO orders (
+			order_uid, track_number, entry, locale, internal_signature,
+			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (order_uid) DO NOTHING
+	`, order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+		orderStatus(order))
 	if err != nil {
-		return fmt.Errorf("failed to check duplicate: %w", err)
+		return fmt.Errorf("failed to create order: %w", err)
 	}
-	if exists {
+	if tag.RowsAffected() == 0 {
 		return model.ErrOrderExists
 	}
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO orders (
-			order_uid, track_number, entry, locale, internal_signature,
-			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-	`, order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
-		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard)
+	if err = insertParts(ctx, tx, order); err != nil {
+		return err
+	}
+
+	if err = insertItems(ctx, tx, order); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// insertParts inserts the order's delivery and payment rows within tx; a
+// missing (zero) delivery or payment gets no row rather than one of zero values
+func insertParts(ctx context.Context, tx pgx.Tx, order model.Order) error {
+	if !order.Delivery.IsZero() {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO delivery (
+				order_uid, name, phone, zip, city, address, region, email
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
+			order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+		if err != nil {
+			return fmt.Errorf("failed to create delivery: %w", err)
+		}
+	}
+
+	if !order.Payment.IsZero() {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO payment (
+				transaction, order_uid, request_id, currency, provider,
+				amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		`, order.Payment.Transaction, order.OrderUID, order.Payment.RequestID, order.Payment.Currency,
+			order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt,
+			order.Payment.Bank, order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+		if err != nil {
+			return fmt.Errorf("failed to create payment: %w", err)
+		}
+	}
+	return nil
+}
+
+// insertItem inserts one item of an order
+const insertItem = `
+	INSERT INTO items (
+		chrt_id, track_number, price, rid, name, sale, size, total_price,
+		nm_id, brand, status, order_uid
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+`
+
+// insertItems inserts the order's items within tx, sending all inserts in a
+// single batch so the round trips don't grow with the number of items
+func insertItems(ctx context.Context, tx pgx.Tx, order model.Order) error {
+	if len(order.Items) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, item := range order.Items {
+		batch.Queue(insertItem, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name,
+			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status, order.OrderUID)
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to create item: %w", err)
+	}
+	return nil
+}
+
+// orderStatus returns the status to store for a new order, created by default
+func orderStatus(order model.Order) string {
+	if order.Status == "" {
+		return model.StatusCreated
+	}
+	return order.Status
+}
+
+// UpdateStatus moves an order to a new status, recording the transition in
+// the audit trail. It returns model.ErrInvalidTransition if its current
+// status doesn't allow it and model.ErrOrderNotFound if the order doesn't exist
+func (db *Database) UpdateStatus(ctx context.Context, uid, status string) error {
+	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create order: %w", err)
+		return fmt.Errorf("cannot start transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO delivery (
-			order_uid, name, phone, zip, city, address, region, email
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`, order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
-		order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+	var current string
+	err = tx.QueryRow(ctx, "SELECT status FROM orders WHERE order_uid = $1 FOR UPDATE", uid).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ErrOrderNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create delivery: %w", err)
+		return fmt.Errorf("failed to query order status: %w", err)
+	}
+	if !model.CanTransition(current, status) {
+		return fmt.Errorf("%w from %s to %s", model.ErrInvalidTransition, current, status)
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE orders SET status = $2 WHERE order_uid = $1", uid, status); err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+	if err = recordAudit(ctx, tx, uid, AuditStatus, map[string]string{"from": current, "to": status}); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO payment (
-			transaction, order_uid, request_id, currency, provider,
-			amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-	`, order.Payment.Transaction, order.OrderUID, order.Payment.RequestID, order.Payment.Currency,
-		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt,
-		order.Payment.Bank, order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+	return nil
+}
+
+// UpdateOrder overwrites a stored order: its orders row is updated and its
+// delivery, payment and items replaced, all in a single transaction. The status
+// is kept; it only changes through UpdateStatus. The new order is recorded in
+// the audit trail. It returns model.ErrOrderNotFound if the order doesn't exist
+func (db *Database) UpdateOrder(ctx context.Context, order model.Order) error {
+	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create payment: %w", err)
+		return fmt.Errorf("cannot start transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	for _, item := range order.Items {
-		_, err = tx.Exec(ctx, `
-			INSERT INTO items (
-				chrt_id, track_number, price, rid, name, sale, size, total_price,
-				nm_id, brand, status, order_uid
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-		`, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name,
-			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status, order.OrderUID)
-		if err != nil {
-			return fmt.Errorf("failed to create item: %w", err)
-		}
+	if err = updateOrder(ctx, tx, order); err != nil {
+		return err
+	}
+	if err = recordAudit(ctx, tx, order.OrderUID, AuditReplace, order); err != nil {
+		return err
 	}
 
 	if err = tx.Commit(ctx); err != nil {
@@ -121,44 +332,156 @@ func (db *Database) MakeOrder(order model.Order) error {
 	return nil
 }
 
+// updateOrder writes the order's rows within tx, keeping its status
+func updateOrder(ctx context.Context, tx pgx.Tx, order model.Order) error {
+	tag, err := tx.Exec(ctx, `
+		UPDATE orders SET
+			track_number = $2, entry = $3, locale = $4, internal_signature = $5,
+			customer_id = $6, delivery_service = $7, shardkey = $8, sm_id = $9,
+			date_created = $10, oof_shard = $11
+		WHERE order_uid = $1
+	`, order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard)
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrOrderNotFound
+	}
+
+	// The delivery and payment rows are replaced rather than updated, since
+	// a partial order may have been stored without them
+	if _, err = tx.Exec(ctx, "DELETE FROM delivery WHERE order_uid = $1", order.OrderUID); err != nil {
+		return fmt.Errorf("failed to delete delivery: %w", err)
+	}
+	if _, err = tx.Exec(ctx, "DELETE FROM payment WHERE order_uid = $1", order.OrderUID); err != nil {
+		return fmt.Errorf("failed to delete payment: %w", err)
+	}
+	if err = insertParts(ctx, tx, order); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM items WHERE order_uid = $1", order.OrderUID); err != nil {
+		return fmt.Errorf("failed to delete items: %w", err)
+	}
+	return insertItems(ctx, tx, order)
+}
+
+// observeMakeOrder records the duration of a MakeOrder transaction started at
+// start and warns about slow ones, which hold their locks for long
+func (db *Database) observeMakeOrder(order model.Order, start time.Time) {
+	elapsed := time.Since(start)
+	metrics.MakeOrderDuration.Observe(elapsed.Seconds())
+	if db.SlowTransaction > 0 && elapsed > db.SlowTransaction {
+		slog.Warn("Slow MakeOrder transaction", "order_uid", order.OrderUID, "items", len(order.Items),
+			"elapsed", elapsed, "threshold", db.SlowTransaction)
+	}
+}
+
 // ItemsInfo retrieves item data for a given order_uid from the database
-func (db *Database) ItemsInfo(order_uid string) ([]model.ItemInfo, error) {
+func (db *Database) ItemsInfo(ctx context.Context, order_uid string) ([]model.ItemInfo, error) {
 	sql := `
-	SELECT track_number, name, price,sale, size, total_price, brand
+	SELECT chrt_id, track_number, price, rid, name, sale, size, total_price,
+		nm_id, brand, status
 	FROM items WHERE order_uid = $1
 	`
 
-	rows, err := db.Pool.Query(ctx, sql, order_uid)
+	rows, err := db.reader().Query(ctx, sql, order_uid)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query items: %w", err)
 	}
-	defer rows.Close()
 
-	var items []model.ItemInfo
-	for rows.Next() {
-		var item model.ItemInfo
-		err := rows.Scan(
-			&item.TrackNumber, &item.Name, &item.Price, &item.Sale,
-			&item.Size, &item.TotalPrice, &item.Brand,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan item row: %w", err)
-		}
-		items = append(items, item)
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[model.ItemInfo])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan item rows: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, model.ErrOrderNotFound
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %w", err)
+	return items, nil
+}
+
+// Items retrieves all item columns for a given order_uid, optionally only
+// items with the given status; it returns model.ErrOrderNotFound if the
+// order doesn't exist
+func (db *Database) Items(ctx context.Context, order_uid string, status *int) ([]model.Item, error) {
+	sql := `
+	SELECT chrt_id, track_number, price, rid, name, sale, size, total_price,
+		nm_id, brand, status
+	FROM items WHERE order_uid = $1
+	`
+	args := []interface{}{order_uid}
+	if status != nil {
+		sql += " AND status = $2"
+		args = append(args, *status)
 	}
+
+	rows, err := db.reader().Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query items: %w", err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[model.Item])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan item rows: %w", err)
+	}
+
 	if len(items) == 0 {
-		return nil, model.ErrOrderNotFound
+		exists, err := db.OrderExists(ctx, order_uid)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, model.ErrOrderNotFound
+		}
 	}
 
 	return items, nil
 }
 
+// Ping checks that the database is reachable
+func (db *Database) Ping(ctx context.Context) error {
+	return db.Pool.Ping(ctx)
+}
+
+// OrderExists reports whether an order with the given UID is stored
+func (db *Database) OrderExists(ctx context.Context, order_uid string) (bool, error) {
+	var exists bool
+	err := db.Pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM orders WHERE order_uid = $1)", order_uid).
+		Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check order existence: %w", err)
+	}
+	return exists, nil
+}
+
+// GetPayment retrieves the payment record for a given order_uid
+func (db *Database) GetPayment(ctx context.Context, order_uid string) (model.Payment, error) {
+	sql := `
+	SELECT transaction, request_id, currency, provider, amount, payment_dt,
+		bank, delivery_cost, goods_total, custom_fee
+	FROM payment WHERE order_uid = $1
+	`
+
+	rows, err := db.reader().Query(ctx, sql, order_uid)
+	if err != nil {
+		return model.Payment{}, fmt.Errorf("failed to query payment: %w", err)
+	}
+
+	payment, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[model.Payment])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Payment{}, model.ErrPaymentNotFound
+	}
+	if err != nil {
+		return model.Payment{}, fmt.Errorf("failed to scan payment row: %w", err)
+	}
+
+	return payment, nil
+}
+
 // DeleteOrder removes an order
-func (db *Database) DeleteOrder(order_uid string) error {
+func (db *Database) DeleteOrder(ctx context.Context, order_uid string) error {
 	sql := `DELETE FROM orders WHERE order_uid = $1`
 
 	commandTag, err := db.Pool.Exec(ctx, sql, order_uid)
@@ -167,78 +490,303 @@ func (db *Database) DeleteOrder(order_uid string) error {
 	}
 
 	if commandTag.RowsAffected() == 0 {
-		return fmt.Errorf("no task found with id %v", order_uid)
+		return model.ErrOrderNotFound
 	}
 
-	fmt.Println("Successfully deleted!")
-
 	return nil
 }
 
-// GetAllOrders loads all orders from the database
-func (db *Database) GetAllOrders() (map[string]model.Order, error) {
-	sql := `
-		SELECT 
-			o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
-			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
-			d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
-			p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
-			p.bank, p.delivery_cost, p.goods_total, p.custom_fee
-		FROM orders o
-		LEFT JOIN delivery d ON o.order_uid = d.order_uid
-		LEFT JOIN payment p ON o.order_uid = p.order_uid
-	`
+// DeleteByCustomer deletes all orders of a customer, with their delivery,
+// payment, items and audit entries, in one statement, which is atomic on its
+// own. It returns the UIDs of the deleted orders rather than just their
+// count, which is len of them: the database has no access to the cache, so
+// callers evict the orders themselves
+func (db *Database) DeleteByCustomer(ctx context.Context, customerID string) ([]string, error) {
+	rows, err := db.Pool.Query(ctx, "DELETE FROM orders WHERE customer_id = $1 RETURNING order_uid", customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete orders of customer: %w", err)
+	}
 
-	rows, err := db.Pool.Query(ctx, sql)
+	uids, err := pgx.CollectRows(rows, pgx.RowTo[string])
 	if err != nil {
-		return nil, fmt.Errorf("failed to query all orders: %w", err)
+		return nil, fmt.Errorf("failed to delete orders of customer: %w", err)
 	}
-	defer rows.Close()
+	return uids, nil
+}
 
-	orders := make(map[string]model.Order)
+// orderItems loads the items of an order; it is shared by all paths that
+// return full orders so they populate items the same way
+func (db *Database) orderItems(ctx context.Context, order_uid string) ([]model.Item, error) {
+	items, err := db.itemsForOrders(ctx, []string{order_uid})
+	if err != nil {
+		return nil, err
+	}
+	return items[order_uid], nil
+}
 
-	for rows.Next() {
-		var order model.Order
-		var delivery model.Delivery
-		var payment model.Payment
-
-		err := rows.Scan(
-			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
-			&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard,
-			&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City, &delivery.Address, &delivery.Region, &delivery.Email,
-			&payment.Transaction, &payment.RequestID, &payment.Currency, &payment.Provider, &payment.Amount, &payment.PaymentDt,
-			&payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan order row: %w", err)
-		}
+// GetOrder loads a single order with its delivery, payment and items
+func (db *Database) GetOrder(ctx context.Context, order_uid string) (model.Order, error) {
+	rows, err := db.reader().Query(ctx, orderSelect+" WHERE o.order_uid = $1", order_uid)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to query order: %w", err)
+	}
 
-		items, err := db.ItemsInfo(order.OrderUID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load items for order %s: %w", order.OrderUID, err)
-		}
+	order, err := pgx.CollectOneRow(rows, scanOrder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Order{}, model.ErrOrderNotFound
+	}
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to scan order row: %w", err)
+	}
 
-		order.Delivery = delivery
-		order.Payment = payment
-		order.Items = make([]model.Item, 0, len(items))
-		for _, item := range items {
-			order.Items = append(order.Items, model.Item{
-				TrackNumber: item.TrackNumber,
-				Name:        item.Name,
-				Price:       item.Price,
-				Sale:        item.Sale,
-				Size:        item.Size,
-				TotalPrice:  item.TotalPrice,
-				Brand:       item.Brand,
-			})
-		}
+	order.Items, err = db.orderItems(ctx, order.OrderUID)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to load items for order %s: %w", order.OrderUID, err)
+	}
 
+	return order, nil
+}
+
+// GetOrders loads the orders with the given UIDs in a single query; UIDs
+// without an order are left out of the result
+func (db *Database) GetOrders(ctx context.Context, uids []string) ([]model.Order, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	rows, err := db.reader().Query(ctx, orderSelect+" WHERE o.order_uid = ANY($1)", uids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
+	}
+	return db.collectOrders(ctx, rows)
+}
+
+// GetAllOrders loads all orders from the database
+func (db *Database) GetAllOrders(ctx context.Context) (map[string]model.Order, error) {
+	orders := make(map[string]model.Order)
+	err := db.StreamAllOrders(ctx, func(order model.Order) error {
 		orders[order.OrderUID] = order
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// StreamAllOrders calls fn for every order, loading them page by page so
+// callers don't need the whole table in memory; an error from fn stops the
+// stream. Pages hold ItemBatchSize orders, so each costs two queries. With
+// LoadWorkers above 1 pages are loaded concurrently and may reach fn out of
+// order, but fn is never called concurrently.
+//
+// The workers load pages rather than the items of single orders: a page
+// already loads the items of all its orders with one query, so per-order
+// workers would bring back a query per order and only spread it over
+// connections
+func (db *Database) StreamAllOrders(ctx context.Context, fn func(model.Order) error) error {
+	return streamPages(ctx, db.itemBatchSize(), db.LoadWorkers, db.GetOrdersPage, fn)
+}
+
+// streamPages calls fn for every order of the pages load returns, with up to
+// workers pages loading at once, until a page comes back short
+func streamPages(ctx context.Context, pageSize, workers int,
+	load func(ctx context.Context, limit, offset int) ([]model.Order, error), fn func(model.Order) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		next atomic.Int64 // offset of the next page to load
+		done atomic.Bool  // set once the last page has been loaded
+		mu   sync.Mutex   // serializes fn
+	)
+	g, ctx := errgroup.WithContext(ctx)
+	for range workers {
+		g.Go(func() error {
+			for !done.Load() {
+				offset := int(next.Add(int64(pageSize))) - pageSize
+				orders, err := load(ctx, pageSize, offset)
+				if err != nil {
+					return err
+				}
+				if len(orders) < pageSize {
+					done.Store(true)
+				}
+
+				mu.Lock()
+				for _, order := range orders {
+					if err := fn(order); err != nil {
+						mu.Unlock()
+						return err
+					}
+				}
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// GetOrdersPage returns up to limit orders in creation order, skipping the
+// first offset; the items of the whole page are loaded with a single query
+func (db *Database) GetOrdersPage(ctx context.Context, limit, offset int) ([]model.Order, error) {
+	rows, err := db.reader().Query(ctx, orderSelect+" ORDER BY o.date_created, o.order_uid LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders page: %w", err)
+	}
+	return db.collectOrders(ctx, rows)
+}
+
+// GetOrderByTransaction loads the order paid by the given payment transaction
+func (db *Database) GetOrderByTransaction(ctx context.Context, txn string) (model.Order, error) {
+	rows, err := db.reader().Query(ctx, orderSelect+" WHERE p.transaction = $1", txn)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to query order by transaction: %w", err)
+	}
+
+	order, err := pgx.CollectOneRow(rows, scanOrder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Order{}, model.ErrOrderNotFound
+	}
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to scan order row: %w", err)
+	}
+
+	order.Items, err = db.orderItems(ctx, order.OrderUID)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to load items for order %s: %w", order.OrderUID, err)
+	}
+
+	return order, nil
+}
+
+// OrderFilter narrows down ListOrders; zero-valued fields are ignored
+type OrderFilter struct {
+	Since           time.Time // only orders created at or after this time
+	CustomerID      string
+	DeliveryService string
+}
+
+// where builds the WHERE clause and its positional arguments
+func (f OrderFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	if !f.Since.IsZero() {
+		args = append(args, f.Since)
+		conds = append(conds, fmt.Sprintf("o.date_created >= $%d", len(args)))
+	}
+	if f.CustomerID != "" {
+		args = append(args, f.CustomerID)
+		conds = append(conds, fmt.Sprintf("o.customer_id = $%d", len(args)))
+	}
+	if f.DeliveryService != "" {
+		args = append(args, f.DeliveryService)
+		conds = append(conds, fmt.Sprintf("o.delivery_service = $%d", len(args)))
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ListOrders returns up to limit orders matching the filter, newest first,
+// skipping the first offset
+func (db *Database) ListOrders(ctx context.Context, filter OrderFilter, limit, offset int) ([]model.Order, error) {
+	where, args := filter.where()
+	args = append(args, limit, offset)
+	sql := orderSelect + where +
+		fmt.Sprintf(" ORDER BY o.date_created DESC, o.order_uid LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.reader().Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
+	}
+	return db.collectOrders(ctx, rows)
+}
+
+// CountOrders returns the number of orders matching the filter
+func (db *Database) CountOrders(ctx context.Context, filter OrderFilter) (int, error) {
+	where, args := filter.where()
+	var total int
+	if err := db.reader().QueryRow(ctx, "SELECT count(*) FROM orders o"+where, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to count orders: %w", err)
+	}
+	return total, nil
+}
+
+// SearchOrders returns up to limit orders, newest first, whose UID starts with
+// q or whose track number or customer id equals q. The lookups rely on the
+// indexes created by migrations/004_search_indexes.sql
+func (db *Database) SearchOrders(ctx context.Context, q string, limit int) ([]model.Order, error) {
+	sql := orderSelect + `
+	WHERE o.order_uid LIKE $1 || '%' ESCAPE '\'
+		OR o.track_number = $2
+		OR o.customer_id = $2
+	ORDER BY o.date_created DESC LIMIT $3`
+
+	rows, err := db.reader().Query(ctx, sql, escapeLike(q), q, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search orders: %w", err)
 	}
+	return db.collectOrders(ctx, rows)
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// collectOrders scans order rows and loads the items of all of them in batches
+func (db *Database) collectOrders(ctx context.Context, rows pgx.Rows) ([]model.Order, error) {
+	defer rows.Close()
 
+	orders := make([]model.Order, 0)
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order row: %w", err)
+		}
+		orders = append(orders, order)
+	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
 
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+	}
+	items, err := db.itemsForOrders(ctx, uids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		orders[i].Items = items[orders[i].OrderUID]
+	}
+
 	return orders, nil
-}
\ No newline at end of file
+}
+
+// ShardStats counts orders per shardkey and oof_shard to surface distribution skew
+func (db *Database) ShardStats(ctx context.Context) ([]model.ShardCount, error) {
+	sql := `
+	SELECT shardkey, oof_shard, COUNT(*) AS orders
+	FROM orders
+	GROUP BY shardkey, oof_shard
+	ORDER BY shardkey, oof_shard
+	`
+
+	rows, err := db.reader().Query(ctx, sql)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shard stats: %w", err)
+	}
+
+	stats, err := pgx.CollectRows(rows, pgx.RowToStructByName[model.ShardCount])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan shard stats: %w", err)
+	}
+	return stats, nil
+}
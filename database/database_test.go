@@ -0,0 +1,475 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOrderFilterWhere(t *testing.T) {
+	since := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		filter    OrderFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{name: "no filter", filter: OrderFilter{}},
+		{name: "since", filter: OrderFilter{Since: since},
+			wantWhere: " WHERE o.date_created >= $1", wantArgs: []interface{}{since}},
+		{name: "since and customer", filter: OrderFilter{Since: since, CustomerID: "test"},
+			wantWhere: " WHERE o.date_created >= $1 AND o.customer_id = $2", wantArgs: []interface{}{since, "test"}},
+		{name: "customer and service", filter: OrderFilter{CustomerID: "test", DeliveryService: "meest"},
+			wantWhere: " WHERE o.customer_id = $1 AND o.delivery_service = $2", wantArgs: []interface{}{"test", "meest"}},
+		{name: "customer", filter: OrderFilter{CustomerID: "test"},
+			wantWhere: " WHERE o.customer_id = $1", wantArgs: []interface{}{"test"}},
+		{name: "service", filter: OrderFilter{DeliveryService: "meest"},
+			wantWhere: " WHERE o.delivery_service = $1", wantArgs: []interface{}{"meest"}},
+		{name: "all", filter: OrderFilter{Since: since, CustomerID: "test' OR '1'='1", DeliveryService: "meest"},
+			wantWhere: " WHERE o.date_created >= $1 AND o.customer_id = $2 AND o.delivery_service = $3",
+			wantArgs:  []interface{}{since, "test' OR '1'='1", "meest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.filter.where()
+			if where != tt.wantWhere {
+				t.Errorf("where = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestStreamAllOrders(t *testing.T) {
+	db := testDatabase(t)
+	const seeded = 7
+	for i := range seeded {
+		order := ordertest.Order(fmt.Sprintf("stream-%d", i))
+		storeTestOrder(t, db, order)
+	}
+
+	tests := []struct {
+		name      string
+		batchSize int
+		workers   int
+	}{
+		{name: "default pages", batchSize: 0, workers: 1},
+		{name: "small pages", batchSize: 2, workers: 1},
+		{name: "concurrent pages", batchSize: 2, workers: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db.ItemBatchSize, db.LoadWorkers = tt.batchSize, tt.workers
+			calls := make(map[string]int)
+			err := db.StreamAllOrders(context.Background(), func(order model.Order) error {
+				calls[order.OrderUID]++
+				if strings.HasPrefix(order.OrderUID, "stream-") && len(order.Items) == 0 {
+					t.Errorf("order %s streamed without items", order.OrderUID)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamAllOrders: %v", err)
+			}
+			for i := range seeded {
+				uid := fmt.Sprintf("stream-%d", i)
+				if calls[uid] != 1 {
+					t.Errorf("callback called %d times for %s, want once", calls[uid], uid)
+				}
+			}
+		})
+	}
+
+	t.Run("callback error stops the stream", func(t *testing.T) {
+		db.ItemBatchSize, db.LoadWorkers = 2, 1
+		stop := errors.New("stop")
+		calls := 0
+		err := db.StreamAllOrders(context.Background(), func(model.Order) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) {
+			t.Errorf("StreamAllOrders error = %v, want %v", err, stop)
+		}
+		if calls != 1 {
+			t.Errorf("callback called %d times after failing, want once", calls)
+		}
+	})
+}
+
+// pageLoader serves pages of orders like GetOrdersPage, each after delay
+// as if loaded from the DB
+func pageLoader(orders []model.Order, delay time.Duration) func(context.Context, int, int) ([]model.Order, error) {
+	return func(ctx context.Context, limit, offset int) ([]model.Order, error) {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if offset >= len(orders) {
+			return nil, nil
+		}
+		return orders[offset:min(offset+limit, len(orders))], nil
+	}
+}
+
+// seedOrders returns n distinct orders
+func seedOrders(n int) []model.Order {
+	orders := make([]model.Order, n)
+	for i := range orders {
+		orders[i] = ordertest.Order(fmt.Sprintf("page-worker-%d", i))
+	}
+	return orders
+}
+
+// TestStreamPagesConcurrent checks the concurrent warm-up delivers every
+// order once without calling fn concurrently; run it with -race, as the
+// callback writes to a map without locking, like the cache warm-up relies on
+func TestStreamPagesConcurrent(t *testing.T) {
+	orders := seedOrders(103)
+	for _, workers := range []int{0, 1, 4, 16} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			calls := make(map[string]int)
+			var running atomic.Int32
+			err := streamPages(context.Background(), 10, workers, pageLoader(orders, time.Millisecond), func(order model.Order) error {
+				if running.Add(1) > 1 {
+					t.Error("fn called concurrently")
+				}
+				defer running.Add(-1)
+				calls[order.OrderUID]++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("streamPages: %v", err)
+			}
+			if len(calls) != len(orders) {
+				t.Errorf("streamed %d orders, want %d", len(calls), len(orders))
+			}
+			for uid, n := range calls {
+				if n != 1 {
+					t.Errorf("callback called %d times for %s, want once", n, uid)
+				}
+			}
+		})
+	}
+
+	t.Run("load error stops the stream", func(t *testing.T) {
+		broken := errors.New("connection reset")
+		load := func(_ context.Context, limit, offset int) ([]model.Order, error) {
+			if offset >= 50 {
+				return nil, broken
+			}
+			return pageLoader(orders, 0)(context.Background(), limit, offset)
+		}
+		err := streamPages(context.Background(), 10, 4, load, func(model.Order) error { return nil })
+		if !errors.Is(err, broken) {
+			t.Errorf("streamPages error = %v, want %v", err, broken)
+		}
+	})
+}
+
+// BenchmarkWarmUp streams 1000 orders in pages of 100 that each take 5ms to
+// load, showing how the warm-up time drops with concurrent page workers
+func BenchmarkWarmUp(b *testing.B) {
+	orders := seedOrders(1000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("%d workers", workers), func(b *testing.B) {
+			load := pageLoader(orders, 5*time.Millisecond)
+			for b.Loop() {
+				cached := make(map[string]model.Order, len(orders))
+				err := streamPages(context.Background(), 100, workers, load, func(order model.Order) error {
+					cached[order.OrderUID] = order
+					return nil
+				})
+				if err != nil {
+					b.Fatalf("streamPages: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestShardStats(t *testing.T) {
+	db := testDatabase(t)
+
+	// Shard keys no other data uses, so the counts are exact
+	seed := []struct{ shardkey, oofShard string }{
+		{"test-shard-a", "1"}, {"test-shard-a", "1"}, {"test-shard-a", "2"},
+		{"test-shard-b", "1"},
+		{"test-shard-c", "3"}, {"test-shard-c", "3"}, {"test-shard-c", "3"},
+	}
+	for i, s := range seed {
+		order := ordertest.Order(fmt.Sprintf("shard-%d", i))
+		order.Shardkey, order.OofShard = s.shardkey, s.oofShard
+		storeTestOrder(t, db, order)
+	}
+
+	stats, err := db.ShardStats(context.Background())
+	if err != nil {
+		t.Fatalf("ShardStats: %v", err)
+	}
+	got := make(map[[2]string]int)
+	for _, s := range stats {
+		if strings.HasPrefix(s.Shardkey, "test-shard-") {
+			got[[2]string{s.Shardkey, s.OofShard}] = s.Orders
+		}
+	}
+
+	tests := []struct {
+		shardkey, oofShard string
+		want               int
+	}{
+		{"test-shard-a", "1", 2},
+		{"test-shard-a", "2", 1},
+		{"test-shard-b", "1", 1},
+		{"test-shard-c", "3", 3},
+	}
+	for _, tt := range tests {
+		if n := got[[2]string{tt.shardkey, tt.oofShard}]; n != tt.want {
+			t.Errorf("orders in %s/%s = %d, want %d", tt.shardkey, tt.oofShard, n, tt.want)
+		}
+	}
+	if len(got) != len(tests) {
+		t.Errorf("got %d groups for the seeded shard keys, want %d: %v", len(got), len(tests), got)
+	}
+}
+
+// warnRecorder is a slog.Handler keeping the messages logged at warning level
+type warnRecorder struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (w *warnRecorder) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn
+}
+func (w *warnRecorder) WithAttrs([]slog.Attr) slog.Handler { return w }
+func (w *warnRecorder) WithGroup(string) slog.Handler      { return w }
+
+func (w *warnRecorder) Handle(_ context.Context, r slog.Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, r.Message)
+	return nil
+}
+
+// makeOrderObservations returns the number of MakeOrder durations observed
+func makeOrderObservations(t *testing.T) uint64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "orders_make_order_duration_seconds" {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestObserveMakeOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		elapsed   time.Duration
+		wantWarn  bool
+	}{
+		{name: "fast", threshold: time.Second, elapsed: 10 * time.Millisecond},
+		{name: "slow", threshold: 100 * time.Millisecond, elapsed: 2 * time.Second, wantWarn: true},
+		{name: "warning disabled", elapsed: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &warnRecorder{}
+			prev := slog.Default()
+			slog.SetDefault(slog.New(rec))
+			t.Cleanup(func() { slog.SetDefault(prev) })
+			db := &Database{SlowTransaction: tt.threshold}
+			before := makeOrderObservations(t)
+
+			// A transaction that started elapsed ago stands in for a slow DB
+			db.observeMakeOrder(ordertest.Order("slow-make-order"), time.Now().Add(-tt.elapsed))
+
+			if got := makeOrderObservations(t) - before; got != 1 {
+				t.Errorf("observed %d durations, want 1", got)
+			}
+			warned := len(rec.messages) == 1 && rec.messages[0] == "Slow MakeOrder transaction"
+			if warned != tt.wantWarn || (!tt.wantWarn && len(rec.messages) > 0) {
+				t.Errorf("warnings = %q, want slow transaction warning %v", rec.messages, tt.wantWarn)
+			}
+		})
+	}
+}
+
+// queryCount is a pgx tracer counting queries
+type queryCount struct{ n atomic.Int64 }
+
+func (q *queryCount) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	q.n.Add(1)
+	return ctx
+}
+
+func (q *queryCount) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+func TestGetOrdersPageQueries(t *testing.T) {
+	seed := testDatabase(t)
+	var total int
+	if err := seed.Pool.QueryRow(context.Background(), "SELECT count(*) FROM orders").Scan(&total); err != nil {
+		t.Fatalf("counting orders: %v", err)
+	}
+	for i := range 12 {
+		storeTestOrder(t, seed, ordertest.Order(fmt.Sprintf("page-%02d", i)))
+	}
+	total += 12
+
+	tests := []struct {
+		name  string
+		limit int
+	}{
+		{name: "one order per page", limit: 1},
+		{name: "small pages", limit: 5},
+		{name: "single page", limit: total + 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := &queryCount{}
+			db := tracedDatabase(t, queries)
+
+			seen := make(map[string]bool)
+			for offset := 0; offset < total; offset += tt.limit {
+				before := queries.n.Load()
+				page, err := db.GetOrdersPage(context.Background(), tt.limit, offset)
+				if err != nil {
+					t.Fatalf("GetOrdersPage(%d, %d): %v", tt.limit, offset, err)
+				}
+				if n := queries.n.Load() - before; n != 2 {
+					t.Fatalf("page at offset %d with %d orders took %d queries, want 2", offset, len(page), n)
+				}
+				for _, order := range page {
+					if seen[order.OrderUID] {
+						t.Errorf("order %s returned on two pages", order.OrderUID)
+					}
+					seen[order.OrderUID] = true
+					if strings.HasPrefix(order.OrderUID, "page-") && len(order.Items) == 0 {
+						t.Errorf("order %s returned without items", order.OrderUID)
+					}
+				}
+			}
+			if len(seen) != total {
+				t.Errorf("pages returned %d orders, want %d", len(seen), total)
+			}
+		})
+	}
+}
+
+func TestMakeOrderPartial(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name       string
+		noDelivery bool
+		noPayment  bool
+	}{
+		{name: "complete"},
+		{name: "missing delivery", noDelivery: true},
+		{name: "missing payment", noPayment: true},
+		{name: "missing both", noDelivery: true, noPayment: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("make-partial-" + strings.ReplaceAll(tt.name, " ", "-"))
+			if tt.noDelivery {
+				order.Delivery = model.Delivery{}
+			}
+			if tt.noPayment {
+				order.Payment = model.Payment{}
+			}
+			storeTestOrder(t, db, order)
+
+			for table, missing := range map[string]bool{"delivery": tt.noDelivery, "payment": tt.noPayment} {
+				var rows int
+				err := db.Pool.QueryRow(context.Background(),
+					"SELECT count(*) FROM "+table+" WHERE order_uid = $1", order.OrderUID).Scan(&rows)
+				if err != nil {
+					t.Fatalf("counting %s rows: %v", table, err)
+				}
+				want := 1
+				if missing {
+					want = 0
+				}
+				if rows != want {
+					t.Errorf("%d %s rows stored, want %d", rows, table, want)
+				}
+			}
+			got, err := db.GetOrder(context.Background(), order.OrderUID)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if diffs := got.Diff(order); len(diffs) > 0 {
+				t.Errorf("stored order differs in %v", diffs)
+			}
+		})
+	}
+}
+
+// BenchmarkInsertItems compares inserting the items of a 100-item order one
+// Exec at a time with the batch insertItems sends
+func BenchmarkInsertItems(b *testing.B) {
+	db := testDatabase(b)
+	order := ordertest.Order("bench-insert-items")
+	storeTestOrder(b, db, order)
+	item := order.Items[0]
+	order.Items = make([]model.Item, 100)
+	for i := range order.Items {
+		order.Items[i] = item
+		order.Items[i].ChrtID = i
+	}
+
+	perItem := func(ctx context.Context, tx pgx.Tx, order model.Order) error {
+		for _, item := range order.Items {
+			if _, err := tx.Exec(ctx, insertItem, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name,
+				item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status, order.OrderUID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, bb := range []struct {
+		name   string
+		insert func(context.Context, pgx.Tx, model.Order) error
+	}{
+		{name: "per-item exec", insert: perItem},
+		{name: "batch", insert: insertItems},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			ctx := context.Background()
+			for b.Loop() {
+				tx, err := db.Pool.Begin(ctx)
+				if err != nil {
+					b.Fatalf("Begin: %v", err)
+				}
+				// Rolling back leaves the stored order as it was for the next round
+				err = bb.insert(ctx, tx, order)
+				_ = tx.Rollback(ctx)
+				if err != nil {
+					b.Fatalf("inserting items: %v", err)
+				}
+			}
+		})
+	}
+}
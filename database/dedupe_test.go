@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"sync"
+	"testing"
+)
+
+func TestMakeOrderConcurrentDuplicates(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name        string
+		stored      bool
+		goroutines  int
+		wantInserts int
+	}{
+		{name: "single", goroutines: 1, wantInserts: 1},
+		{name: "concurrent", goroutines: 10, wantInserts: 1},
+		{name: "already stored", stored: true, goroutines: 10, wantInserts: 0},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			order := ordertest.Order(fmt.Sprintf("dedupe-%d", i))
+			if tt.stored {
+				storeTestOrder(t, db, order)
+			} else {
+				_ = db.DeleteOrder(ctx, order.OrderUID)
+				t.Cleanup(func() { _ = db.DeleteOrder(context.Background(), order.OrderUID) })
+			}
+
+			errs := make(chan error, tt.goroutines)
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			for range tt.goroutines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					errs <- db.MakeOrder(ctx, order)
+				}()
+			}
+			close(start)
+			wg.Wait()
+			close(errs)
+
+			inserts := 0
+			for err := range errs {
+				switch {
+				case err == nil:
+					inserts++
+				case !errors.Is(err, model.ErrOrderExists):
+					t.Errorf("MakeOrder: %v, want nil or ErrOrderExists", err)
+				}
+			}
+			if inserts != tt.wantInserts {
+				t.Errorf("%d inserts succeeded, want %d", inserts, tt.wantInserts)
+			}
+			items, err := db.Items(ctx, order.OrderUID, nil)
+			if err != nil {
+				t.Fatalf("Items: %v", err)
+			}
+			if len(items) != len(order.Items) {
+				t.Errorf("stored %d items, want %d", len(items), len(order.Items))
+			}
+		})
+	}
+}
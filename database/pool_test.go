@@ -0,0 +1,51 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestPoolOptionsApply(t *testing.T) {
+	tests := []struct {
+		name string
+		opts PoolOptions
+		want PoolOptions // the resulting pool config, in the same terms
+	}{
+		{
+			name: "unset keeps the URL's settings",
+			want: PoolOptions{MaxConns: 8, MinConns: 2, MaxConnLifetime: 20 * time.Minute, MaxConnIdleTime: 5 * time.Minute},
+		},
+		{
+			name: "configured",
+			opts: PoolOptions{MaxConns: 25, MinConns: 5, MaxConnLifetime: time.Hour, MaxConnIdleTime: 30 * time.Minute},
+			want: PoolOptions{MaxConns: 25, MinConns: 5, MaxConnLifetime: time.Hour, MaxConnIdleTime: 30 * time.Minute},
+		},
+		{
+			name: "min above max",
+			opts: PoolOptions{MaxConns: 4, MinConns: 6},
+			want: PoolOptions{MaxConns: 4, MinConns: 4, MaxConnLifetime: 20 * time.Minute, MaxConnIdleTime: 5 * time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := pgxpool.ParseConfig("postgres://localhost/orders?pool_max_conns=8&pool_min_conns=2" +
+				"&pool_max_conn_lifetime=20m&pool_max_conn_idle_time=5m")
+			if err != nil {
+				t.Fatalf("ParseConfig: %v", err)
+			}
+
+			tt.opts.apply(cfg)
+			got := PoolOptions{
+				MaxConns:        int(cfg.MaxConns),
+				MinConns:        int(cfg.MinConns),
+				MaxConnLifetime: cfg.MaxConnLifetime,
+				MaxConnIdleTime: cfg.MaxConnIdleTime,
+			}
+			if got != tt.want {
+				t.Errorf("pool config = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IsTransient reports whether err is likely to succeed on retry: connection
+// failures and SQLSTATEs for serialization failures, deadlocks, shutdowns and
+// resource exhaustion. Not-found and constraint errors are permanent
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code[:2] {
+		case "08", // connection exception
+			"53", // insufficient resources
+			"57": // operator intervention (e.g. admin shutdown)
+			return true
+		}
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01": // deadlock_detected
+			return true
+		}
+		return false
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) || pgconn.SafeToRetry(err)
+}
+
+// IsPermanent reports whether the database rejected the data itself (data
+// exceptions and integrity constraint violations), so writing the same data
+// again can never succeed
+func IsPermanent(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code[:2] {
+	case "22", // data exception
+		"23": // integrity constraint violation
+		return true
+	}
+	return false
+}
+
+// Retry calls fn up to attempts times while it fails with a transient error,
+// doubling the delay from base between attempts; it gives up early when ctx
+// is done and returns the last error
+func Retry(ctx context.Context, attempts int, base time.Duration, fn func() error) error {
+	delay := base
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !IsTransient(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"orders-service/model"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// orderSelect selects orders joined with their delivery and payment rows;
+// columns are aliased to orderRow's db tags so scanning goes by name
+const orderSelect = `
+	SELECT 
+		o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+		o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+		o.status,
+		d.name AS delivery_name, d.phone AS delivery_phone, d.zip AS delivery_zip,
+		d.city AS delivery_city, d.address AS delivery_address, d.region AS delivery_region,
+		d.email AS delivery_email,
+		p.transaction AS payment_transaction, p.request_id AS payment_request_id,
+		p.currency AS payment_currency, p.provider AS payment_provider, p.amount AS payment_amount,
+		p.payment_dt AS payment_payment_dt, p.bank AS payment_bank,
+		p.delivery_cost AS payment_delivery_cost, p.goods_total AS payment_goods_total,
+		p.custom_fee AS payment_custom_fee
+	FROM orders o
+	LEFT JOIN delivery d ON o.order_uid = d.order_uid
+	LEFT JOIN payment p ON o.order_uid = p.order_uid
+`
+
+// orderRow is a row produced by orderSelect; delivery and payment columns
+// are pointers because the LEFT JOINs yield NULLs for orders missing them
+type orderRow struct {
+	OrderUID          string    `db:"order_uid"`
+	TrackNumber       string    `db:"track_number"`
+	Entry             string    `db:"entry"`
+	Locale            string    `db:"locale"`
+	InternalSignature string    `db:"internal_signature"`
+	CustomerID        string    `db:"customer_id"`
+	DeliveryService   string    `db:"delivery_service"`
+	Shardkey          string    `db:"shardkey"`
+	SmID              int       `db:"sm_id"`
+	DateCreated       time.Time `db:"date_created"`
+	OofShard          string    `db:"oof_shard"`
+	Status            string    `db:"status"`
+
+	DeliveryName    *string `db:"delivery_name"`
+	DeliveryPhone   *string `db:"delivery_phone"`
+	DeliveryZip     *string `db:"delivery_zip"`
+	DeliveryCity    *string `db:"delivery_city"`
+	DeliveryAddress *string `db:"delivery_address"`
+	DeliveryRegion  *string `db:"delivery_region"`
+	DeliveryEmail   *string `db:"delivery_email"`
+
+	PaymentTransaction  *string `db:"payment_transaction"`
+	PaymentRequestID    *string `db:"payment_request_id"`
+	PaymentCurrency     *string `db:"payment_currency"`
+	PaymentProvider     *string `db:"payment_provider"`
+	PaymentAmount       *int    `db:"payment_amount"`
+	PaymentDt           *int    `db:"payment_payment_dt"`
+	PaymentBank         *string `db:"payment_bank"`
+	PaymentDeliveryCost *int    `db:"payment_delivery_cost"`
+	PaymentGoodsTotal   *int    `db:"payment_goods_total"`
+	PaymentCustomFee    *int    `db:"payment_custom_fee"`
+}
+
+// toModel converts the row into an order without items, mapping NULLs to zero values
+func (r orderRow) toModel() model.Order {
+	return model.Order{
+		OrderUID:          r.OrderUID,
+		TrackNumber:       r.TrackNumber,
+		Entry:             r.Entry,
+		Locale:            r.Locale,
+		InternalSignature: r.InternalSignature,
+		CustomerID:        r.CustomerID,
+		DeliveryService:   r.DeliveryService,
+		Shardkey:          r.Shardkey,
+		SmID:              r.SmID,
+		DateCreated:       r.DateCreated,
+		OofShard:          r.OofShard,
+		Status:            r.Status,
+		Delivery: model.Delivery{
+			Name:    deref(r.DeliveryName),
+			Phone:   deref(r.DeliveryPhone),
+			Zip:     deref(r.DeliveryZip),
+			City:    deref(r.DeliveryCity),
+			Address: deref(r.DeliveryAddress),
+			Region:  deref(r.DeliveryRegion),
+			Email:   deref(r.DeliveryEmail),
+		},
+		Payment: model.Payment{
+			Transaction:  deref(r.PaymentTransaction),
+			RequestID:    deref(r.PaymentRequestID),
+			Currency:     deref(r.PaymentCurrency),
+			Provider:     deref(r.PaymentProvider),
+			Amount:       deref(r.PaymentAmount),
+			PaymentDt:    deref(r.PaymentDt),
+			Bank:         deref(r.PaymentBank),
+			DeliveryCost: deref(r.PaymentDeliveryCost),
+			GoodsTotal:   deref(r.PaymentGoodsTotal),
+			CustomFee:    deref(r.PaymentCustomFee),
+		},
+	}
+}
+
+// scanOrder scans a row produced by orderSelect by column name, without items
+func scanOrder(row pgx.CollectableRow) (model.Order, error) {
+	r, err := pgx.RowToStructByName[orderRow](row)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return r.toModel(), nil
+}
+
+// deref returns the pointed-to value, or the zero value for nil
+func deref[T any](v *T) T {
+	if v == nil {
+		var zero T
+		return zero
+	}
+	return *v
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// testDatabase connects to TEST_DATABASE_URL, a database with the service's
+// schema and migrations applied, skipping the test when it is unset
+func testDatabase(t testing.TB) *Database {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := New(url, PoolOptions{})
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+// storeTestOrder stores order in db, deleting it when the test ends
+func storeTestOrder(t testing.TB, db *Database, order model.Order) {
+	t.Helper()
+	ctx := context.Background()
+	_ = db.DeleteOrder(ctx, order.OrderUID)
+	if err := db.MakeOrder(ctx, order); err != nil {
+		t.Fatalf("storing order %s: %v", order.OrderUID, err)
+	}
+	t.Cleanup(func() { _ = db.DeleteOrder(context.Background(), order.OrderUID) })
+}
+
+// reversedOrderSelect is orderSelect with its columns in reverse order
+func reversedOrderSelect() string {
+	head, rest, _ := strings.Cut(orderSelect, "SELECT")
+	columns, from, _ := strings.Cut(rest, "FROM")
+	list := strings.Split(columns, ",")
+	for i := range list {
+		list[i] = strings.TrimSpace(list[i])
+	}
+	slices.Reverse(list)
+	return head + "SELECT " + strings.Join(list, ", ") + " FROM" + from
+}
+
+func TestOrderRowToModelNulls(t *testing.T) {
+	city, amount := "Haifa", 100
+	tests := []struct {
+		name         string
+		row          orderRow
+		wantDelivery model.Delivery
+		wantPayment  model.Payment
+	}{
+		{name: "no delivery or payment", row: orderRow{OrderUID: "nulls"}},
+		{name: "partial columns", row: orderRow{OrderUID: "partial", DeliveryCity: &city, PaymentAmount: &amount},
+			wantDelivery: model.Delivery{City: city}, wantPayment: model.Payment{Amount: amount}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := tt.row.toModel()
+			if order.OrderUID != tt.row.OrderUID || order.Delivery != tt.wantDelivery || order.Payment != tt.wantPayment {
+				t.Errorf("toModel() = %+v", order)
+			}
+		})
+	}
+}
+
+func TestScanOrderByName(t *testing.T) {
+	db := testDatabase(t)
+
+	full := ordertest.Order("scan-full")
+	partial := ordertest.Order("scan-partial")
+	partial.Delivery = model.Delivery{}
+	partial.Payment = model.Payment{}
+	storeTestOrder(t, db, full)
+	storeTestOrder(t, db, partial)
+
+	tests := []struct {
+		name  string
+		query string
+		want  model.Order
+	}{
+		{name: "declared order", query: orderSelect, want: full},
+		{name: "reversed columns", query: reversedOrderSelect(), want: full},
+		{name: "reversed columns with NULL joins", query: reversedOrderSelect(), want: partial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := db.Pool.Query(context.Background(), tt.query+" WHERE o.order_uid = $1", tt.want.OrderUID)
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			got, err := pgx.CollectOneRow(rows, scanOrder)
+			if err != nil {
+				t.Fatalf("scanOrder: %v", err)
+			}
+			want := tt.want
+			want.Items = nil
+			if diffs := got.Diff(want); len(diffs) > 0 {
+				t.Errorf("scanned order differs in %v", diffs)
+			}
+		})
+	}
+}
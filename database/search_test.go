@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"orders-service/ordertest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "b563feb7", want: "b563feb7"},
+		{in: "100%", want: `100\%`},
+		{in: "a_b", want: `a\_b`},
+		{in: `back\slash`, want: `back\\slash`},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.in); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSearchOrders(t *testing.T) {
+	db := testDatabase(t)
+	created := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, seed := range []struct{ uid, track, customer string }{
+		{"search-abc-1", "SEARCHTRACK1", "search-customer"},
+		{"search-abc-2", "SEARCHTRACK2", "search-customer"},
+		{"search-xyz-1", "SEARCHTRACK3", "search-other"},
+	} {
+		order := ordertest.Order(seed.uid)
+		order.TrackNumber = seed.track
+		order.CustomerID = seed.customer
+		order.DateCreated = created.Add(time.Duration(i) * time.Hour)
+		storeTestOrder(t, db, order)
+	}
+
+	tests := []struct {
+		name  string
+		q     string
+		limit int
+		want  []string // UIDs, newest first
+	}{
+		{name: "UID prefix", q: "search-abc", limit: 10, want: []string{"search-abc-2", "search-abc-1"}},
+		{name: "full UID", q: "search-xyz-1", limit: 10, want: []string{"search-xyz-1"}},
+		{name: "track number", q: "SEARCHTRACK2", limit: 10, want: []string{"search-abc-2"}},
+		{name: "track number prefix", q: "SEARCHTRACK", limit: 10, want: nil},
+		{name: "customer id", q: "search-customer", limit: 10, want: []string{"search-abc-2", "search-abc-1"}},
+		{name: "limit", q: "search-", limit: 2, want: []string{"search-xyz-1", "search-abc-2"}},
+		{name: "wildcards match literally", q: "search_abc", limit: 10, want: nil},
+		{name: "percent matches literally", q: "search%", limit: 10, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders, err := db.SearchOrders(context.Background(), tt.q, tt.limit)
+			if err != nil {
+				t.Fatalf("SearchOrders: %v", err)
+			}
+			var got []string
+			for _, order := range orders {
+				got = append(got, order.OrderUID)
+				if len(order.Items) == 0 {
+					t.Errorf("order %s returned without items", order.OrderUID)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchOrders(%q) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"strings"
+	"testing"
+)
+
+func TestUpdateStatus(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name    string
+		stored  bool
+		steps   []string // statuses moved to in turn; only the last may fail
+		wantErr error
+	}{
+		{name: "to delivered", stored: true, steps: []string{model.StatusPaid, model.StatusShipped, model.StatusDelivered}},
+		{name: "cancel paid", stored: true, steps: []string{model.StatusPaid, model.StatusCancelled}},
+		{name: "skip payment", stored: true, steps: []string{model.StatusShipped}, wantErr: model.ErrInvalidTransition},
+		{name: "back from delivered", stored: true,
+			steps:   []string{model.StatusPaid, model.StatusShipped, model.StatusDelivered, model.StatusCreated},
+			wantErr: model.ErrInvalidTransition},
+		{name: "missing order", steps: []string{model.StatusPaid}, wantErr: model.ErrOrderNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			order := ordertest.Order("status-" + strings.ReplaceAll(tt.name, " ", "-"))
+			if tt.stored {
+				storeTestOrder(t, db, order)
+			} else {
+				_ = db.DeleteOrder(ctx, order.OrderUID)
+			}
+
+			want := order.Status
+			var err error
+			for i, status := range tt.steps {
+				err = db.UpdateStatus(ctx, order.OrderUID, status)
+				if err != nil {
+					if i < len(tt.steps)-1 {
+						t.Fatalf("UpdateStatus to %s: %v", status, err)
+					}
+					break
+				}
+				want = status
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateStatus error = %v, want %v", err, tt.wantErr)
+			}
+			if !tt.stored {
+				return
+			}
+			got, err := db.GetOrder(ctx, order.OrderUID)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if got.Status != want {
+				t.Errorf("stored status = %q, want %q", got.Status, want)
+			}
+		})
+	}
+}
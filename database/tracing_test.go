@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"orders-service/ordertest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMakeOrderSpans(t *testing.T) {
+	db := testDatabase(t)
+	order := ordertest.Order("tracing-make-order")
+	_ = db.DeleteOrder(context.Background(), order.OrderUID)
+	t.Cleanup(func() { _ = db.DeleteOrder(context.Background(), order.OrderUID) })
+
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	if err := db.MakeOrder(context.Background(), order); err != nil {
+		t.Fatalf("MakeOrder: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	var makeOrder *tracetest.SpanStub
+	for i := range spans {
+		if spans[i].Name == "MakeOrder" {
+			makeOrder = &spans[i]
+		}
+	}
+	if makeOrder == nil {
+		t.Fatalf("no MakeOrder span among %d recorded", len(spans))
+	}
+	queries := 0
+	for _, span := range spans {
+		if span.Name == "db.query" && span.Parent.SpanID() == makeOrder.SpanContext.SpanID() {
+			queries++
+		}
+	}
+	if queries == 0 {
+		t.Error("no db.query spans under MakeOrder")
+	}
+}
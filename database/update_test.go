@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"testing"
+)
+
+func TestUpdateOrder(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name    string
+		stored  bool
+		wantErr error
+	}{
+		{name: "existing", stored: true},
+		{name: "missing", wantErr: model.ErrOrderNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			order := ordertest.Order("update-" + tt.name)
+			if tt.stored {
+				storeTestOrder(t, db, order)
+			} else {
+				_ = db.DeleteOrder(ctx, order.OrderUID)
+			}
+
+			updated := ordertest.Order(order.OrderUID)
+			updated.Delivery.City = "Haifa"
+			updated.Payment.Amount = 2000
+			updated.Items[0].Name = "Replaced"
+			updated.Items = append(updated.Items, updated.Items[0])
+			updated.Items[1].RID = "ab4219087a764ae0bsecond"
+			updated.Status = model.StatusShipped
+
+			err := db.UpdateOrder(ctx, updated)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateOrder error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if exists, _ := db.OrderExists(ctx, order.OrderUID); exists {
+					t.Error("updating a missing order stored it")
+				}
+				return
+			}
+
+			got, err := db.GetOrder(ctx, order.OrderUID)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if got.Delivery.City != "Haifa" || got.Payment.Amount != 2000 {
+				t.Errorf("delivery city %q, payment amount %d not updated", got.Delivery.City, got.Payment.Amount)
+			}
+			if len(got.Items) != 2 {
+				t.Errorf("got %d items, want the 2 updated ones", len(got.Items))
+			}
+			for _, item := range got.Items {
+				if item.Name != "Replaced" {
+					t.Errorf("item %s named %q, want it replaced", item.RID, item.Name)
+				}
+			}
+			if got.Status != order.Status {
+				t.Errorf("status = %q, want %q kept", got.Status, order.Status)
+			}
+		})
+	}
+}
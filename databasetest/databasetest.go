@@ -0,0 +1,519 @@
+// Package databasetest provides an in-memory database for testing code that
+// stores and reads orders through *database.Database, without PostgreSQL
+package databasetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"orders-service/database"
+	"orders-service/model"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrUnavailable is the error of a database that cannot be reached; like a
+// refused connection it is transient
+var ErrUnavailable error = &pgconn.PgError{Severity: "FATAL", Code: "08006", Message: "connection failure"}
+
+// DB keeps orders and their audit trail in memory and mirrors the results and
+// errors of the *database.Database methods of the same names. Every method
+// call is counted, and calls can be made to fail or to be slow
+type DB struct {
+	mu     sync.Mutex
+	orders map[string]model.Order
+	audit  []database.AuditEntry
+	lastID int64 // of the newest audit entry
+	calls  map[string]int
+	fail   map[string][]error
+	down   error
+	delay  time.Duration
+}
+
+// New returns a database holding the given orders
+func New(orders ...model.Order) *DB {
+	db := &DB{
+		orders: make(map[string]model.Order),
+		calls:  make(map[string]int),
+		fail:   make(map[string][]error),
+	}
+	db.Store(orders...)
+	return db
+}
+
+// Store saves orders as MakeOrder would, replacing stored orders of the same
+// UID; it is not counted as a call and never fails
+func (db *DB) Store(orders ...model.Order) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, order := range orders {
+		order = clone(order)
+		if order.Status == "" {
+			order.Status = model.StatusCreated
+		}
+		db.orders[order.OrderUID] = order
+	}
+}
+
+// FailNext makes the next calls of method fail with errs, one call per error
+func (db *DB) FailNext(method string, errs ...error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.fail[method] = append(db.fail[method], errs...)
+}
+
+// Down makes every call fail with err; nil brings the database back up
+func (db *DB) Down(err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.down = err
+}
+
+// Delay makes every call take at least d, or until its context is done
+func (db *DB) Delay(d time.Duration) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.delay = d
+}
+
+// Calls returns how many times method has been called
+func (db *DB) Calls(method string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.calls[method]
+}
+
+// call counts a call of method and returns the error it must fail with, if any
+func (db *DB) call(ctx context.Context, method string) error {
+	db.mu.Lock()
+	db.calls[method]++
+	delay, err := db.delay, db.down
+	if errs := db.fail[method]; len(errs) > 0 && err == nil {
+		err, db.fail[method] = errs[0], errs[1:]
+	}
+	db.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", method, ctx.Err())
+		}
+	}
+	return err
+}
+
+// clone copies order so stored orders and the ones handed out don't share items
+func clone(order model.Order) model.Order {
+	if len(order.Items) == 0 {
+		order.Items = nil
+	} else {
+		order.Items = append([]model.Item(nil), order.Items...)
+	}
+	return order
+}
+
+// sorted returns clones of the stored orders accepted by keep, ordered with less
+func (db *DB) sorted(keep func(model.Order) bool, less func(a, b model.Order) bool) []model.Order {
+	orders := make([]model.Order, 0)
+	for _, order := range db.orders {
+		if keep(order) {
+			orders = append(orders, clone(order))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return less(orders[i], orders[j]) })
+	return orders
+}
+
+// newestFirst orders by date_created DESC, order_uid like ListOrders does
+func newestFirst(a, b model.Order) bool {
+	if !a.DateCreated.Equal(b.DateCreated) {
+		return a.DateCreated.After(b.DateCreated)
+	}
+	return a.OrderUID < b.OrderUID
+}
+
+// page returns the part of orders ListOrders would return for limit and offset
+func page(orders []model.Order, limit, offset int) []model.Order {
+	if offset >= len(orders) {
+		return []model.Order{}
+	}
+	orders = orders[offset:]
+	if limit < len(orders) {
+		orders = orders[:limit]
+	}
+	return orders
+}
+
+// recordAudit adds an audit entry; db.mu must be held
+func (db *DB) recordAudit(uid, action string, change any) error {
+	value, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit change: %w", err)
+	}
+	db.lastID++
+	db.audit = append(db.audit, database.AuditEntry{
+		ID:        db.lastID,
+		OrderUID:  uid,
+		Action:    action,
+		Change:    value,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+// deleteOrder removes an order and its audit entries; db.mu must be held
+func (db *DB) deleteOrder(uid string) {
+	delete(db.orders, uid)
+	kept := db.audit[:0]
+	for _, entry := range db.audit {
+		if entry.OrderUID != uid {
+			kept = append(kept, entry)
+		}
+	}
+	db.audit = kept
+}
+
+// MakeOrder stores a new order, created by default; it returns
+// model.ErrOrderExists if an order with its UID is stored
+func (db *DB) MakeOrder(ctx context.Context, order model.Order) error {
+	if err := db.call(ctx, "MakeOrder"); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, found := db.orders[order.OrderUID]; found {
+		return model.ErrOrderExists
+	}
+	order = clone(order)
+	if order.Status == "" {
+		order.Status = model.StatusCreated
+	}
+	db.orders[order.OrderUID] = order
+	return nil
+}
+
+// OrderExists reports whether an order with the given UID is stored
+func (db *DB) OrderExists(ctx context.Context, uid string) (bool, error) {
+	if err := db.call(ctx, "OrderExists"); err != nil {
+		return false, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	_, found := db.orders[uid]
+	return found, nil
+}
+
+// GetOrder returns a stored order or model.ErrOrderNotFound
+func (db *DB) GetOrder(ctx context.Context, uid string) (model.Order, error) {
+	if err := db.call(ctx, "GetOrder"); err != nil {
+		return model.Order{}, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	order, found := db.orders[uid]
+	if !found {
+		return model.Order{}, model.ErrOrderNotFound
+	}
+	return clone(order), nil
+}
+
+// GetOrders returns the stored orders with the given UIDs, leaving out UIDs
+// without an order
+func (db *DB) GetOrders(ctx context.Context, uids []string) ([]model.Order, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	if err := db.call(ctx, "GetOrders"); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	orders := make([]model.Order, 0)
+	seen := make(map[string]bool)
+	for _, uid := range uids {
+		if order, found := db.orders[uid]; found && !seen[uid] {
+			orders = append(orders, clone(order))
+			seen[uid] = true
+		}
+	}
+	return orders, nil
+}
+
+// GetOrderByTransaction returns the order paid by the given payment
+// transaction or model.ErrOrderNotFound
+func (db *DB) GetOrderByTransaction(ctx context.Context, txn string) (model.Order, error) {
+	if err := db.call(ctx, "GetOrderByTransaction"); err != nil {
+		return model.Order{}, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, order := range db.orders {
+		if !order.Payment.IsZero() && order.Payment.Transaction == txn {
+			return clone(order), nil
+		}
+	}
+	return model.Order{}, model.ErrOrderNotFound
+}
+
+// Items returns the items of an order, optionally only those with the given
+// status; it returns model.ErrOrderNotFound if the order doesn't exist
+func (db *DB) Items(ctx context.Context, uid string, status *int) ([]model.Item, error) {
+	if err := db.call(ctx, "Items"); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	order, found := db.orders[uid]
+	if !found {
+		return nil, model.ErrOrderNotFound
+	}
+	items := make([]model.Item, 0)
+	for _, item := range order.Items {
+		if status == nil || item.Status == *status {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// GetPayment returns the payment of an order or model.ErrPaymentNotFound
+func (db *DB) GetPayment(ctx context.Context, uid string) (model.Payment, error) {
+	if err := db.call(ctx, "GetPayment"); err != nil {
+		return model.Payment{}, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	order, found := db.orders[uid]
+	if !found || order.Payment.IsZero() {
+		return model.Payment{}, model.ErrPaymentNotFound
+	}
+	return order.Payment, nil
+}
+
+// matches reports whether order passes filter
+func matches(filter database.OrderFilter, order model.Order) bool {
+	return (filter.Since.IsZero() || !order.DateCreated.Before(filter.Since)) &&
+		(filter.CustomerID == "" || order.CustomerID == filter.CustomerID) &&
+		(filter.DeliveryService == "" || order.DeliveryService == filter.DeliveryService)
+}
+
+// ListOrders returns up to limit orders matching the filter, newest first,
+// skipping the first offset
+func (db *DB) ListOrders(ctx context.Context, filter database.OrderFilter, limit, offset int) ([]model.Order, error) {
+	if err := db.call(ctx, "ListOrders"); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	orders := db.sorted(func(order model.Order) bool { return matches(filter, order) }, newestFirst)
+	return page(orders, limit, offset), nil
+}
+
+// CountOrders returns the number of orders matching the filter
+func (db *DB) CountOrders(ctx context.Context, filter database.OrderFilter) (int, error) {
+	if err := db.call(ctx, "CountOrders"); err != nil {
+		return 0, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	total := 0
+	for _, order := range db.orders {
+		if matches(filter, order) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+// SearchOrders returns up to limit orders, newest first, whose UID starts
+// with q or whose track number or customer id equals q
+func (db *DB) SearchOrders(ctx context.Context, q string, limit int) ([]model.Order, error) {
+	if err := db.call(ctx, "SearchOrders"); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	orders := db.sorted(func(order model.Order) bool {
+		return strings.HasPrefix(order.OrderUID, q) || order.TrackNumber == q || order.CustomerID == q
+	}, newestFirst)
+	return page(orders, limit, 0), nil
+}
+
+// ShardStats counts orders per shardkey and oof_shard
+func (db *DB) ShardStats(ctx context.Context) ([]model.ShardCount, error) {
+	if err := db.call(ctx, "ShardStats"); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	counts := make(map[[2]string]int)
+	for _, order := range db.orders {
+		counts[[2]string{order.Shardkey, order.OofShard}]++
+	}
+	stats := make([]model.ShardCount, 0, len(counts))
+	for shard, n := range counts {
+		stats = append(stats, model.ShardCount{Shardkey: shard[0], OofShard: shard[1], Orders: n})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Shardkey != stats[j].Shardkey {
+			return stats[i].Shardkey < stats[j].Shardkey
+		}
+		return stats[i].OofShard < stats[j].OofShard
+	})
+	return stats, nil
+}
+
+// StreamAllOrders calls fn for every order in creation order; an error from
+// fn stops the stream. fn is called without holding the database's lock
+func (db *DB) StreamAllOrders(ctx context.Context, fn func(model.Order) error) error {
+	if err := db.call(ctx, "StreamAllOrders"); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	orders := db.sorted(func(model.Order) bool { return true }, func(a, b model.Order) bool {
+		if !a.DateCreated.Equal(b.DateCreated) {
+			return a.DateCreated.Before(b.DateCreated)
+		}
+		return a.OrderUID < b.OrderUID
+	})
+	db.mu.Unlock()
+	for _, order := range orders {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateStatus moves an order to a new status and records the transition.
+// It returns model.ErrInvalidTransition if its current status doesn't allow
+// it and model.ErrOrderNotFound if the order doesn't exist
+func (db *DB) UpdateStatus(ctx context.Context, uid, status string) error {
+	if err := db.call(ctx, "UpdateStatus"); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	order, found := db.orders[uid]
+	if !found {
+		return model.ErrOrderNotFound
+	}
+	current := order.Status
+	if !model.CanTransition(current, status) {
+		return fmt.Errorf("%w from %s to %s", model.ErrInvalidTransition, current, status)
+	}
+	order.Status = status
+	db.orders[uid] = order
+	return db.recordAudit(uid, database.AuditStatus, map[string]string{"from": current, "to": status})
+}
+
+// UpdateOrder overwrites a stored order, keeping its status, and records the
+// new order; it returns model.ErrOrderNotFound if the order doesn't exist
+func (db *DB) UpdateOrder(ctx context.Context, order model.Order) error {
+	if err := db.call(ctx, "UpdateOrder"); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	stored, found := db.orders[order.OrderUID]
+	if !found {
+		return model.ErrOrderNotFound
+	}
+	if err := db.recordAudit(order.OrderUID, database.AuditReplace, order); err != nil {
+		return err
+	}
+	order = clone(order)
+	order.Status = stored.Status
+	db.orders[order.OrderUID] = order
+	return nil
+}
+
+// PatchOrder stores the order computed by apply from the stored one, keeping
+// its status, and records patch. An error from apply is returned as is. It
+// returns the patched order or model.ErrOrderNotFound
+func (db *DB) PatchOrder(ctx context.Context, uid string, patch json.RawMessage,
+	apply func(model.Order) (model.Order, error)) (model.Order, error) {
+	if err := db.call(ctx, "PatchOrder"); err != nil {
+		return model.Order{}, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	order, found := db.orders[uid]
+	if !found {
+		return model.Order{}, model.ErrOrderNotFound
+	}
+	patched, err := apply(clone(order))
+	if err != nil {
+		return model.Order{}, err
+	}
+	patched.Status = order.Status
+	if err = db.recordAudit(uid, database.AuditPatch, patch); err != nil {
+		return model.Order{}, err
+	}
+	db.orders[uid] = clone(patched)
+	return patched, nil
+}
+
+// OrderAudit returns the audit trail of an order, oldest entry first
+func (db *DB) OrderAudit(ctx context.Context, uid string) ([]database.AuditEntry, error) {
+	if err := db.call(ctx, "OrderAudit"); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var entries []database.AuditEntry
+	for _, entry := range db.audit {
+		if entry.OrderUID == uid {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// DeleteOrder removes an order with its audit entries; it returns
+// model.ErrOrderNotFound if the order doesn't exist
+func (db *DB) DeleteOrder(ctx context.Context, uid string) error {
+	if err := db.call(ctx, "DeleteOrder"); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, found := db.orders[uid]; !found {
+		return model.ErrOrderNotFound
+	}
+	db.deleteOrder(uid)
+	return nil
+}
+
+// DeleteByCustomer removes all orders of a customer and returns their UIDs
+func (db *DB) DeleteByCustomer(ctx context.Context, customerID string) ([]string, error) {
+	if err := db.call(ctx, "DeleteByCustomer"); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	uids := make([]string, 0)
+	for uid, order := range db.orders {
+		if order.CustomerID == customerID {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Strings(uids)
+	for _, uid := range uids {
+		db.deleteOrder(uid)
+	}
+	return uids, nil
+}
+
+// Ping checks that the database is up
+func (db *DB) Ping(ctx context.Context) error {
+	return db.call(ctx, "Ping")
+}
@@ -0,0 +1,53 @@
+package dlq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrorHeader is the Kafka header carrying the reason a message was dead-lettered
+const ErrorHeader = "error"
+
+// Producer writes unprocessable messages to a dead-letter topic
+type Producer struct {
+	writer *kafka.Writer
+}
+
+// New creates a dead-letter producer for the given brokers and topic;
+// transport carries the TLS and SASL settings and may be nil for plaintext
+func New(brokers []string, topic string, transport kafka.RoundTripper) *Producer {
+	return &Producer{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+			Transport:    transport,
+		},
+	}
+}
+
+// Send publishes the original key and value with the reason in the error header
+func (p *Producer) Send(ctx context.Context, msg kafka.Message, reason string) error {
+	headers := append([]kafka.Header{}, msg.Headers...)
+	headers = append(headers, kafka.Header{Key: ErrorHeader, Value: []byte(reason)})
+
+	err := p.writer.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write to dead-letter topic: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending writes and closes the underlying writer
+func (p *Producer) Close() error {
+	return p.writer.Close()
+}
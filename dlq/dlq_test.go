@@ -0,0 +1,81 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"orders-service/kafkatest"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         kafka.Message
+		reason      string
+		failWith    error
+		wantHeaders []kafka.Header
+	}{
+		{
+			name:        "malformed JSON",
+			msg:         kafka.Message{Key: []byte("b563feb7"), Value: []byte(`{"order_uid":`)},
+			reason:      "failed to unmarshal json: unexpected end of JSON input",
+			wantHeaders: []kafka.Header{{Key: ErrorHeader, Value: []byte("failed to unmarshal json: unexpected end of JSON input")}},
+		},
+		{
+			name: "original headers kept",
+			msg: kafka.Message{Key: []byte("b563feb7"), Value: []byte(`{}`),
+				Headers: []kafka.Header{{Key: "traceparent", Value: []byte("00-abc-def-01")}}},
+			reason: "empty order_uid",
+			wantHeaders: []kafka.Header{
+				{Key: "traceparent", Value: []byte("00-abc-def-01")},
+				{Key: ErrorHeader, Value: []byte("empty order_uid")},
+			},
+		},
+		{
+			name:     "broker failure",
+			msg:      kafka.Message{Key: []byte("b563feb7"), Value: []byte(`{}`)},
+			reason:   "empty order_uid",
+			failWith: errors.New("broker unavailable"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &kafkatest.Transport{}
+			transport.Fail(tt.failWith)
+			p := New([]string{"kafka:9092"}, "orders.dlq", transport)
+			t.Cleanup(func() { p.Close() })
+
+			err := p.Send(context.Background(), tt.msg, tt.reason)
+			if tt.failWith != nil {
+				if err == nil {
+					t.Fatal("Send succeeded, want an error")
+				}
+				if n := len(transport.Messages()); n != 0 {
+					t.Errorf("%d messages produced despite the failure", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			produced := transport.Messages()
+			if len(produced) != 1 {
+				t.Fatalf("produced %d messages, want 1", len(produced))
+			}
+			got := produced[0]
+			if got.Topic != "orders.dlq" {
+				t.Errorf("topic = %q, want orders.dlq", got.Topic)
+			}
+			if string(got.Key) != string(tt.msg.Key) || string(got.Value) != string(tt.msg.Value) {
+				t.Errorf("message = %q: %q, want the original %q: %q", got.Key, got.Value, tt.msg.Key, tt.msg.Value)
+			}
+			if !reflect.DeepEqual(got.Headers, tt.wantHeaders) {
+				t.Errorf("headers = %v, want %v", got.Headers, tt.wantHeaders)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"orders-service/metrics"
+	"orders-service/model"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TypeHeader is the Kafka header carrying the event type
+const TypeHeader = "event-type"
+
+// OrderPersistedType is the type of the event published once an order is stored
+const OrderPersistedType = "order.persisted"
+
+// OrderPersisted is the payload of an order.persisted event
+type OrderPersisted struct {
+	Type      string    `json:"type"`
+	OrderUID  string    `json:"order_uid"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Publisher sends order events to a Kafka topic. Publishing is best effort:
+// writes are asynchronous and failures are only logged and counted, so a
+// broken events topic never holds up order processing
+type Publisher struct {
+	writer *kafka.Writer
+}
+
+// New creates a publisher for the given brokers and topic; transport carries
+// the TLS and SASL settings and may be nil for plaintext
+func New(brokers []string, topic string, transport kafka.RoundTripper) *Publisher {
+	return &Publisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+			Transport:    transport,
+			Async:        true,
+			Completion:   completed,
+		},
+	}
+}
+
+// OrderPersisted publishes an order.persisted event keyed by the order UID,
+// so events of one order stay in the same partition
+func (p *Publisher) OrderPersisted(order model.Order) {
+	value, err := json.Marshal(OrderPersisted{
+		Type:      OrderPersistedType,
+		OrderUID:  order.OrderUID,
+		Status:    order.Status,
+		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		slog.Error("Failed to encode order event", "type", OrderPersistedType, "order_uid", order.OrderUID, "error", err)
+		metrics.OrderEvents.WithLabelValues("failed").Inc()
+		return
+	}
+
+	err = p.writer.WriteMessages(context.Background(), kafka.Message{
+		Key:     []byte(order.OrderUID),
+		Value:   value,
+		Headers: []kafka.Header{{Key: TypeHeader, Value: []byte(OrderPersistedType)}},
+	})
+	if err != nil {
+		slog.Error("Failed to publish order event", "type", OrderPersistedType, "order_uid", order.OrderUID, "error", err)
+		metrics.OrderEvents.WithLabelValues("failed").Inc()
+	}
+}
+
+// completed records the outcome of an asynchronous write
+func completed(messages []kafka.Message, err error) {
+	if err != nil {
+		slog.Error("Failed to publish order events", "count", len(messages), "error", err)
+		metrics.OrderEvents.WithLabelValues("failed").Add(float64(len(messages)))
+		return
+	}
+	metrics.OrderEvents.WithLabelValues("published").Add(float64(len(messages)))
+}
+
+// Close flushes pending events and closes the underlying writer
+func (p *Publisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,89 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"orders-service/kafkatest"
+	"orders-service/metrics"
+	"orders-service/ordertest"
+	"testing"
+	"time"
+)
+
+// eventCount returns the current value of the order events counter for result
+func eventCount(t *testing.T, result string) float64 {
+	t.Helper()
+	values, err := metrics.Snapshot("orders_events_total")
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	return values[`orders_events_total{result="`+result+`"}`]
+}
+
+func TestOrderPersisted(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		failWith error
+	}{
+		{name: "published", status: "new"},
+		{name: "without status"},
+		{name: "broker failure", status: "new", failWith: errors.New("broker unavailable")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &kafkatest.Transport{}
+			transport.Fail(tt.failWith)
+			p := New([]string{"kafka:9092"}, "orders.events", transport)
+			// A failing write is not retried, keeping the test fast
+			p.writer.MaxAttempts = 1
+			order := ordertest.Order("event-persisted")
+			order.Status = tt.status
+			published, failed := eventCount(t, "published"), eventCount(t, "failed")
+
+			start := time.Now()
+			p.OrderPersisted(order)
+			// Close flushes the asynchronous write
+			if err := p.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			produced := transport.Messages()
+			if tt.failWith != nil {
+				if len(produced) != 0 {
+					t.Errorf("%d events produced despite the failure", len(produced))
+				}
+				if got := eventCount(t, "failed") - failed; got != 1 {
+					t.Errorf("failed events rose by %v, want 1", got)
+				}
+				return
+			}
+			if got := eventCount(t, "published") - published; got != 1 {
+				t.Errorf("published events rose by %v, want 1", got)
+			}
+			if len(produced) != 1 {
+				t.Fatalf("produced %d events, want 1", len(produced))
+			}
+			msg := produced[0]
+			if msg.Topic != "orders.events" {
+				t.Errorf("topic = %q, want orders.events", msg.Topic)
+			}
+			if string(msg.Key) != order.OrderUID {
+				t.Errorf("key = %q, want the order UID %q", msg.Key, order.OrderUID)
+			}
+			if len(msg.Headers) != 1 || msg.Headers[0].Key != TypeHeader || string(msg.Headers[0].Value) != OrderPersistedType {
+				t.Errorf("headers = %v, want %s: %s", msg.Headers, TypeHeader, OrderPersistedType)
+			}
+			var event OrderPersisted
+			if err := json.Unmarshal(msg.Value, &event); err != nil {
+				t.Fatalf("decoding the event: %v", err)
+			}
+			if event.Type != OrderPersistedType || event.OrderUID != order.OrderUID || event.Status != order.Status {
+				t.Errorf("event = %+v, want a %s event for %s with status %q", event, OrderPersistedType, order.OrderUID, order.Status)
+			}
+			if event.Timestamp.Before(start.Add(-time.Second)) || event.Timestamp.After(time.Now()) {
+				t.Errorf("event timestamp %v is not the time of publishing", event.Timestamp)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"orders-service/cache"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"strings"
+	"testing"
+)
+
+func TestHandleColdCacheDuplicate(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name          string
+		stored        bool
+		change        func(*model.Order)
+		wantPersisted float64
+		wantReview    int
+	}{
+		{name: "stored duplicate", stored: true, change: func(*model.Order) {}},
+		{name: "stored conflicting duplicate", stored: true, change: func(o *model.Order) { o.Delivery.City = "Haifa" },
+			wantReview: 1},
+		{name: "new order", change: func(*model.Order) {}, wantPersisted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := ordertest.Order("cold-" + strings.ReplaceAll(tt.name, " ", "-"))
+			if tt.stored {
+				if err := db.MakeOrder(context.Background(), stored); err != nil {
+					t.Fatalf("MakeOrder: %v", err)
+				}
+			}
+			// A cold cache, as after losing the cache file
+			c := newTestCache(t, cache.Options{})
+			review, transport := newTestDLQ()
+			h := New(db, c, Options{DetectConflicts: true})
+			h.Review = review
+
+			incoming := ordertest.Order(stored.OrderUID)
+			tt.change(&incoming)
+			writes, _ := histogram(t, "orders_make_order_duration_seconds")
+			persisted := metricDelta(t, "orders_persisted_total", func() {
+				if err := h.HandleOrder(context.Background(), orderMessage(t, incoming)); err != nil {
+					t.Fatalf("HandleOrder: %v", err)
+				}
+			})
+
+			if persisted != tt.wantPersisted {
+				t.Errorf("orders_persisted_total grew by %v, want %v", persisted, tt.wantPersisted)
+			}
+			if after, _ := histogram(t, "orders_make_order_duration_seconds"); tt.stored && after != writes {
+				t.Errorf("duplicate attempted %d inserts, want none", after-writes)
+			}
+			if sent := len(transport.Messages()); sent != tt.wantReview {
+				t.Errorf("routed %d messages for review, want %d", sent, tt.wantReview)
+			}
+			cached, found := c.Peek(stored.OrderUID)
+			if !found {
+				t.Fatal("order not cached after handling")
+			}
+			if cached.Delivery.City != stored.Delivery.City {
+				t.Errorf("cached city = %q, want the stored %q", cached.Delivery.City, stored.Delivery.City)
+			}
+		})
+	}
+}
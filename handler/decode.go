@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"orders-service/metrics"
+	"orders-service/model"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// decodeOrder unmarshals a message into an order, classifying failures so a
+// producer sending the wrong schema can be told apart from garbled bytes
+func decodeOrder(msg kafka.Message) (model.Order, error) {
+	var order model.Order
+	err := json.Unmarshal(msg.Value, &order)
+	if err == nil {
+		return order, nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		metrics.UnmarshalErrors.WithLabelValues("type").Inc()
+		slog.Warn("Message has a schema mismatch", "key", string(msg.Key), "field", typeErr.Field,
+			"json_type", typeErr.Value, "expected", typeErr.Type.String(), "json_offset", typeErr.Offset)
+	case errors.As(err, &syntaxErr):
+		metrics.UnmarshalErrors.WithLabelValues("syntax").Inc()
+		slog.Warn("Message is not valid JSON", "key", string(msg.Key), "json_offset", syntaxErr.Offset, "error", err)
+	default:
+		metrics.UnmarshalErrors.WithLabelValues("other").Inc()
+	}
+	return model.Order{}, fmt.Errorf("failed to unmarshal json: %w", err)
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"orders-service/metrics"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestDecodeOrderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		wantKind string // orders_unmarshal_errors_total label, empty for no error
+		wantLog  string
+		wantErr  interface{}
+	}{
+		{name: "valid", value: `{"order_uid":"decode-ok","track_number":"WBILMTESTTRACK"}`},
+		{
+			name:     "type mismatch",
+			value:    `{"order_uid":"decode-type","sm_id":"ninety-nine"}`,
+			wantKind: "type",
+			wantLog:  "Message has a schema mismatch",
+			wantErr:  new(*json.UnmarshalTypeError),
+		},
+		{
+			name:     "nested type mismatch",
+			value:    `{"order_uid":"decode-nested","items":[{"price":"453"}]}`,
+			wantKind: "type",
+			wantLog:  "Message has a schema mismatch",
+			wantErr:  new(*json.UnmarshalTypeError),
+		},
+		{
+			name:     "syntax error",
+			value:    `{"order_uid":"decode-syntax",`,
+			wantKind: "syntax",
+			wantLog:  "Message is not valid JSON",
+			wantErr:  new(*json.SyntaxError),
+		},
+		{
+			name:     "garbled bytes",
+			value:    "\x00\x01order",
+			wantKind: "syntax",
+			wantLog:  "Message is not valid JSON",
+			wantErr:  new(*json.SyntaxError),
+		},
+		{name: "bad date", value: `{"order_uid":"decode-date","date_created":"yesterday"}`, wantKind: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			msg := kafka.Message{Key: []byte("decode"), Value: []byte(tt.value)}
+
+			before := unmarshalErrors(t)
+			_, err := decodeOrder(msg)
+			after := unmarshalErrors(t)
+
+			if tt.wantKind == "" {
+				if err != nil {
+					t.Fatalf("decodeOrder: %v", err)
+				}
+			} else if err == nil {
+				t.Fatal("decodeOrder succeeded, want an error")
+			}
+			for _, kind := range []string{"type", "syntax", "other"} {
+				want := 0.0
+				if kind == tt.wantKind {
+					want = 1
+				}
+				if got := after[kind] - before[kind]; got != want {
+					t.Errorf("%s errors grew by %v, want %v", kind, got, want)
+				}
+			}
+			if tt.wantErr != nil && !errors.As(err, tt.wantErr) {
+				t.Errorf("error %v is not a %T", err, tt.wantErr)
+			}
+			if tt.wantLog != "" && !logs.Logged(slog.LevelWarn, tt.wantLog) {
+				t.Errorf("%q not logged", tt.wantLog)
+			}
+		})
+	}
+}
+
+// unmarshalErrors returns orders_unmarshal_errors_total by kind
+func unmarshalErrors(t *testing.T) map[string]float64 {
+	t.Helper()
+	values, err := metrics.Snapshot("orders_unmarshal_errors_total")
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	counts := make(map[string]float64)
+	for _, kind := range []string{"type", "syntax", "other"} {
+		counts[kind] = values[fmt.Sprintf("orders_unmarshal_errors_total{kind=%q}", kind)]
+	}
+	return counts
+}
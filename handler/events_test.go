@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"orders-service/cache"
+	"orders-service/events"
+	"orders-service/kafkatest"
+	"orders-service/ordertest"
+	"strings"
+	"testing"
+)
+
+func TestHandleOrderPublishesEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		cached    bool
+		invalid   bool
+		wantEvent bool
+	}{
+		{name: "stored order", wantEvent: true},
+		{name: "cached duplicate", cached: true},
+		{name: "invalid order", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("event-" + strings.ReplaceAll(tt.name, " ", "-"))
+			// Only an order that gets stored needs the DB
+			var db Store
+			if !tt.cached && !tt.invalid {
+				db = testDatabase(t)
+			}
+			if tt.invalid {
+				order.Items = nil
+			}
+			c := newTestCache(t, cache.Options{})
+			if tt.cached {
+				c.Set(order, cache.DefaultTTL)
+			}
+			transport := &kafkatest.Transport{}
+			h := New(db, c, Options{})
+			h.DLQ, _ = newTestDLQ()
+			h.Events = events.New([]string{"kafka:9092"}, "orders.events", transport)
+
+			if err := h.HandleOrder(context.Background(), orderMessage(t, order)); err != nil {
+				t.Fatalf("HandleOrder: %v", err)
+			}
+			// Close flushes the asynchronous event write
+			h.Close(context.Background())
+
+			produced := transport.Messages()
+			if got := len(produced) == 1; got != tt.wantEvent {
+				t.Fatalf("event published = %v, want %v", got, tt.wantEvent)
+			}
+			if !tt.wantEvent {
+				return
+			}
+			if string(produced[0].Key) != order.OrderUID {
+				t.Errorf("event key = %q, want the order UID %q", produced[0].Key, order.OrderUID)
+			}
+			var event events.OrderPersisted
+			if err := json.Unmarshal(produced[0].Value, &event); err != nil {
+				t.Fatalf("decoding the event: %v", err)
+			}
+			if event.Type != events.OrderPersistedType || event.OrderUID != order.OrderUID {
+				t.Errorf("event = %+v, want a %s event for %s", event, events.OrderPersistedType, order.OrderUID)
+			}
+		})
+	}
+}
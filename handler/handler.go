@@ -1,54 +1,372 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"orders-service/cache"
 	"orders-service/database"
+	"orders-service/dlq"
+	"orders-service/events"
+	"orders-service/logging"
+	"orders-service/metrics"
 	"orders-service/model"
+	"orders-service/webhook"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
-// HandleOrder processes an incoming Kafka message with order data
-func HandleOrder(msg kafka.Message, db *database.Database, c *cache.Cache) error {
-    log.Printf("Received message: key=%s, value=%s", string(msg.Key), string(msg.Value))
-    if len(msg.Value) == 0 {
-        log.Printf("Empty message received, skipping")
-        return nil // Commit to avoid re-reading
-    }
-
-    var order model.Order
-    if err := json.Unmarshal(msg.Value, &order); err != nil {
-        return fmt.Errorf("failed to unmarshal json: %w", err)
-    }
-
-    log.Printf("Order parsed: order_uid=%s", order.OrderUID)
-
-    if order.OrderUID == "" {
-        return fmt.Errorf("empty order_uid")
-    }
-
-    // Check for duplicate in cache
-    if _, found := c.Get(order.OrderUID); found {
-        log.Printf("Order %s already exists, skipping", order.OrderUID)
-        return nil // Commit
-    }
-
-    // Save to database
-    if err := db.MakeOrder(order); err != nil {
-        if errors.Is(err, model.ErrOrderExists) {
-            log.Printf("Order %s already exists, skipping", order.OrderUID)
-            return nil
-        }
-        return fmt.Errorf("failed to save order to DB: %w", err)
-    }
-
-    // Cache order
-    c.Set(order, cache.DefaultTTL)
-    log.Printf("Order %s saved and cached", order.OrderUID)
-
-    return nil
-}
\ No newline at end of file
+// Options controls optional message handling behavior
+type Options struct {
+	// EmptyDLQThreshold is the number of empty messages tolerated within
+	// EmptyWindow before further ones are routed to the DLQ; 0 disables routing
+	EmptyDLQThreshold int
+	// EmptyWindow is the period over which empty messages are counted; the
+	// count restarts once it has passed. 0 counts them since startup
+	EmptyWindow time.Duration
+	// DetectConflicts compares a duplicate order against the cached copy
+	// and reports a conflict when their contents differ
+	DetectConflicts bool
+	// ProcessTimeout bounds the handling of a single message; messages that
+	// exceed it are abandoned and routed to the DLQ. 0 disables the deadline
+	ProcessTimeout time.Duration
+	// PartialPolicy handles orders missing delivery or payment; unless it
+	// rejects them they are stored without the missing rows
+	PartialPolicy Policy
+	// PricePolicy handles items with a zero or negative price
+	PricePolicy Policy
+	// DefaultItemSize is assigned to items arriving without a size
+	DefaultItemSize string
+	// SizeRule and SizePolicy validate item sizes; by default any size passes
+	SizeRule   SizeRule
+	SizePolicy Policy
+	// UIDFilter drops orders whose UID is denied or not allowed
+	UIDFilter UIDFilter
+	// WriteAttempts is the number of tries for saving an order failing with
+	// a transient DB error, with exponential backoff from WriteBackoff;
+	// values below 1 mean a single try
+	WriteAttempts int
+	WriteBackoff  time.Duration
+	// Schema, when set, rejects messages not matching it before they are decoded
+	Schema *Schema
+}
+
+// Store is the part of *database.Database the handler uses
+type Store interface {
+	MakeOrder(ctx context.Context, order model.Order) error
+	OrderExists(ctx context.Context, uid string) (bool, error)
+	GetOrder(ctx context.Context, uid string) (model.Order, error)
+}
+
+// Handler processes order messages consumed from Kafka
+type Handler struct {
+	Database Store
+	Cache    *cache.Cache
+
+	// Optional sinks, may be nil
+	DLQ     *dlq.Producer
+	Review  *dlq.Producer // receives conflicting duplicates
+	Webhook *webhook.Notifier
+	Events  *events.Publisher // receives order.persisted events
+
+	opts Options
+
+	emptyMu    sync.Mutex
+	emptyCount int64     // empty messages since emptySince
+	emptySince time.Time // start of the current counting window
+}
+
+// New creates a message handler backed by the database and cache
+func New(db Store, c *cache.Cache, opts Options) *Handler {
+	return &Handler{
+		Database: db,
+		Cache:    c,
+		opts:     opts,
+	}
+}
+
+// Close flushes and closes the handler's optional sinks; pending webhook
+// notifications are delivered until ctx is done
+func (h *Handler) Close(ctx context.Context) {
+	if h.Webhook != nil {
+		if err := h.Webhook.Close(ctx); err != nil {
+			slog.Error("Webhook notifications dropped on shutdown", "error", err)
+		}
+	}
+	if h.DLQ != nil {
+		if err := h.DLQ.Close(); err != nil {
+			slog.Error("Failed to close DLQ producer", "error", err)
+		}
+	}
+	if h.Review != nil {
+		if err := h.Review.Close(); err != nil {
+			slog.Error("Failed to close review producer", "error", err)
+		}
+	}
+	if h.Events != nil {
+		if err := h.Events.Close(); err != nil {
+			slog.Error("Failed to close events publisher", "error", err)
+		}
+	}
+}
+
+// HandleOrder processes an incoming Kafka message with order data; a message
+// that exceeds the processing deadline is dead-lettered and reported as handled
+func (h *Handler) HandleOrder(ctx context.Context, msg kafka.Message) (err error) {
+	metrics.MessagesConsumed.Inc()
+	ctx, span := startSpan(ctx, msg)
+	defer func() { endSpan(span, err) }()
+
+	if h.opts.ProcessTimeout <= 0 {
+		return h.handleOrder(ctx, msg)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.opts.ProcessTimeout)
+	defer cancel()
+
+	err = h.handleOrder(ctx, msg)
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	slog.Warn("Message processing exceeded the deadline",
+		append(logging.Message(msg), "timeout", h.opts.ProcessTimeout, "error", err)...)
+	metrics.ProcessTimeouts.Inc()
+	if h.DLQ == nil {
+		return err
+	}
+	return h.deadLetter(msg, "timeout", "processing timeout: "+err.Error())
+}
+
+// deadLetter routes a message that must not be retried to the DLQ so it can
+// be committed; without a DLQ the message is dropped. An error is returned
+// only if the DLQ write fails, so the consumer retries the message
+func (h *Handler) deadLetter(msg kafka.Message, label, reason string) error {
+	if h.DLQ == nil {
+		slog.Warn("Dropping message, no DLQ configured", append(logging.Message(msg), "reason", reason)...)
+		return nil
+	}
+
+	slog.Warn("Routing message to DLQ", append(logging.Message(msg), "reason", reason)...)
+	if err := h.DLQ.Send(context.Background(), msg, reason); err != nil {
+		return fmt.Errorf("failed to dead-letter message: %w", err)
+	}
+	metrics.DLQMessages.WithLabelValues(label).Inc()
+	return nil
+}
+
+func (h *Handler) handleOrder(ctx context.Context, msg kafka.Message) error {
+	slog.Debug("Received message", append(logging.Message(msg), "value", string(msg.Value))...)
+	observeLag(msg)
+	if len(msg.Value) == 0 {
+		h.handleEmpty(msg)
+		return nil // Commit to avoid re-reading
+	}
+
+	// Malformed messages are permanent failures: retrying them would block
+	// the partition forever
+	if h.opts.Schema != nil {
+		if err := h.opts.Schema.validate(msg.Value); err != nil {
+			metrics.UnmarshalErrors.WithLabelValues("schema").Inc()
+			metrics.OrdersSkipped.WithLabelValues("invalid").Inc()
+			return h.deadLetter(msg, "schema", err.Error())
+		}
+	}
+	order, err := decodeOrder(msg)
+	if err != nil {
+		metrics.OrdersSkipped.WithLabelValues("invalid").Inc()
+		return h.deadLetter(msg, "unmarshal", err.Error())
+	}
+
+	slog.Debug("Order parsed", "order_uid", order.OrderUID)
+
+	if order.OrderUID == "" {
+		metrics.OrdersSkipped.WithLabelValues("invalid").Inc()
+		return h.deadLetter(msg, "empty_uid", "empty order_uid")
+	}
+
+	if !h.opts.UIDFilter.accepts(order.OrderUID) {
+		slog.Info("Order rejected by the UID allow/deny list, skipping", "order_uid", order.OrderUID)
+		metrics.OrdersSkipped.WithLabelValues("filtered").Inc()
+		return nil // Commit
+	}
+
+	if err := h.opts.PartialPolicy.apply(order, checkPartial(order)); err != nil {
+		metrics.OrdersSkipped.WithLabelValues("invalid").Inc()
+		return h.deadLetter(msg, "partial_order", err.Error())
+	}
+	if err := order.ValidatePartial(); err != nil {
+		metrics.OrdersSkipped.WithLabelValues("invalid").Inc()
+		return h.deadLetter(msg, "invalid_order", err.Error())
+	}
+
+	if err := h.opts.PricePolicy.apply(order, checkPrices(order)); err != nil {
+		metrics.OrdersSkipped.WithLabelValues("invalid").Inc()
+		return h.deadLetter(msg, "invalid_price", err.Error())
+	}
+
+	applyDefaultSize(&order, h.opts.DefaultItemSize)
+	if order.Status == "" {
+		order.Status = model.StatusCreated
+	}
+	if err := h.opts.SizePolicy.apply(order, checkSizes(order, h.opts.SizeRule)); err != nil {
+		metrics.OrdersSkipped.WithLabelValues("invalid").Inc()
+		return h.deadLetter(msg, "invalid_size", err.Error())
+	}
+
+	// Check for duplicate in cache
+	if stored, found := h.Cache.Peek(order.OrderUID); found {
+		slog.Info("Order already cached, skipping", "order_uid", order.OrderUID)
+		metrics.OrdersSkipped.WithLabelValues("cache_dup").Inc()
+		h.checkConflict(msg, order, stored)
+		return nil // Commit
+	}
+
+	// A cold cache (e.g. a lost cache file) doesn't know stored orders; check
+	// the DB before attempting the insert and cache what it has
+	if dup, err := h.storedDuplicate(ctx, msg, order); err != nil {
+		return err
+	} else if dup {
+		return nil // Commit
+	}
+
+	// Save to database
+	err = database.Retry(ctx, h.opts.WriteAttempts, h.opts.WriteBackoff, func() error {
+		return h.Database.MakeOrder(ctx, order)
+	})
+	if err != nil {
+		if errors.Is(err, model.ErrOrderExists) {
+			slog.Info("Order already stored, skipping", "order_uid", order.OrderUID)
+			metrics.OrdersSkipped.WithLabelValues("db_dup").Inc()
+			return nil
+		}
+		metrics.DBErrors.WithLabelValues("make_order").Inc()
+		if database.IsPermanent(err) {
+			metrics.OrdersSkipped.WithLabelValues("invalid").Inc()
+			return h.deadLetter(msg, "db_rejected", "order rejected by DB: "+err.Error())
+		}
+		// Connection errors and the like are returned: the consumer retries
+		// the message in place and never commits past it
+		return fmt.Errorf("failed to save order to DB: %w", err)
+	}
+
+	metrics.OrdersPersisted.Inc()
+	metrics.OrderItemCount.Observe(float64(len(order.Items)))
+
+	// Cache order
+	h.Cache.Set(order, cacheTTL(msg))
+	slog.Info("Order saved and cached", append(logging.Message(msg), "order_uid", order.OrderUID)...)
+
+	if h.Webhook != nil {
+		h.Webhook.Notify(order)
+	}
+	if h.Events != nil {
+		h.Events.OrderPersisted(order)
+	}
+
+	return nil
+}
+
+// handleEmpty counts an empty message and dead-letters it once the configured
+// threshold is exceeded within the window, since a burst of them usually
+// means a producer bug
+func (h *Handler) handleEmpty(msg kafka.Message) {
+	metrics.EmptyMessages.Inc()
+	metrics.OrdersSkipped.WithLabelValues("empty").Inc()
+	count := h.countEmpty(time.Now())
+
+	threshold := int64(h.opts.EmptyDLQThreshold)
+	if threshold <= 0 || count <= threshold || h.DLQ == nil {
+		slog.Info("Empty message received, skipping", logging.Message(msg)...)
+		return
+	}
+
+	slog.Warn("Empty message threshold exceeded, routing to DLQ",
+		append(logging.Message(msg), "count", count, "threshold", threshold)...)
+	if err := h.DLQ.Send(context.Background(), msg, "empty message"); err != nil {
+		slog.Error("Failed to dead-letter empty message", append(logging.Message(msg), "error", err)...)
+		return
+	}
+	metrics.DLQMessages.WithLabelValues("empty").Inc()
+}
+
+// countEmpty counts an empty message received at now and returns the number
+// received in the current window, starting a new window when it has passed
+func (h *Handler) countEmpty(now time.Time) int64 {
+	h.emptyMu.Lock()
+	defer h.emptyMu.Unlock()
+
+	if h.emptyCount == 0 || (h.opts.EmptyWindow > 0 && now.Sub(h.emptySince) >= h.opts.EmptyWindow) {
+		h.emptyCount = 0
+		h.emptySince = now
+	}
+	h.emptyCount++
+	return h.emptyCount
+}
+
+// storedDuplicate reports whether the order is already in the DB; if so the
+// stored copy is checked for conflicts and cached. DB errors are returned so
+// the message is retried
+func (h *Handler) storedDuplicate(ctx context.Context, msg kafka.Message, order model.Order) (bool, error) {
+	exists, err := h.Database.OrderExists(ctx, order.OrderUID)
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("order_exists").Inc()
+		return false, fmt.Errorf("failed to check for stored duplicate: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+
+	slog.Info("Order already stored, skipping", "order_uid", order.OrderUID)
+	metrics.OrdersSkipped.WithLabelValues("db_dup").Inc()
+
+	stored, err := h.Database.GetOrder(ctx, order.OrderUID)
+	if err != nil {
+		// The duplicate is settled either way; caching it is best effort
+		slog.Warn("Failed to load stored duplicate", "order_uid", order.OrderUID, "error", err)
+		return true, nil
+	}
+	h.Cache.Set(stored, cache.DefaultTTL)
+	if h.Cache.LazyItems() {
+		h.Cache.SetItems(stored.OrderUID, stored.Items)
+		stored.Items = nil
+	}
+	h.checkConflict(msg, order, stored)
+	return true, nil
+}
+
+// checkConflict reports a duplicate whose content differs from the stored
+// order, which is either a correction or a producer bug, and forwards it to
+// the review topic when one is configured
+func (h *Handler) checkConflict(msg kafka.Message, incoming, stored model.Order) {
+	if !h.opts.DetectConflicts {
+		return
+	}
+
+	if h.Cache.LazyItems() {
+		// The cached copy carries no items to compare against
+		incoming.Items = nil
+	}
+	// The status moves on after the order is stored, so it doesn't make a conflict
+	incoming.Status = stored.Status
+	diffs := incoming.Diff(stored)
+	if len(diffs) == 0 {
+		return
+	}
+
+	metrics.ConflictingDuplicates.Inc()
+	slog.Warn("Conflicting duplicate order",
+		"order_uid", incoming.OrderUID, "fields", strings.Join(diffs, ", "))
+
+	if h.Review == nil {
+		return
+	}
+	reason := "conflicting duplicate: " + strings.Join(diffs, ", ")
+	if err := h.Review.Send(context.Background(), msg, reason); err != nil {
+		slog.Error("Failed to route conflicting duplicate for review", "order_uid", incoming.OrderUID, "error", err)
+	}
+}
@@ -0,0 +1,460 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"orders-service/cache"
+	"orders-service/databasetest"
+	"orders-service/dlq"
+	"orders-service/kafkatest"
+	"orders-service/metrics"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// newTestDLQ returns a DLQ producer writing to an in-memory transport
+func newTestDLQ() (*dlq.Producer, *kafkatest.Transport) {
+	transport := &kafkatest.Transport{}
+	return dlq.New([]string{"kafka:9092"}, "orders.dlq", transport), transport
+}
+
+// newTestCache returns an empty cache stopped when the test ends
+func newTestCache(t *testing.T, opts cache.Options) *cache.Cache {
+	t.Helper()
+	c := cache.New(filepath.Join(t.TempDir(), "cache.gob"), opts)
+	t.Cleanup(c.Stop)
+	return c
+}
+
+// orderMessage returns a message carrying order as JSON
+func orderMessage(t *testing.T, order model.Order) kafka.Message {
+	t.Helper()
+	value, err := json.Marshal(order)
+	if err != nil {
+		t.Fatalf("encoding order: %v", err)
+	}
+	return kafka.Message{Topic: "orders", Key: []byte(order.OrderUID), Value: value}
+}
+
+// testDatabase returns an empty in-memory database
+func testDatabase(t *testing.T) *databasetest.DB {
+	t.Helper()
+	return databasetest.New()
+}
+
+// slowDatabase returns a database that never answers, so every query blocks
+// until its context is done
+func slowDatabase(t *testing.T) *databasetest.DB {
+	t.Helper()
+	db := databasetest.New()
+	db.Delay(time.Hour)
+	return db
+}
+
+// refusedDatabase returns a database failing every query like during a DB outage
+func refusedDatabase(t *testing.T) *databasetest.DB {
+	t.Helper()
+	db := databasetest.New()
+	db.Down(databasetest.ErrUnavailable)
+	return db
+}
+
+// histogram returns the sample count and sum of the histogram named name
+func histogram(t *testing.T, name string) (uint64, float64) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			h := family.GetMetric()[0].GetHistogram()
+			return h.GetSampleCount(), h.GetSampleSum()
+		}
+	}
+	return 0, 0
+}
+
+// metricDelta returns how much the metric named key changed while fn ran
+func metricDelta(t *testing.T, key string, fn func()) float64 {
+	t.Helper()
+	before, err := metrics.Snapshot("")
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	fn()
+	after, err := metrics.Snapshot("")
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	return after[key] - before[key]
+}
+
+func TestHandleEmptyMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		messages  int
+		wantDLQ   int
+	}{
+		{name: "routing disabled", threshold: 0, messages: 5, wantDLQ: 0},
+		{name: "below threshold", threshold: 5, messages: 5, wantDLQ: 0},
+		{name: "above threshold", threshold: 2, messages: 5, wantDLQ: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer, transport := newTestDLQ()
+			h := New(nil, nil, Options{EmptyDLQThreshold: tt.threshold, EmptyWindow: time.Minute})
+			h.DLQ = producer
+
+			counted := metricDelta(t, "orders_empty_messages_total", func() {
+				for i := range tt.messages {
+					msg := kafka.Message{Topic: "orders", Offset: int64(i), Key: []byte("empty")}
+					if err := h.HandleOrder(context.Background(), msg); err != nil {
+						t.Fatalf("HandleOrder: %v", err)
+					}
+				}
+			})
+			if counted != float64(tt.messages) {
+				t.Errorf("orders_empty_messages_total grew by %v, want %d", counted, tt.messages)
+			}
+			if got := len(transport.Messages()); got != tt.wantDLQ {
+				t.Errorf("dead-lettered %d messages, want %d", got, tt.wantDLQ)
+			}
+		})
+	}
+}
+
+func TestCountEmptyWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		window time.Duration
+		at     []time.Duration // offsets from start of each empty message
+		want   int64           // count returned for the last one
+	}{
+		{name: "within window", window: time.Minute, at: []time.Duration{0, time.Second, 59 * time.Second}, want: 3},
+		{name: "window passed", window: time.Minute, at: []time.Duration{0, time.Second, time.Minute}, want: 1},
+		{name: "restarts from new window", window: time.Minute, at: []time.Duration{0, 2 * time.Minute, 2*time.Minute + time.Second}, want: 2},
+		{name: "no window", window: 0, at: []time.Duration{0, time.Hour, 48 * time.Hour}, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(nil, nil, Options{EmptyWindow: tt.window})
+			var got int64
+			for _, offset := range tt.at {
+				got = h.countEmpty(start.Add(offset))
+			}
+			if got != tt.want {
+				t.Errorf("count = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleConflictingDuplicate(t *testing.T) {
+	tests := []struct {
+		name         string
+		detect       bool
+		change       func(*model.Order)
+		wantConflict bool
+		wantFields   []string
+	}{
+		{name: "identical", detect: true, change: func(*model.Order) {}},
+		{name: "changed city", detect: true, change: func(o *model.Order) { o.Delivery.City = "Haifa" },
+			wantConflict: true, wantFields: []string{"delivery"}},
+		{name: "changed amount and item", detect: true, change: func(o *model.Order) {
+			o.Payment.Amount = 2000
+			o.Items[0].Price = 500
+		}, wantConflict: true, wantFields: []string{"payment", "items"}},
+		{name: "status only", detect: true, change: func(o *model.Order) { o.Status = model.StatusShipped }},
+		{name: "detection off", detect: false, change: func(o *model.Order) { o.Delivery.City = "Haifa" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, cache.Options{})
+			stored := ordertest.Order("conflict-" + strings.ReplaceAll(tt.name, " ", "-"))
+			c.Set(stored, cache.DefaultTTL)
+
+			review, transport := newTestDLQ()
+			h := New(nil, c, Options{DetectConflicts: tt.detect})
+			h.Review = review
+
+			incoming := ordertest.Order(stored.OrderUID)
+			tt.change(&incoming)
+			conflicts := metricDelta(t, "orders_conflicting_duplicates_total", func() {
+				if err := h.HandleOrder(context.Background(), orderMessage(t, incoming)); err != nil {
+					t.Fatalf("HandleOrder: %v", err)
+				}
+			})
+
+			want := 0
+			if tt.wantConflict {
+				want = 1
+			}
+			if conflicts != float64(want) {
+				t.Errorf("orders_conflicting_duplicates_total grew by %v, want %d", conflicts, want)
+			}
+			sent := transport.Messages()
+			if len(sent) != want {
+				t.Fatalf("routed %d messages for review, want %d", len(sent), want)
+			}
+			for _, msg := range sent {
+				reason := ""
+				for _, header := range msg.Headers {
+					if header.Key == dlq.ErrorHeader {
+						reason = string(header.Value)
+					}
+				}
+				for _, field := range tt.wantFields {
+					if !strings.Contains(reason, field) {
+						t.Errorf("review reason %q does not name %s", reason, field)
+					}
+				}
+			}
+			if got, _ := c.Peek(stored.OrderUID); got.Delivery.City != stored.Delivery.City {
+				t.Error("duplicate overwrote the cached order")
+			}
+		})
+	}
+}
+
+func TestHandleProcessTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		cached      bool // the order is a cached duplicate, settled without the DB
+		dlq         bool
+		wantErr     bool
+		wantDLQ     int
+		wantTimeout float64
+	}{
+		{name: "slow DB dead-lettered", dlq: true, wantDLQ: 1, wantTimeout: 1},
+		{name: "slow DB without DLQ", wantErr: true, wantTimeout: 1},
+		{name: "fast path", cached: true, dlq: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, cache.Options{})
+			order := ordertest.Order("timeout-" + strings.ReplaceAll(tt.name, " ", "-"))
+			if tt.cached {
+				c.Set(order, cache.DefaultTTL)
+			}
+			h := New(slowDatabase(t), c, Options{ProcessTimeout: 100 * time.Millisecond})
+			producer, transport := newTestDLQ()
+			if tt.dlq {
+				h.DLQ = producer
+			}
+
+			var err error
+			start := time.Now()
+			timeouts := metricDelta(t, "orders_process_timeouts_total", func() {
+				err = h.HandleOrder(context.Background(), orderMessage(t, order))
+			})
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("handling took %v despite the deadline", elapsed)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("HandleOrder error = %v, want error %v", err, tt.wantErr)
+			}
+			if timeouts != tt.wantTimeout {
+				t.Errorf("orders_process_timeouts_total grew by %v, want %v", timeouts, tt.wantTimeout)
+			}
+			sent := transport.Messages()
+			if len(sent) != tt.wantDLQ {
+				t.Fatalf("dead-lettered %d messages, want %d", len(sent), tt.wantDLQ)
+			}
+			for _, msg := range sent {
+				if string(msg.Key) != order.OrderUID {
+					t.Errorf("dead-lettered message key = %q, want %q", msg.Key, order.OrderUID)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderItemCountHistogram(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name  string
+		items []int // item count of each ingested order
+	}{
+		{name: "single order", items: []int{1}},
+		{name: "varying sizes", items: []int{1, 3, 7, 25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(db, newTestCache(t, cache.Options{}), Options{})
+			countBefore, sumBefore := histogram(t, "order_item_count")
+
+			wantSum := 0
+			for i, n := range tt.items {
+				order := ordertest.Order(fmt.Sprintf("items-%s-%d", strings.ReplaceAll(tt.name, " ", "-"), i))
+				for len(order.Items) < n {
+					order.Items = append(order.Items, order.Items[0])
+				}
+				if err := h.HandleOrder(context.Background(), orderMessage(t, order)); err != nil {
+					t.Fatalf("HandleOrder: %v", err)
+				}
+				wantSum += n
+			}
+
+			count, sum := histogram(t, "order_item_count")
+			if got := count - countBefore; got != uint64(len(tt.items)) {
+				t.Errorf("observed %d orders, want %d", got, len(tt.items))
+			}
+			if got := sum - sumBefore; got != float64(wantSum) {
+				t.Errorf("observed %v items, want %d", got, wantSum)
+			}
+		})
+	}
+}
+
+func TestSkipReasons(t *testing.T) {
+	tests := []struct {
+		name    string
+		reason  string
+		needsDB bool
+		setup   func(t *testing.T, h *Handler) kafka.Message
+	}{
+		{name: "cached duplicate", reason: "cache_dup", setup: func(t *testing.T, h *Handler) kafka.Message {
+			order := ordertest.Order("skip-cache-dup")
+			h.Cache.Set(order, cache.DefaultTTL)
+			return orderMessage(t, order)
+		}},
+		{name: "stored duplicate", reason: "db_dup", needsDB: true, setup: func(t *testing.T, h *Handler) kafka.Message {
+			order := ordertest.Order("skip-db-dup")
+			if err := h.Database.MakeOrder(context.Background(), order); err != nil {
+				t.Fatalf("MakeOrder: %v", err)
+			}
+			return orderMessage(t, order)
+		}},
+		{name: "empty message", reason: "empty", setup: func(*testing.T, *Handler) kafka.Message {
+			return kafka.Message{Topic: "orders"}
+		}},
+		{name: "malformed JSON", reason: "invalid", setup: func(*testing.T, *Handler) kafka.Message {
+			return kafka.Message{Topic: "orders", Value: []byte(`{"order_uid":`)}
+		}},
+		{name: "missing UID", reason: "invalid", setup: func(t *testing.T, _ *Handler) kafka.Message {
+			return orderMessage(t, ordertest.Order(""))
+		}},
+		{name: "invalid order", reason: "invalid", setup: func(t *testing.T, _ *Handler) kafka.Message {
+			order := ordertest.Order("skip-invalid")
+			order.Items = nil
+			return orderMessage(t, order)
+		}},
+		{name: "denied UID", reason: "filtered", setup: func(t *testing.T, _ *Handler) kafka.Message {
+			return orderMessage(t, ordertest.Order("denied-order"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var db Store
+			if tt.needsDB {
+				db = testDatabase(t)
+			}
+			h := New(db, newTestCache(t, cache.Options{}), Options{UIDFilter: UIDFilter{Deny: []string{"denied-"}}})
+			h.DLQ, _ = newTestDLQ()
+			msg := tt.setup(t, h)
+
+			key := fmt.Sprintf("orders_skipped_total{reason=%q}", tt.reason)
+			skipped := metricDelta(t, key, func() {
+				if err := h.HandleOrder(context.Background(), msg); err != nil {
+					t.Fatalf("HandleOrder: %v", err)
+				}
+			})
+			if skipped != 1 {
+				t.Errorf("%s grew by %v, want 1", key, skipped)
+			}
+		})
+	}
+}
+
+func TestDeadLetterPermanentErrors(t *testing.T) {
+	invalid := ordertest.Order("dlq-invalid")
+	invalid.TrackNumber = ""
+
+	tests := []struct {
+		name       string
+		value      []byte
+		dlqFails   bool
+		wantDLQ    string // reason label; empty when the message is retried
+		wantRetry  bool   // HandleOrder returns an error so the offset isn't committed
+		wantHeader string
+	}{
+		{name: "malformed JSON", value: []byte(`{"order_uid":`), wantDLQ: "unmarshal", wantHeader: "failed to unmarshal json"},
+		{name: "empty UID", value: []byte(`{"order_uid":""}`), wantDLQ: "empty_uid", wantHeader: "empty order_uid"},
+		{name: "invalid order", value: mustJSON(t, invalid), wantDLQ: "invalid_order", wantHeader: "track_number is required"},
+		{name: "DB unavailable", value: mustJSON(t, ordertest.Order("dlq-transient")), wantRetry: true},
+		{name: "DLQ unavailable", value: []byte(`{"order_uid":`), dlqFails: true, wantRetry: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer, transport := newTestDLQ()
+			if tt.dlqFails {
+				transport.Fail(errors.New("broker unavailable"))
+			}
+			h := New(refusedDatabase(t), newTestCache(t, cache.Options{}), Options{WriteAttempts: 1})
+			h.DLQ = producer
+			msg := kafka.Message{Topic: "orders", Key: []byte("dlq"), Value: tt.value}
+
+			var err error
+			routed := 0.0
+			if tt.wantDLQ != "" {
+				routed = metricDelta(t, fmt.Sprintf("orders_dlq_messages_total{reason=%q}", tt.wantDLQ), func() {
+					err = h.HandleOrder(context.Background(), msg)
+				})
+			} else {
+				err = h.HandleOrder(context.Background(), msg)
+			}
+
+			if (err != nil) != tt.wantRetry {
+				t.Fatalf("HandleOrder error = %v, want retry %v", err, tt.wantRetry)
+			}
+			produced := transport.Messages()
+			if tt.wantDLQ == "" {
+				if len(produced) != 0 {
+					t.Errorf("dead-lettered %d messages, want none", len(produced))
+				}
+				return
+			}
+			if routed != 1 {
+				t.Errorf("orders_dlq_messages_total{reason=%q} grew by %v, want 1", tt.wantDLQ, routed)
+			}
+			if len(produced) != 1 {
+				t.Fatalf("dead-lettered %d messages, want 1", len(produced))
+			}
+			if string(produced[0].Value) != string(tt.value) {
+				t.Errorf("dead-lettered value %q, want the original %q", produced[0].Value, tt.value)
+			}
+			var reason string
+			for _, header := range produced[0].Headers {
+				if header.Key == dlq.ErrorHeader {
+					reason = string(header.Value)
+				}
+			}
+			if !strings.Contains(reason, tt.wantHeader) {
+				t.Errorf("error header = %q, want it to mention %q", reason, tt.wantHeader)
+			}
+		})
+	}
+}
+
+// mustJSON encodes v, failing the test on error
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("encoding: %v", err)
+	}
+	return data
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"orders-service/model"
+	"regexp"
+	"strings"
+)
+
+// Policy decides what happens to an order that fails an optional check
+type Policy string
+
+const (
+	PolicyAllow  Policy = "allow"  // accept silently
+	PolicyWarn   Policy = "warn"   // accept and log a warning
+	PolicyReject Policy = "reject" // dead-letter the message
+)
+
+// ParsePolicy validates a policy name
+func ParsePolicy(v string) (Policy, error) {
+	switch p := Policy(strings.ToLower(v)); p {
+	case PolicyAllow, PolicyWarn, PolicyReject:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q, expected allow, warn or reject", v)
+}
+
+// apply enforces the policy for a failed check; it returns the error to
+// reject the order with, or nil when the order may proceed
+func (p Policy) apply(order model.Order, problem error) error {
+	if problem == nil {
+		return nil
+	}
+	switch p {
+	case PolicyReject:
+		return problem
+	case PolicyWarn:
+		slog.Warn("Order accepted with problem", "order_uid", order.OrderUID, "problem", problem)
+	}
+	return nil
+}
+
+// checkPrices reports items with a zero or negative price, which is either
+// a producer error or a legitimate freebie depending on the integration
+func checkPrices(order model.Order) error {
+	var bad []string
+	for i, item := range order.Items {
+		if item.Price <= 0 {
+			bad = append(bad, fmt.Sprintf("items[%d].price=%d", i, item.Price))
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	return fmt.Errorf("non-positive item price: %s", strings.Join(bad, ", "))
+}
+
+// checkPartial reports an order that arrived without delivery or payment
+func checkPartial(order model.Order) error {
+	var missing []string
+	if order.Delivery.IsZero() {
+		missing = append(missing, "delivery")
+	}
+	if order.Payment.IsZero() {
+		missing = append(missing, "payment")
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("partial order, missing %s", strings.Join(missing, " and "))
+}
+
+// SizeRule describes the item sizes an integration accepts: either a fixed
+// set of values or a pattern. The zero value accepts everything
+type SizeRule struct {
+	Allowed []string
+	Pattern *regexp.Regexp
+}
+
+// ParseSizeRule builds a rule from a comma-separated list of allowed sizes
+// and/or a regular expression; empty inputs impose no constraint
+func ParseSizeRule(allowed, pattern string) (SizeRule, error) {
+	var rule SizeRule
+	for _, v := range strings.Split(allowed, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			rule.Allowed = append(rule.Allowed, v)
+		}
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return SizeRule{}, fmt.Errorf("invalid size pattern: %w", err)
+		}
+		rule.Pattern = re
+	}
+	return rule, nil
+}
+
+// matches reports whether a size satisfies the rule
+func (r SizeRule) matches(size string) bool {
+	if len(r.Allowed) == 0 && r.Pattern == nil {
+		return true
+	}
+	for _, v := range r.Allowed {
+		if size == v {
+			return true
+		}
+	}
+	return r.Pattern != nil && r.Pattern.MatchString(size)
+}
+
+// applyDefaultSize fills in empty item sizes
+func applyDefaultSize(order *model.Order, size string) {
+	if size == "" {
+		return
+	}
+	for i := range order.Items {
+		if order.Items[i].Size == "" {
+			order.Items[i].Size = size
+		}
+	}
+}
+
+// checkSizes reports items whose size the rule doesn't accept
+func checkSizes(order model.Order, rule SizeRule) error {
+	var bad []string
+	for i, item := range order.Items {
+		if !rule.matches(item.Size) {
+			bad = append(bad, fmt.Sprintf("items[%d].size=%q", i, item.Size))
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid item size: %s", strings.Join(bad, ", "))
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"orders-service/cache"
+	"orders-service/dlq"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"sync"
+	"testing"
+)
+
+// logRecorder is a slog.Handler keeping the messages logged
+type logRecorder struct {
+	mu       sync.Mutex
+	messages map[slog.Level][]string
+}
+
+// captureLogs routes the default logger to a recorder until the test ends
+func captureLogs(t *testing.T) *logRecorder {
+	t.Helper()
+	rec := &logRecorder{messages: make(map[slog.Level][]string)}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(rec))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return rec
+}
+
+func (l *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+func (l *logRecorder) WithAttrs([]slog.Attr) slog.Handler       { return l }
+func (l *logRecorder) WithGroup(string) slog.Handler            { return l }
+
+func (l *logRecorder) Handle(_ context.Context, r slog.Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages[r.Level] = append(l.messages[r.Level], r.Message)
+	return nil
+}
+
+// Logged reports whether msg was logged at level
+func (l *logRecorder) Logged(level slog.Level, msg string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range l.messages[level] {
+		if m == msg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPricePolicy(t *testing.T) {
+	tests := []struct {
+		policy   Policy
+		price    int
+		wantDLQ  bool
+		wantWarn bool
+	}{
+		{policy: PolicyReject, price: 0, wantDLQ: true},
+		{policy: PolicyReject, price: -100, wantDLQ: true},
+		{policy: PolicyReject, price: 453},
+		{policy: PolicyWarn, price: 0, wantWarn: true},
+		{policy: PolicyWarn, price: -100, wantWarn: true},
+		{policy: PolicyAllow, price: 0},
+		{policy: PolicyAllow, price: -100},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/price %d", tt.policy, tt.price), func(t *testing.T) {
+			logs := captureLogs(t)
+			order := ordertest.Order("price-policy")
+			order.Items[0].Price = tt.price
+			// A cached copy settles the accepted order without a DB
+			c := newTestCache(t, cache.Options{})
+			c.Set(order, cache.DefaultTTL)
+			producer, transport := newTestDLQ()
+			h := New(nil, c, Options{PricePolicy: tt.policy})
+			h.DLQ = producer
+
+			if err := h.HandleOrder(context.Background(), orderMessage(t, order)); err != nil {
+				t.Fatalf("HandleOrder: %v", err)
+			}
+			if got := len(transport.Messages()) == 1; got != tt.wantDLQ {
+				t.Errorf("dead-lettered = %v, want %v", got, tt.wantDLQ)
+			}
+			if got := logs.Logged(slog.LevelWarn, "Order accepted with problem"); got != tt.wantWarn {
+				t.Errorf("warning logged = %v, want %v", got, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestSizePolicy(t *testing.T) {
+	sets, err := ParseSizeRule("S, M, L", "")
+	if err != nil {
+		t.Fatalf("ParseSizeRule: %v", err)
+	}
+	numeric, err := ParseSizeRule("", `^[0-9]+$`)
+	if err != nil {
+		t.Fatalf("ParseSizeRule: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		rule        SizeRule
+		policy      Policy
+		size        string
+		defaultSize string
+		wantDLQ     bool
+		wantWarn    bool
+	}{
+		{name: "no rule", policy: PolicyReject, size: "XXL"},
+		{name: "allowed set", rule: sets, policy: PolicyReject, size: "M"},
+		{name: "outside set", rule: sets, policy: PolicyReject, size: "XXL", wantDLQ: true},
+		{name: "outside set warned", rule: sets, policy: PolicyWarn, size: "XXL", wantWarn: true},
+		{name: "outside set allowed", rule: sets, policy: PolicyAllow, size: "XXL"},
+		{name: "numeric", rule: numeric, policy: PolicyReject, size: "42"},
+		{name: "not numeric", rule: numeric, policy: PolicyReject, size: "4x2", wantDLQ: true},
+		{name: "not numeric warned", rule: numeric, policy: PolicyWarn, size: "4x2", wantWarn: true},
+		{name: "empty gets default", rule: sets, policy: PolicyReject, size: "", defaultSize: "M"},
+		{name: "empty without default", rule: sets, policy: PolicyReject, size: "", wantDLQ: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			order := ordertest.Order("size-policy")
+			order.Items[0].Size = tt.size
+			// A cached copy settles the accepted order without a DB
+			c := newTestCache(t, cache.Options{})
+			c.Set(order, cache.DefaultTTL)
+			producer, transport := newTestDLQ()
+			h := New(nil, c, Options{SizeRule: tt.rule, SizePolicy: tt.policy, DefaultItemSize: tt.defaultSize})
+			h.DLQ = producer
+
+			if err := h.HandleOrder(context.Background(), orderMessage(t, order)); err != nil {
+				t.Fatalf("HandleOrder: %v", err)
+			}
+			if got := len(transport.Messages()) == 1; got != tt.wantDLQ {
+				t.Errorf("dead-lettered = %v, want %v", got, tt.wantDLQ)
+			}
+			if got := logs.Logged(slog.LevelWarn, "Order accepted with problem"); got != tt.wantWarn {
+				t.Errorf("warning logged = %v, want %v", got, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestPartialPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     Policy
+		noDelivery bool
+		noPayment  bool
+		problem    string // what checkPartial reports; empty for a complete order
+		wantDLQ    bool
+		wantWarn   bool
+	}{
+		{name: "complete", policy: PolicyReject},
+		{name: "missing delivery", policy: PolicyReject, noDelivery: true,
+			problem: "partial order, missing delivery", wantDLQ: true},
+		{name: "missing payment", policy: PolicyReject, noPayment: true,
+			problem: "partial order, missing payment", wantDLQ: true},
+		{name: "missing both", policy: PolicyReject, noDelivery: true, noPayment: true,
+			problem: "partial order, missing delivery and payment", wantDLQ: true},
+		{name: "missing delivery warned", policy: PolicyWarn, noDelivery: true,
+			problem: "partial order, missing delivery", wantWarn: true},
+		{name: "missing both warned", policy: PolicyWarn, noDelivery: true, noPayment: true,
+			problem: "partial order, missing delivery and payment", wantWarn: true},
+		{name: "missing payment allowed", policy: PolicyAllow, noPayment: true,
+			problem: "partial order, missing payment"},
+		{name: "missing both allowed", policy: PolicyAllow, noDelivery: true, noPayment: true,
+			problem: "partial order, missing delivery and payment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			order := ordertest.Order("partial-policy")
+			if tt.noDelivery {
+				order.Delivery = model.Delivery{}
+			}
+			if tt.noPayment {
+				order.Payment = model.Payment{}
+			}
+			problem := ""
+			if err := checkPartial(order); err != nil {
+				problem = err.Error()
+			}
+			if problem != tt.problem {
+				t.Errorf("checkPartial = %q, want %q", problem, tt.problem)
+			}
+
+			// A cached copy settles the accepted order without a DB
+			c := newTestCache(t, cache.Options{})
+			c.Set(order, cache.DefaultTTL)
+			producer, transport := newTestDLQ()
+			h := New(nil, c, Options{PartialPolicy: tt.policy})
+			h.DLQ = producer
+
+			if err := h.HandleOrder(context.Background(), orderMessage(t, order)); err != nil {
+				t.Fatalf("HandleOrder: %v", err)
+			}
+			sent := transport.Messages()
+			if got := len(sent) == 1; got != tt.wantDLQ {
+				t.Fatalf("dead-lettered = %v, want %v", got, tt.wantDLQ)
+			}
+			if tt.wantDLQ {
+				reason := ""
+				for _, header := range sent[0].Headers {
+					if header.Key == dlq.ErrorHeader {
+						reason = string(header.Value)
+					}
+				}
+				if reason != tt.problem {
+					t.Errorf("dead-letter reason %q, want %q", reason, tt.problem)
+				}
+			}
+			if got := logs.Logged(slog.LevelWarn, "Order accepted with problem"); got != tt.wantWarn {
+				t.Errorf("warning logged = %v, want %v", got, tt.wantWarn)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"orders-service/cache"
+	"orders-service/databasetest"
+	"orders-service/ordertest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleOrderRetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int // MakeOrder calls failing with a transient error
+		wantPersisted bool
+	}{
+		{name: "no failures", failures: 0, wantPersisted: true},
+		{name: "fails twice then succeeds", failures: 2, wantPersisted: true},
+		{name: "attempts exhausted", failures: 3, wantPersisted: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDatabase(t)
+			order := ordertest.Order("retry-" + strings.ReplaceAll(tt.name, " ", "-"))
+			for range tt.failures {
+				db.FailNext("MakeOrder", databasetest.ErrUnavailable)
+			}
+			c := newTestCache(t, cache.Options{})
+			h := New(db, c, Options{WriteAttempts: 3, WriteBackoff: time.Millisecond})
+
+			err := h.HandleOrder(context.Background(), orderMessage(t, order))
+			if tt.wantPersisted && err != nil {
+				t.Fatalf("HandleOrder: %v", err)
+			}
+			if !tt.wantPersisted && err == nil {
+				t.Fatal("HandleOrder succeeded, want the DB error returned for a retry")
+			}
+			if got, want := db.Calls("MakeOrder"), min(tt.failures+1, 3); got != want {
+				t.Errorf("MakeOrder called %d times, want %d", got, want)
+			}
+			exists, err := db.OrderExists(context.Background(), order.OrderUID)
+			if err != nil {
+				t.Fatalf("OrderExists: %v", err)
+			}
+			if exists != tt.wantPersisted {
+				t.Errorf("order persisted = %v, want %v", exists, tt.wantPersisted)
+			}
+			if _, cached := c.Peek(order.OrderUID); cached != tt.wantPersisted {
+				t.Errorf("order cached = %v, want %v", cached, tt.wantPersisted)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Schema is a compiled JSON Schema that raw order messages are checked against
+type Schema struct {
+	schema *jsonschema.Schema
+}
+
+// LoadSchema compiles the JSON Schema at path
+func LoadSchema(path string) (*Schema, error) {
+	s, err := jsonschema.NewCompiler().Compile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order schema: %w", err)
+	}
+	return &Schema{schema: s}, nil
+}
+
+// validate checks a raw JSON document against the schema, catching type
+// mismatches that unmarshaling would silently turn into zero values
+func (s *Schema) validate(value []byte) error {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(value))
+	if err != nil {
+		return fmt.Errorf("failed to parse json: %w", err)
+	}
+	if err := s.schema.Validate(doc); err != nil {
+		return fmt.Errorf("order does not match the schema: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"orders-service/cache"
+	"orders-service/dlq"
+	"orders-service/ordertest"
+	"strings"
+	"testing"
+)
+
+// loadTestSchema compiles the service's order schema
+func loadTestSchema(t *testing.T) *Schema {
+	t.Helper()
+	schema, err := LoadSchema("../schemas/order.schema.json")
+	if err != nil {
+		t.Fatalf("LoadSchema: %v", err)
+	}
+	return schema
+}
+
+// orderDocument returns the JSON of a valid order after change edits its
+// generic form
+func orderDocument(t *testing.T, change func(doc map[string]interface{})) []byte {
+	t.Helper()
+	var doc map[string]interface{}
+	if err := json.Unmarshal(mustJSON(t, ordertest.Order("schema")), &doc); err != nil {
+		t.Fatal(err)
+	}
+	change(doc)
+	return mustJSON(t, doc)
+}
+
+// schemaCases are the documents checked against the order schema
+var schemaCases = []struct {
+	name    string
+	change  func(doc map[string]interface{})
+	wantErr bool
+}{
+	{name: "valid", change: func(map[string]interface{}) {}},
+	{name: "wrong type", change: func(doc map[string]interface{}) { doc["sm_id"] = "99" }, wantErr: true},
+	{name: "wrong item type", change: func(doc map[string]interface{}) {
+		doc["items"].([]interface{})[0].(map[string]interface{})["price"] = "453"
+	}, wantErr: true},
+	{name: "missing field", change: func(doc map[string]interface{}) { delete(doc, "track_number") }, wantErr: true},
+	{name: "missing nested field", change: func(doc map[string]interface{}) {
+		delete(doc["payment"].(map[string]interface{}), "currency")
+	}, wantErr: true},
+	{name: "unknown status", change: func(doc map[string]interface{}) { doc["status"] = "lost" }, wantErr: true},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := loadTestSchema(t)
+	for _, tt := range schemaCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.validate(orderDocument(t, tt.change))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+	if err := schema.validate([]byte("{")); err == nil {
+		t.Error("validate accepted malformed JSON")
+	}
+}
+
+func TestHandleSchemaFailures(t *testing.T) {
+	schema := loadTestSchema(t)
+	for _, tt := range schemaCases {
+		if !tt.wantErr {
+			continue // would be stored
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			producer, transport := newTestDLQ()
+			h := New(nil, newTestCache(t, cache.Options{}), Options{Schema: schema})
+			h.DLQ = producer
+
+			msg := orderMessage(t, ordertest.Order("schema"))
+			msg.Value = orderDocument(t, tt.change)
+			if err := h.HandleOrder(context.Background(), msg); err != nil {
+				t.Fatalf("HandleOrder: %v", err)
+			}
+
+			sent := transport.Messages()
+			if len(sent) != 1 {
+				t.Fatalf("dead-lettered %d messages, want 1", len(sent))
+			}
+			reason := ""
+			for _, header := range sent[0].Headers {
+				if header.Key == dlq.ErrorHeader {
+					reason = string(header.Value)
+				}
+			}
+			if !strings.Contains(reason, "schema") {
+				t.Errorf("dead-letter reason %q does not mention the schema", reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"log/slog"
+	"orders-service/metrics"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// messageTime returns when msg was produced, clamped to now: a producer with
+// a skewed clock can stamp messages in the future, which would make the lag
+// negative
+func messageTime(msg kafka.Message, now time.Time) time.Time {
+	if !msg.Time.After(now) {
+		return msg.Time
+	}
+	metrics.FutureMessages.Inc()
+	slog.Warn("Message timestamp is in the future, producer clock skew?", "key", string(msg.Key),
+		"timestamp", msg.Time, "ahead", msg.Time.Sub(now))
+	return now
+}
+
+// observeLag records how long msg waited between being produced and handled
+func observeLag(msg kafka.Message) {
+	if msg.Time.IsZero() {
+		return
+	}
+	now := time.Now()
+	metrics.MessageLag.Observe(now.Sub(messageTime(msg, now)).Seconds())
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestFutureMessageTimestamps(t *testing.T) {
+	tests := []struct {
+		name       string
+		offset     time.Duration // message time relative to now; 0 leaves it unset
+		wantLag    bool          // whether a lag is observed
+		minLag     float64
+		wantSkewed bool
+	}{
+		{name: "no timestamp"},
+		{name: "past", offset: -2 * time.Second, wantLag: true, minLag: 2},
+		{name: "future", offset: time.Hour, wantLag: true, wantSkewed: true},
+		{name: "slightly future", offset: 50 * time.Millisecond, wantLag: true, wantSkewed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(nil, nil, Options{})
+			msg := kafka.Message{Topic: "orders", Key: []byte("skewed")}
+			if tt.offset != 0 {
+				msg.Time = time.Now().Add(tt.offset)
+			}
+
+			count, sum := histogram(t, "orders_message_lag_seconds")
+			skewed := metricDelta(t, "orders_future_timestamp_messages_total", func() {
+				// An empty message is enough: the lag is observed on receipt
+				if err := h.HandleOrder(context.Background(), msg); err != nil {
+					t.Fatalf("HandleOrder: %v", err)
+				}
+			})
+			afterCount, afterSum := histogram(t, "orders_message_lag_seconds")
+
+			if got := afterCount - count; got != uint64(boolInt(tt.wantLag)) {
+				t.Errorf("observed %d lags, want %d", got, boolInt(tt.wantLag))
+			}
+			if lag := afterSum - sum; lag < tt.minLag || (tt.wantSkewed && lag > 1) {
+				t.Errorf("observed lag %vs, want at least %vs and no negative or skewed value", lag, tt.minLag)
+			}
+			if skewed != float64(boolInt(tt.wantSkewed)) {
+				t.Errorf("orders_future_timestamp_messages_total grew by %v, want %d", skewed, boolInt(tt.wantSkewed))
+			}
+		})
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"orders-service/cache"
+	"orders-service/databasetest"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spanExporterOnce sync.Once
+	spanExporter     *tracetest.InMemoryExporter
+)
+
+// recordSpans installs an in-memory exporter as the global tracer provider
+// and clears it; the global provider can only be set once for the tracers
+// created at package init, so every test shares the exporter
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	spanExporterOnce.Do(func() {
+		spanExporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	spanExporter.Reset()
+	return spanExporter
+}
+
+// spanNamed returns the first recorded span with the given name
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no %s span among %d recorded", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+// spanDatabase records the span context MakeOrder is called with
+type spanDatabase struct {
+	*databasetest.DB
+	span trace.SpanContext
+}
+
+func (db *spanDatabase) MakeOrder(ctx context.Context, order model.Order) error {
+	db.span = trace.SpanContextFromContext(ctx)
+	return db.DB.MakeOrder(ctx, order)
+}
+
+func TestHandleOrderSpans(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	parentID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+
+	tests := []struct {
+		name     string
+		database bool
+		parent   bool // the message carries a traceparent header
+	}{
+		{name: "new trace"},
+		{name: "continued trace", parent: true},
+		{name: "stored order", database: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(nil, newTestCache(t, cache.Options{}), Options{})
+			msg := kafka.Message{Topic: "orders", Key: []byte("tracing"), Value: []byte("{")}
+			db := &spanDatabase{DB: testDatabase(t)}
+			if tt.database {
+				h.Database = db
+				msg = orderMessage(t, ordertest.Order("tracing-stored"))
+			}
+			if tt.parent {
+				msg.Headers = []kafka.Header{{Key: "traceparent", Value: []byte("00-" + traceID.String() + "-" + parentID.String() + "-01")}}
+			}
+			exporter := recordSpans(t)
+
+			_ = h.HandleOrder(context.Background(), msg)
+
+			spans := exporter.GetSpans()
+			root := spanNamed(t, spans, "HandleOrder")
+			if root.SpanKind != trace.SpanKindConsumer {
+				t.Errorf("HandleOrder span kind = %v, want consumer", root.SpanKind)
+			}
+			switch {
+			case tt.parent:
+				if root.SpanContext.TraceID() != traceID || root.Parent.SpanID() != parentID {
+					t.Errorf("HandleOrder span in trace %s under %s, want %s under %s",
+						root.SpanContext.TraceID(), root.Parent.SpanID(), traceID, parentID)
+				}
+			case root.Parent.IsValid():
+				t.Errorf("HandleOrder span has parent %s, want a new trace", root.Parent.SpanID())
+			}
+			if !tt.database {
+				return
+			}
+
+			// The database's own MakeOrder and db.query spans are covered by
+			// the database package; here the context must carry the trace
+			if db.span.TraceID() != root.SpanContext.TraceID() {
+				t.Errorf("MakeOrder called in trace %s, want the HandleOrder trace %s",
+					db.span.TraceID(), root.SpanContext.TraceID())
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"log/slog"
+	"orders-service/cache"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// CacheTTLHeader is the optional Kafka header overriding how long an order
+// stays cached, in whole seconds
+const CacheTTLHeader = "cache-ttl-seconds"
+
+// cacheTTL returns the TTL requested by the message's CacheTTLHeader, or
+// cache.DefaultTTL when it is missing or not a positive integer. Requests
+// above cache.MaxTTL are capped to it, as longer TTLs would not survive a
+// reload from the cache file
+func cacheTTL(msg kafka.Message) time.Duration {
+	for _, header := range msg.Headers {
+		if header.Key != CacheTTLHeader {
+			continue
+		}
+		seconds, err := strconv.Atoi(string(header.Value))
+		if err != nil || seconds <= 0 {
+			slog.Warn("Ignoring invalid cache TTL header", "header", CacheTTLHeader,
+				"value", string(header.Value), "key", string(msg.Key))
+			return cache.DefaultTTL
+		}
+		if seconds > int(cache.MaxTTL/time.Second) {
+			slog.Warn("Capping cache TTL header", "header", CacheTTLHeader, "seconds", seconds,
+				"max", cache.MaxTTL, "key", string(msg.Key))
+			return cache.MaxTTL
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	return cache.DefaultTTL
+}
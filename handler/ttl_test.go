@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []kafka.Header
+		want    time.Duration
+	}{
+		{name: "missing", want: cache.DefaultTTL},
+		{name: "other header", headers: []kafka.Header{{Key: "trace-id", Value: []byte("3600")}}, want: cache.DefaultTTL},
+		{name: "one hour", headers: []kafka.Header{{Key: CacheTTLHeader, Value: []byte("3600")}}, want: time.Hour},
+		{name: "not a number", headers: []kafka.Header{{Key: CacheTTLHeader, Value: []byte("abc")}}, want: cache.DefaultTTL},
+		{name: "empty", headers: []kafka.Header{{Key: CacheTTLHeader}}, want: cache.DefaultTTL},
+		{name: "zero", headers: []kafka.Header{{Key: CacheTTLHeader, Value: []byte("0")}}, want: cache.DefaultTTL},
+		{name: "negative", headers: []kafka.Header{{Key: CacheTTLHeader, Value: []byte("-5")}}, want: cache.DefaultTTL},
+		{name: "above max", headers: []kafka.Header{{Key: CacheTTLHeader, Value: []byte("999999")}}, want: cache.MaxTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheTTL(kafka.Message{Key: []byte("ttl"), Headers: tt.headers}); got != tt.want {
+				t.Errorf("cacheTTL = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleOrderCacheTTL(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "no header", want: cache.DefaultTTL},
+		{name: "two hours", header: "7200", want: 2 * time.Hour},
+		{name: "invalid", header: "soon", want: cache.DefaultTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("ttl-" + strings.ReplaceAll(tt.name, " ", "-"))
+			file := filepath.Join(t.TempDir(), "cache.json")
+			c := cache.New(file, cache.Options{Format: cache.FormatJSON, NoCompression: true})
+			t.Cleanup(c.Stop)
+			h := New(db, c, Options{})
+
+			msg := orderMessage(t, order)
+			if tt.header != "" {
+				msg.Headers = []kafka.Header{{Key: CacheTTLHeader, Value: []byte(tt.header)}}
+			}
+			before := time.Now()
+			if err := h.HandleOrder(context.Background(), msg); err != nil {
+				t.Fatalf("HandleOrder: %v", err)
+			}
+			after := time.Now()
+
+			// The expiration is only visible in the saved cache file
+			if _, err := c.SaveToFile(); err != nil {
+				t.Fatalf("SaveToFile: %v", err)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var items map[string]cache.Item
+			if err := json.Unmarshal(data, &items); err != nil {
+				t.Fatalf("decoding the cache file: %v", err)
+			}
+			item, found := items[order.OrderUID]
+			if !found {
+				t.Fatalf("order not cached: %s", data)
+			}
+			expires := time.Unix(0, item.Expiration)
+			if expires.Before(before.Add(tt.want)) || expires.After(after.Add(tt.want)) {
+				t.Errorf("expiration %v, want %v from now", expires.Sub(before), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// UIDFilter restricts which order UIDs are ingested, e.g. to isolate test
+// traffic. Entries are prefixes, or glob patterns when they contain *, ? or [.
+// The zero value accepts everything
+type UIDFilter struct {
+	Allow []string // when set, only matching UIDs are accepted
+	Deny  []string // matching UIDs are rejected, even if allowed
+}
+
+// ParseUIDFilter builds a filter from comma-separated allow and deny lists
+func ParseUIDFilter(allow, deny string) (UIDFilter, error) {
+	var f UIDFilter
+	var err error
+	if f.Allow, err = parseUIDPatterns(allow); err != nil {
+		return UIDFilter{}, err
+	}
+	if f.Deny, err = parseUIDPatterns(deny); err != nil {
+		return UIDFilter{}, err
+	}
+	return f, nil
+}
+
+func parseUIDPatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if _, err := path.Match(v, ""); err != nil {
+			return nil, fmt.Errorf("invalid UID pattern %q: %w", v, err)
+		}
+		patterns = append(patterns, v)
+	}
+	return patterns, nil
+}
+
+// accepts reports whether an order with the given UID may be ingested
+func (f UIDFilter) accepts(uid string) bool {
+	if matchesAny(f.Deny, uid) {
+		return false
+	}
+	return len(f.Allow) == 0 || matchesAny(f.Allow, uid)
+}
+
+func matchesAny(patterns []string, uid string) bool {
+	for _, p := range patterns {
+		if strings.ContainsAny(p, "*?[") {
+			if ok, _ := path.Match(p, uid); ok {
+				return true
+			}
+		} else if strings.HasPrefix(uid, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"testing"
+)
+
+func TestUIDFilterAccepts(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow, deny string
+		uid         string
+		want        bool
+	}{
+		{name: "no lists", uid: "b563feb7b2b84b6test", want: true},
+		{name: "denied prefix", deny: "test-, qa-", uid: "qa-123", want: false},
+		{name: "not denied", deny: "test-, qa-", uid: "b563feb7b2b84b6test", want: true},
+		{name: "allowed prefix", allow: "prod-", uid: "prod-123", want: true},
+		{name: "allow list miss", allow: "prod-", uid: "b563feb7b2b84b6test", want: false},
+		{name: "deny wins over allow", allow: "prod-", deny: "prod-bad", uid: "prod-bad-1", want: false},
+		{name: "glob pattern", deny: "*test", uid: "b563feb7b2b84b6test", want: false},
+		{name: "glob miss", deny: "*test", uid: "b563feb7b2b84b6prod", want: true},
+		{name: "character class", allow: "[ab]*", uid: "b563feb7b2b84b6test", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseUIDFilter(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatalf("ParseUIDFilter: %v", err)
+			}
+			if got := f.accepts(tt.uid); got != tt.want {
+				t.Errorf("accepts(%q) = %v, want %v", tt.uid, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseUIDFilter("", "[bad"); err == nil {
+		t.Error("ParseUIDFilter accepted a malformed pattern")
+	}
+}
+
+func TestHandleFilteredOrders(t *testing.T) {
+	tests := []struct {
+		name         string
+		allow, deny  string
+		uid          string
+		wantFiltered bool
+	}{
+		{name: "denied prefix dropped", deny: "quarantine-", uid: "quarantine-1", wantFiltered: true},
+		{name: "allow list miss dropped", allow: "prod-", uid: "other-1", wantFiltered: true},
+		{name: "allowed processed", allow: "prod-", uid: "prod-1"},
+		{name: "not denied processed", deny: "quarantine-", uid: "prod-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseUIDFilter(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatalf("ParseUIDFilter: %v", err)
+			}
+			order := ordertest.Order(tt.uid)
+			// A cached copy settles an accepted order without a DB
+			c := newTestCache(t, cache.Options{})
+			c.Set(order, cache.DefaultTTL)
+			producer, transport := newTestDLQ()
+			h := New(nil, c, Options{UIDFilter: filter})
+			h.DLQ = producer
+
+			var processed float64
+			filtered := metricDelta(t, `orders_skipped_total{reason="filtered"}`, func() {
+				processed = metricDelta(t, `orders_skipped_total{reason="cache_dup"}`, func() {
+					if err := h.HandleOrder(context.Background(), orderMessage(t, order)); err != nil {
+						t.Fatalf("HandleOrder: %v", err)
+					}
+				})
+			})
+			if got := filtered == 1; got != tt.wantFiltered {
+				t.Errorf("filtered = %v, want %v", got, tt.wantFiltered)
+			}
+			if got := processed == 1; got == tt.wantFiltered {
+				t.Errorf("reached the duplicate check = %v, want %v", got, !tt.wantFiltered)
+			}
+			if n := len(transport.Messages()); n != 0 {
+				t.Errorf("dead-lettered %d messages, want none", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package i18n
+
+import (
+	"strings"
+)
+
+// DefaultLocale is used when neither the client nor the order names a supported locale
+const DefaultLocale = "en"
+
+// catalog maps a locale to its field labels and messages
+var catalog = map[string]map[string]string{
+	"en": {
+		"order_uid":     "Order",
+		"track_number":  "Track number",
+		"customer_id":   "Customer",
+		"date_created":  "Created",
+		"status":        "Status",
+		"delivery":      "Delivery",
+		"payment":       "Payment",
+		"items":         "Items",
+		"name":          "Name",
+		"price":         "Price",
+		"sale":          "Discount",
+		"size":          "Size",
+		"total_price":   "Total price",
+		"brand":         "Brand",
+		"amount":        "Amount",
+		"currency":      "Currency",
+		"delivery_cost": "Delivery cost",
+	},
+	"ru": {
+		"order_uid":     "Заказ",
+		"track_number":  "Трек-номер",
+		"customer_id":   "Покупатель",
+		"date_created":  "Создан",
+		"status":        "Статус",
+		"delivery":      "Доставка",
+		"payment":       "Оплата",
+		"items":         "Товары",
+		"name":          "Название",
+		"price":         "Цена",
+		"sale":          "Скидка",
+		"size":          "Размер",
+		"total_price":   "Итоговая цена",
+		"brand":         "Бренд",
+		"amount":        "Сумма",
+		"currency":      "Валюта",
+		"delivery_cost": "Стоимость доставки",
+	},
+}
+
+// Labels returns the labels for a supported locale, or the default locale's
+func Labels(locale string) map[string]string {
+	if labels, ok := catalog[locale]; ok {
+		return labels
+	}
+	return catalog[DefaultLocale]
+}
+
+// Supported reports whether labels exist for the locale
+func Supported(locale string) bool {
+	_, ok := catalog[locale]
+	return ok
+}
+
+// Negotiate picks the locale for a response: the first supported language
+// in the Accept-Language header, then the order's own locale, then the default
+func Negotiate(acceptLanguage, orderLocale string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if Supported(lang) {
+			return lang
+		}
+	}
+	if lang := strings.ToLower(orderLocale); Supported(lang) {
+		return lang
+	}
+	return DefaultLocale
+}
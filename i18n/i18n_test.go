@@ -0,0 +1,51 @@
+package i18n
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		orderLocale    string
+		want           string
+	}{
+		{name: "header wins", acceptLanguage: "ru-RU,ru;q=0.9", orderLocale: "en", want: "ru"},
+		{name: "first supported language", acceptLanguage: "de-DE, ru;q=0.8, en;q=0.5", orderLocale: "en", want: "ru"},
+		{name: "order locale", acceptLanguage: "", orderLocale: "ru", want: "ru"},
+		{name: "order locale after unsupported header", acceptLanguage: "fr-FR", orderLocale: "RU", want: "ru"},
+		{name: "default", acceptLanguage: "fr", orderLocale: "de", want: DefaultLocale},
+		{name: "nothing given", want: DefaultLocale},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(tt.acceptLanguage, tt.orderLocale); got != tt.want {
+				t.Errorf("Negotiate(%q, %q) = %q, want %q", tt.acceptLanguage, tt.orderLocale, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabels(t *testing.T) {
+	en, ru := Labels("en"), Labels("ru")
+	tests := []struct {
+		key, wantEN, wantRU string
+	}{
+		{key: "status", wantEN: "Status", wantRU: "Статус"},
+		{key: "delivery", wantEN: "Delivery", wantRU: "Доставка"},
+		{key: "total_price", wantEN: "Total price", wantRU: "Итоговая цена"},
+	}
+	for _, tt := range tests {
+		if en[tt.key] != tt.wantEN || ru[tt.key] != tt.wantRU {
+			t.Errorf("labels for %s = %q, %q, want %q, %q", tt.key, en[tt.key], ru[tt.key], tt.wantEN, tt.wantRU)
+		}
+	}
+	// Every locale labels the same fields
+	for key := range en {
+		if ru[key] == "" {
+			t.Errorf("ru has no label for %s", key)
+		}
+	}
+	if got := Labels("xx")["status"]; got != en["status"] {
+		t.Errorf("unsupported locale label = %q, want the default %q", got, en["status"])
+	}
+}
@@ -0,0 +1,110 @@
+// Package kafkatest provides an in-memory Kafka transport for testing code
+// that produces messages through kafka-go writers, without a broker
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+)
+
+// Transport is a kafka.RoundTripper that keeps every produced message in
+// memory. Every topic exists and has a single partition
+type Transport struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+	err      error
+}
+
+// Fail makes produce requests fail with err; nil makes them succeed again
+func (t *Transport) Fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+// Messages returns the messages produced so far, oldest first
+func (t *Transport) Messages() []kafka.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]kafka.Message(nil), t.messages...)
+}
+
+// RoundTrip answers metadata and produce requests
+func (t *Transport) RoundTrip(_ context.Context, _ net.Addr, req kafka.Request) (kafka.Response, error) {
+	switch req := req.(type) {
+	case *metadata.Request:
+		res := &metadata.Response{}
+		for _, name := range req.TopicNames {
+			res.Topics = append(res.Topics, metadata.ResponseTopic{
+				Name:       name,
+				Partitions: []metadata.ResponsePartition{{PartitionIndex: 0}},
+			})
+		}
+		return res, nil
+	case *produce.Request:
+		return t.produce(req)
+	}
+	return nil, fmt.Errorf("kafkatest: unsupported request %T", req)
+}
+
+func (t *Transport) produce(req *produce.Request) (*produce.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	res := &produce.Response{}
+	for _, topic := range req.Topics {
+		rt := produce.ResponseTopic{Topic: topic.Topic}
+		for _, partition := range topic.Partitions {
+			for {
+				record, err := partition.RecordSet.Records.ReadRecord()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				msg, err := message(topic.Topic, int(partition.Partition), record)
+				if err != nil {
+					return nil, err
+				}
+				msg.Offset = int64(len(t.messages))
+				t.messages = append(t.messages, msg)
+			}
+			rt.Partitions = append(rt.Partitions, produce.ResponsePartition{Partition: partition.Partition})
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+	return res, nil
+}
+
+// message copies a produced record, which is only valid until the next one is read
+func message(topic string, partition int, record *protocol.Record) (kafka.Message, error) {
+	msg := kafka.Message{Topic: topic, Partition: partition, Time: record.Time}
+	var err error
+	if record.Key != nil {
+		if msg.Key, err = protocol.ReadAll(record.Key); err != nil {
+			return kafka.Message{}, err
+		}
+	}
+	if record.Value != nil {
+		if msg.Value, err = protocol.ReadAll(record.Value); err != nil {
+			return kafka.Message{}, err
+		}
+	}
+	for _, h := range record.Headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: h.Key, Value: append([]byte(nil), h.Value...)})
+	}
+	return msg, nil
+}
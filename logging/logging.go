@@ -0,0 +1,41 @@
+// Package logging configures structured JSON logging via log/slog
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ParseLevel parses a level name (debug, info, warn, error); empty means info
+func ParseLevel(v string) (slog.Level, error) {
+	var level slog.Level
+	if v == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.ToUpper(v))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", v)
+	}
+	return level, nil
+}
+
+// Setup makes slog write JSON lines at or above level to stderr. It also
+// becomes the output of the standard log package, whose lines are logged at
+// info level
+func Setup(level slog.Level) {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// Message returns the attributes identifying a Kafka message, so the logs of
+// handling and committing it can be correlated
+func Message(msg kafka.Message) []any {
+	return []any{
+		"topic", msg.Topic,
+		"partition", msg.Partition,
+		"offset", msg.Offset,
+		"key", string(msg.Key),
+	}
+}
@@ -1,31 +1,52 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"orders-service/app"
+	"orders-service/config"
+	"os"
 )
 
 func main() {
-	db, err := app.InitializeDatabase()
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal("Failed to connect to PostgreSQL:", err)
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
 	}
-	defer db.Pool.Close()
+	app.InitializeLogging(cfg)
+	app.InitializeTracing()
 
-	c, err := app.InitializeCache(db)
+	db, err := app.InitializeDatabase(cfg.Database)
 	if err != nil {
-		log.Printf("Failed to initialize cache: %v", err)
+		slog.Error("Failed to connect to PostgreSQL", "error", err)
+		os.Exit(1)
 	}
 
-	reader := app.InitializeReader()
+	c, err := app.InitializeCache(cfg.Cache, db)
+	if err != nil {
+		slog.Error("Failed to initialize cache", "error", err)
+	}
+
+	sw := app.InitializeMaintenance(cfg)
+	h, err := app.InitializeHandler(cfg, db, c)
+	if err != nil {
+		slog.Error("Failed to initialize message handler", "error", err)
+		os.Exit(1)
+	}
+	consumer, err := app.NewConsumer(app.ReaderFactory(cfg.Kafka), h, sw, cfg.Consumer)
+	if err != nil {
+		slog.Error("Failed to initialize Kafka reader", "error", err)
+		os.Exit(1)
+	}
 
-	log.Println("Service started. Waiting for messages from Kafka...")
+	slog.Info("Service started, waiting for messages from Kafka")
 
-	app.RunHTTPServer(c, db)
+	srv := app.InitializeServer(cfg, c, db, consumer, sw)
+	app.RunHTTPServer(srv, cfg.HTTPAddr)
 
-	app.RunKafkaReader(reader, c, db)
+	app.RunKafkaReader(consumer)
 
-	app.SetupGracefulShutdown(c, reader)
+	app.SetupGracefulShutdown(srv, c, consumer, h, db, cfg.ShutdownTimeout)
 
 	select{}
 }
\ No newline at end of file
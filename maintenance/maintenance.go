@@ -0,0 +1,34 @@
+package maintenance
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// Switch toggles read-only maintenance mode, in which the consumer pauses and
+// mutating HTTP requests are refused while reads keep being served
+type Switch struct {
+	readOnly atomic.Bool
+}
+
+// New creates a switch in the given initial mode
+func New(readOnly bool) *Switch {
+	s := &Switch{}
+	s.readOnly.Store(readOnly)
+	if readOnly {
+		slog.Info("Starting in read-only mode")
+	}
+	return s
+}
+
+// ReadOnly reports whether read-only mode is on; a nil switch is never read-only
+func (s *Switch) ReadOnly() bool {
+	return s != nil && s.readOnly.Load()
+}
+
+// SetReadOnly turns read-only mode on or off
+func (s *Switch) SetReadOnly(on bool) {
+	if s.readOnly.Swap(on) != on {
+		slog.Info("Read-only mode changed", "read_only", on)
+	}
+}
@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// MessagesConsumed counts Kafka messages passed to the handler
+var MessagesConsumed = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "orders_kafka_messages_consumed_total",
+	Help: "Number of Kafka messages consumed.",
+})
+
+// OrdersPersisted counts orders successfully written to the database
+var OrdersPersisted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "orders_persisted_total",
+	Help: "Number of orders stored in the database.",
+})
+
+// DBErrors counts failed database operations, by operation
+var DBErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_db_errors_total",
+	Help: "Number of failed database operations, by operation.",
+}, []string{"operation"})
+
+// EmptyMessages counts Kafka messages received with an empty value
+var EmptyMessages = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "orders_empty_messages_total",
+	Help: "Number of Kafka messages received with an empty value.",
+})
+
+// DLQMessages counts messages routed to the dead-letter topic, by reason
+var DLQMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_dlq_messages_total",
+	Help: "Number of messages routed to the dead-letter topic.",
+}, []string{"reason"})
+
+// ReaderReconnects counts Kafka readers recreated after fatal read errors
+var ReaderReconnects = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "orders_kafka_reader_reconnects_total",
+	Help: "Number of times the Kafka reader was recreated after a fatal read error.",
+})
+
+// ConflictingDuplicates counts duplicate orders whose content differs from the stored copy
+var ConflictingDuplicates = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "orders_conflicting_duplicates_total",
+	Help: "Number of duplicate orders whose content differs from the stored copy.",
+})
+
+// ProcessTimeouts counts messages abandoned after exceeding the processing deadline
+var ProcessTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "orders_process_timeouts_total",
+	Help: "Number of messages abandoned after exceeding the processing deadline.",
+})
+
+// OrderItemCount observes the number of items in each ingested order
+var OrderItemCount = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "order_item_count",
+	Help:    "Number of items per ingested order.",
+	Buckets: []float64{1, 2, 3, 5, 10, 20, 50, 100},
+})
+
+// UnmarshalErrors counts messages that could not be decoded, by kind: schema
+// (rejected by the order JSON Schema), type (a field has the wrong JSON
+// type), syntax (malformed JSON) or other
+var UnmarshalErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_unmarshal_errors_total",
+	Help: "Number of messages that failed to decode, by kind (schema, type, syntax, other).",
+}, []string{"kind"})
+
+// MakeOrderDuration observes how long the MakeOrder transaction takes
+var MakeOrderDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "orders_make_order_duration_seconds",
+	Help:    "Duration of the order insert transaction, in seconds.",
+	Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+})
+
+// MessageLag observes the time between a message being produced and handled
+var MessageLag = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "orders_message_lag_seconds",
+	Help:    "Time between a Kafka message being produced and handled, in seconds.",
+	Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+})
+
+// FutureMessages counts messages whose timestamp lies in the future, which
+// points at clock skew on the producer
+var FutureMessages = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "orders_future_timestamp_messages_total",
+	Help: "Number of messages with a timestamp in the future, clamped to now.",
+})
+
+// WebhookDeliveries counts outbound webhook notifications, by result
+var WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_webhook_deliveries_total",
+	Help: "Number of order webhook notifications by result (delivered, failed, dropped).",
+}, []string{"result"})
+
+// OrderEvents counts order events sent to the events topic, by result
+var OrderEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_events_total",
+	Help: "Number of order events published to the events topic by result (published, failed).",
+}, []string{"result"})
+
+// CacheEntries reports the number of live entries in the order cache
+var CacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "cache_entries",
+	Help: "Number of unexpired entries in the order cache.",
+})
+
+// CacheEstimatedBytes reports the estimated memory held by cached orders
+var CacheEstimatedBytes = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "cache_estimated_bytes",
+	Help: "Estimated memory held by cached orders, in bytes.",
+})
+
+// OrdersSkipped counts messages committed without storing an order, by reason
+// (cache_dup, db_dup, empty, filtered, invalid)
+var OrdersSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_skipped_total",
+	Help: "Number of messages committed without storing an order, by reason.",
+}, []string{"reason"})
+
+// CacheEvictions counts entries evicted to keep the cache within its size limit
+var CacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "cache_evictions_total",
+	Help: "Number of least recently used entries evicted from the full cache.",
+})
+
+// CacheRefreshes counts refresh-ahead reloads of cache entries near expiry,
+// by result: refreshed, gone (deleted from the DB) or error
+var CacheRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_refreshes_total",
+	Help: "Number of cache entries reloaded ahead of expiry, by result (refreshed, gone, error).",
+}, []string{"result"})
+
+// CacheWarmerRuns counts batch loads triggered by cache miss spikes
+var CacheWarmerRuns = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "cache_warmer_runs_total",
+	Help: "Number of batch cache loads triggered by a spike of cache misses.",
+})
+
+// CacheSaveErrors counts failed cache file saves, by reason
+// (disk_full, permission, other)
+var CacheSaveErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_save_errors_total",
+	Help: "Number of failed cache file saves, by reason.",
+}, []string{"reason"})
+
+// Snapshot returns the current value of every counter and gauge in the
+// default registry whose name starts with prefix, keyed as name{label="value"}
+func Snapshot(prefix string) (map[string]float64, error) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]float64)
+	for _, mf := range families {
+		if !strings.HasPrefix(mf.GetName(), prefix) {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			var v float64
+			switch {
+			case m.GetCounter() != nil:
+				v = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				v = m.GetGauge().GetValue()
+			default:
+				continue
+			}
+
+			labels := make([]string, 0, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+`="`+l.GetValue()+`"`)
+			}
+			sort.Strings(labels)
+
+			key := mf.GetName()
+			if len(labels) > 0 {
+				key += "{" + strings.Join(labels, ",") + "}"
+			}
+			values[key] = v
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,4 @@
+-- MakeOrder detects duplicates with INSERT ... ON CONFLICT (order_uid), which
+-- needs a unique index on orders.order_uid. Harmless if order_uid already is
+-- the primary key.
+CREATE UNIQUE INDEX IF NOT EXISTS orders_order_uid_key ON orders (order_uid);
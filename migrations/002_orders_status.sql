@@ -0,0 +1,3 @@
+-- Orders carry a lifecycle status (created, paid, shipped, delivered,
+-- cancelled); existing orders start as created.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'created';
@@ -0,0 +1,10 @@
+-- Every change made to an order through the API is recorded here: the JSON
+-- Patch applied, the replacement order of a PUT, or the new status.
+CREATE TABLE IF NOT EXISTS order_audit (
+    id         bigserial PRIMARY KEY,
+    order_uid  text NOT NULL,
+    action     text NOT NULL,
+    change     jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS order_audit_order_uid_idx ON order_audit (order_uid, id);
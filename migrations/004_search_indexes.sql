@@ -0,0 +1,6 @@
+-- Indexes behind GET /api/search: a prefix match on order_uid, which needs
+-- text_pattern_ops unless the database uses the C collation, and exact
+-- matches on track_number and customer_id.
+CREATE INDEX IF NOT EXISTS orders_order_uid_pattern_idx ON orders (order_uid text_pattern_ops);
+CREATE INDEX IF NOT EXISTS orders_track_number_idx ON orders (track_number);
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id);
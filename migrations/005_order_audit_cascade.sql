@@ -0,0 +1,13 @@
+-- Audit entries hold copies of the order (a PUT records the whole
+-- replacement, with the customer's delivery and payment details), so they
+-- are deleted with it: erasing a customer's orders must not leave their data
+-- behind in the audit trail. Entries of orders already deleted are dropped
+-- first, as the foreign key can't be added while they exist.
+DELETE FROM order_audit a WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.order_uid = a.order_uid);
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'order_audit_order_uid_fkey') THEN
+        ALTER TABLE order_audit ADD CONSTRAINT order_audit_order_uid_fkey
+            FOREIGN KEY (order_uid) REFERENCES orders (order_uid) ON DELETE CASCADE;
+    END IF;
+END $$;
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Diff returns the JSON paths of fields that differ between two orders,
+// e.g. "delivery.city" or "items[1].price"; it is empty when they match
+func (o Order) Diff(other Order) []string {
+	var diffs []string
+	diffValues("", reflect.ValueOf(o), reflect.ValueOf(other), &diffs)
+	return diffs
+}
+
+func diffValues(path string, a, b reflect.Value, diffs *[]string) {
+	switch {
+	case a.Type() == timeType:
+		if !a.Interface().(time.Time).Equal(b.Interface().(time.Time)) {
+			*diffs = append(*diffs, path)
+		}
+	case a.Kind() == reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			name := a.Type().Field(i).Tag.Get("json")
+			if path != "" {
+				name = path + "." + name
+			}
+			diffValues(name, a.Field(i), b.Field(i), diffs)
+		}
+	case a.Kind() == reflect.Slice:
+		if a.Len() != b.Len() {
+			*diffs = append(*diffs, path)
+			return
+		}
+		for i := 0; i < a.Len(); i++ {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i), diffs)
+		}
+	default:
+		if !a.Equal(b) {
+			*diffs = append(*diffs, path)
+		}
+	}
+}
@@ -19,6 +19,7 @@ type Order struct {
 	SmID              int       `json:"sm_id" db:"sm_id"`
 	DateCreated       time.Time `json:"date_created" db:"date_created"`
 	OofShard          string    `json:"oof_shard" db:"oof_shard"`
+	Status            string    `json:"status" db:"status"`
 }
 
 type Delivery struct {
@@ -44,6 +45,16 @@ type Payment struct {
 	CustomFee    int    `json:"custom_fee" db:"custom_fee"`
 }
 
+// IsZero reports whether the delivery is missing, i.e. the order arrived without one
+func (d Delivery) IsZero() bool {
+	return d == Delivery{}
+}
+
+// IsZero reports whether the payment is missing, i.e. the order arrived without one
+func (p Payment) IsZero() bool {
+	return p == Payment{}
+}
+
 type Item struct {
 	ChrtID      int    `json:"chrt_id" db:"chrt_id"`
 	TrackNumber string `json:"track_number" db:"track_number"`
@@ -59,16 +70,26 @@ type Item struct {
 }
 
 type ItemInfo struct {
-	TrackNumber string `json:"track_number"`
-	Name        string `json:"name"`
-	Price       int    `json:"price"`
-	Sale        int    `json:"sale"`
-	Size        string `json:"size"`
-	TotalPrice  int    `json:"total_price"`
-	Brand       string `json:"brand"`
+	ChrtID      int    `json:"chrt_id" db:"chrt_id"`
+	TrackNumber string `json:"track_number" db:"track_number"`
+	Price       int    `json:"price" db:"price"`
+	RID         string `json:"rid" db:"rid"`
+	Name        string `json:"name" db:"name"`
+	Sale        int    `json:"sale" db:"sale"`
+	Size        string `json:"size" db:"size"`
+	TotalPrice  int    `json:"total_price" db:"total_price"`
+	NmID        int    `json:"nm_id" db:"nm_id"`
+	Brand       string `json:"brand" db:"brand"`
+	Status      int    `json:"status" db:"status"`
 }
 
 type Request struct {
 	Action   string `json:"action"`
 	OrderUID string `json:"order_uid"`
-}
\ No newline at end of file
+}
+
+type ShardCount struct {
+	Shardkey string `json:"shardkey" db:"shardkey"`
+	OofShard string `json:"oof_shard" db:"oof_shard"`
+	Orders   int    `json:"orders" db:"orders"`
+}
@@ -0,0 +1,52 @@
+package model_test
+
+import (
+	"orders-service/model"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{from: model.StatusCreated, to: model.StatusPaid, want: true},
+		{from: model.StatusCreated, to: model.StatusCancelled, want: true},
+		{from: model.StatusPaid, to: model.StatusShipped, want: true},
+		{from: model.StatusPaid, to: model.StatusCancelled, want: true},
+		{from: model.StatusShipped, to: model.StatusDelivered, want: true},
+		{from: model.StatusCreated, to: model.StatusShipped, want: false},
+		{from: model.StatusCreated, to: model.StatusCreated, want: false},
+		{from: model.StatusShipped, to: model.StatusCancelled, want: false},
+		{from: model.StatusDelivered, to: model.StatusCreated, want: false},
+		{from: model.StatusCancelled, to: model.StatusPaid, want: false},
+		{from: model.StatusCreated, to: "lost", want: false},
+		{from: "lost", to: model.StatusPaid, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			if got := model.CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{status: model.StatusCreated, want: true},
+		{status: model.StatusDelivered, want: true},
+		{status: model.StatusCancelled, want: true},
+		{status: "", want: false},
+		{status: "Created", want: false},
+		{status: "lost", want: false},
+	}
+	for _, tt := range tests {
+		if got := model.ValidStatus(tt.status); got != tt.want {
+			t.Errorf("ValidStatus(%q) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
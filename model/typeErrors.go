@@ -3,4 +3,6 @@ package model
 import "errors"
 
 var ErrOrderExists = errors.New("order already exists")
-var ErrOrderNotFound = errors.New("order not found")
\ No newline at end of file
+var ErrOrderNotFound = errors.New("order not found")
+var ErrPaymentNotFound = errors.New("payment not found")
+var ErrInvalidTransition = errors.New("invalid status transition")
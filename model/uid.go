@@ -0,0 +1,15 @@
+package model
+
+import "regexp"
+
+// MaxOrderUIDLength is the longest order UID accepted
+const MaxOrderUIDLength = 64
+
+// orderUIDPattern is the alphabet of order UIDs
+var orderUIDPattern = regexp.MustCompile(`^[a-zA-Z0-9\-]+$`)
+
+// ValidOrderUID reports whether uid is a well-formed order UID: non-empty,
+// at most MaxOrderUIDLength characters of letters, digits and dashes
+func ValidOrderUID(uid string) bool {
+	return len(uid) <= MaxOrderUIDLength && orderUIDPattern.MatchString(uid)
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate checks that the order carries the fields required to store and
+// ship it, reporting every missing one at once. Mandatory are order_uid,
+// track_number, customer_id, at least one item, delivery with phone and
+// email, and payment with currency
+func (o Order) Validate() error {
+	return o.validate(false)
+}
+
+// ValidatePartial is Validate for orders that may arrive without delivery or
+// payment: a missing block passes, but one that is present must be complete
+func (o Order) ValidatePartial() error {
+	return o.validate(true)
+}
+
+func (o Order) validate(partial bool) error {
+	var problems []error
+	require := func(value, field string) {
+		if value == "" {
+			problems = append(problems, fmt.Errorf("%s is required", field))
+		}
+	}
+
+	require(o.OrderUID, "order_uid")
+	require(o.TrackNumber, "track_number")
+	require(o.CustomerID, "customer_id")
+	switch {
+	case !o.Delivery.IsZero():
+		require(o.Delivery.Phone, "delivery.phone")
+		require(o.Delivery.Email, "delivery.email")
+	case !partial:
+		problems = append(problems, errors.New("delivery is required"))
+	}
+	switch {
+	case !o.Payment.IsZero():
+		require(o.Payment.Currency, "payment.currency")
+	case !partial:
+		problems = append(problems, errors.New("payment is required"))
+	}
+	if o.Status != "" && !ValidStatus(o.Status) {
+		problems = append(problems, fmt.Errorf("unknown status %q", o.Status))
+	}
+	if len(o.Items) == 0 {
+		problems = append(problems, errors.New("at least one item is required"))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid order %s: %w", o.OrderUID, errors.Join(problems...))
+}
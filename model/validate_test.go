@@ -0,0 +1,86 @@
+package model_test
+
+import (
+	"orders-service/model"
+	"orders-service/ordertest"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *model.Order)
+		want   []string // problems reported by Validate; none for a valid order
+		// wantPartial are the problems ValidatePartial reports, when they differ
+		wantPartial []string
+	}{
+		{name: "valid", modify: func(*model.Order) {}},
+		{name: "order_uid", modify: func(o *model.Order) { o.OrderUID = "" }, want: []string{"order_uid is required"}},
+		{name: "track_number", modify: func(o *model.Order) { o.TrackNumber = "" }, want: []string{"track_number is required"}},
+		{name: "customer_id", modify: func(o *model.Order) { o.CustomerID = "" }, want: []string{"customer_id is required"}},
+		{name: "no items", modify: func(o *model.Order) { o.Items = nil }, want: []string{"at least one item is required"}},
+		{name: "delivery phone", modify: func(o *model.Order) { o.Delivery.Phone = "" }, want: []string{"delivery.phone is required"}},
+		{name: "delivery email", modify: func(o *model.Order) { o.Delivery.Email = "" }, want: []string{"delivery.email is required"}},
+		{name: "payment currency", modify: func(o *model.Order) { o.Payment.Currency = "" }, want: []string{"payment.currency is required"}},
+		{name: "unknown status", modify: func(o *model.Order) { o.Status = "teleported" }, want: []string{`unknown status "teleported"`}},
+		{
+			name:        "no delivery",
+			modify:      func(o *model.Order) { o.Delivery = model.Delivery{} },
+			want:        []string{"delivery is required"},
+			wantPartial: []string{},
+		},
+		{
+			name:        "no payment",
+			modify:      func(o *model.Order) { o.Payment = model.Payment{} },
+			want:        []string{"payment is required"},
+			wantPartial: []string{},
+		},
+		{
+			name: "every problem at once",
+			modify: func(o *model.Order) {
+				o.TrackNumber, o.CustomerID, o.Items = "", "", nil
+				o.Delivery.Email, o.Payment.Currency = "", ""
+			},
+			want: []string{"track_number is required", "customer_id is required", "delivery.email is required",
+				"payment.currency is required", "at least one item is required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("b563feb7b2b84b6test")
+			tt.modify(&order)
+
+			checkProblems(t, "Validate", order.Validate(), tt.want)
+			wantPartial := tt.wantPartial
+			if wantPartial == nil {
+				wantPartial = tt.want
+			}
+			checkProblems(t, "ValidatePartial", order.ValidatePartial(), wantPartial)
+		})
+	}
+}
+
+// checkProblems asserts that err lists exactly the want problems
+func checkProblems(t *testing.T, name string, err error, want []string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Errorf("%s: %v, want no error", name, err)
+		}
+		return
+	}
+	if err == nil {
+		t.Errorf("%s succeeded, want %q", name, want)
+		return
+	}
+	for _, problem := range want {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("%s error %q does not report %q", name, err, problem)
+		}
+	}
+	// errors.Join puts each problem on its own line
+	if got := strings.Count(err.Error(), "\n") + 1; got != len(want) {
+		t.Errorf("%s reported %d problems, want %d: %v", name, got, len(want), err)
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"orders-service/cache"
+	"orders-service/model"
+	"strings"
+)
+
+// requireAdmin rejects requests that don't carry the configured admin bearer token
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.opts.AdminToken == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+
+		if !s.isAdmin(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// isAdmin reports whether the request carries the configured admin bearer token
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.opts.AdminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.AdminToken)) == 1
+}
+
+// cacheFlushHandler handles POST /admin/cache/flush: empties the cache and
+// resets its stats
+func (s *Server) cacheFlushHandler(w http.ResponseWriter, r *http.Request) {
+	flushed := s.Cache.Flush()
+	slog.Info("Cache flushed manually", "removed", flushed)
+	s.sendJSON(w, struct {
+		Flushed int `json:"flushed"`
+	}{
+		Flushed: flushed,
+	})
+}
+
+// cacheSaveHandler handles POST /admin/cache/save: checkpoints the cache to disk
+func (s *Server) cacheSaveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	saved, err := s.Cache.SaveToFile()
+	if err != nil {
+		slog.Error("Manual cache save failed", "error", err)
+		http.Error(w, "Failed to save cache", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Cache saved manually", "entries", saved, "file", s.Cache.File())
+	s.sendJSON(w, struct {
+		Saved int    `json:"saved"`
+		File  string `json:"file"`
+	}{
+		Saved: saved,
+		File:  s.Cache.File(),
+	})
+}
+
+// registerPprof exposes the profiling endpoints on the server's mux behind admin
+// auth; net/http/pprof only registers itself on http.DefaultServeMux, which the
+// server never serves
+func (s *Server) registerPprof() {
+	s.mux.HandleFunc("/debug/pprof/", s.requireAdmin(pprof.Index))
+	s.mux.HandleFunc("/debug/pprof/cmdline", s.requireAdmin(pprof.Cmdline))
+	s.mux.HandleFunc("/debug/pprof/profile", s.requireAdmin(pprof.Profile))
+	s.mux.HandleFunc("/debug/pprof/symbol", s.requireAdmin(pprof.Symbol))
+	s.mux.HandleFunc("/debug/pprof/trace", s.requireAdmin(pprof.Trace))
+	slog.Info("pprof endpoints enabled", "path", "/debug/pprof/")
+}
+
+// readOnlyHandler handles /admin/read-only: GET reports the maintenance mode,
+// POST {"read_only": bool} switches it
+func (s *Server) readOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	if s.Maintenance == nil {
+		http.Error(w, "Maintenance mode is not available", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			ReadOnly *bool `json:"read_only"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReadOnly == nil {
+			http.Error(w, `Expected {"read_only": true|false}`, http.StatusBadRequest)
+			return
+		}
+		s.Maintenance.SetReadOnly(*req.ReadOnly)
+	default:
+		http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.sendJSON(w, struct {
+		ReadOnly bool `json:"read_only"`
+	}{
+		ReadOnly: s.Maintenance.ReadOnly(),
+	})
+}
+
+// cacheReloadHandler handles POST /admin/cache/reload: replaces the cache
+// contents with every order in the DB
+func (s *Server) cacheReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	loaded, err := s.Cache.Reload(cache.NoExpiration, func(add func(model.Order)) error {
+		return s.Database.StreamAllOrders(r.Context(), func(order model.Order) error {
+			add(order)
+			return nil
+		})
+	})
+	if err != nil {
+		slog.Error("Cache reload failed, keeping current contents", "error", err)
+		http.Error(w, "Failed to reload cache", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Cache reloaded from DB", "orders", loaded)
+	s.sendJSON(w, struct {
+		Loaded int `json:"loaded"`
+	}{
+		Loaded: loaded,
+	})
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheSaveHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		orders     int
+		method     string
+		token      string
+		wantStatus int
+	}{
+		{name: "saves entries", orders: 3, method: http.MethodPost, token: testAdminToken, wantStatus: http.StatusOK},
+		{name: "saves empty cache", orders: 0, method: http.MethodPost, token: testAdminToken, wantStatus: http.StatusOK},
+		{name: "wrong method", orders: 1, method: http.MethodGet, token: testAdminToken, wantStatus: http.StatusMethodNotAllowed},
+		{name: "no token", orders: 1, method: http.MethodPost, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "cache.gob")
+			c := cache.New(file, cache.Options{})
+			for i := range tt.orders {
+				c.Set(ordertest.Order(fmt.Sprintf("save-%d", i)), cache.DefaultTTL)
+			}
+			s := newTestServer(t, c, nil, Options{AdminToken: testAdminToken})
+
+			req := adminRequest(tt.method, "/admin/cache/save", nil)
+			if tt.token == "" {
+				req.Header.Del("Authorization")
+			}
+			rec := serve(s, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if _, err := os.Stat(file); err == nil {
+					t.Error("cache file written by a refused request")
+				}
+				return
+			}
+
+			var resp struct {
+				Saved int    `json:"saved"`
+				File  string `json:"file"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.Saved != tt.orders || resp.File != file {
+				t.Errorf("response = %+v, want saved %d to %s", resp, tt.orders, file)
+			}
+			if _, err := os.Stat(file); err != nil {
+				t.Fatalf("cache file not written: %v", err)
+			}
+
+			loaded := cache.New(file, cache.Options{})
+			t.Cleanup(loaded.Stop)
+			if err := loaded.LoadFromFile(); err != nil {
+				t.Fatalf("loading saved file: %v", err)
+			}
+			if loaded.Len() != tt.orders {
+				t.Errorf("saved file holds %d orders, want %d", loaded.Len(), tt.orders)
+			}
+		})
+	}
+}
+
+func TestPprofEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "index enabled", enabled: true, path: "/debug/pprof/", token: testAdminToken, wantStatus: http.StatusOK},
+		{name: "profile enabled", enabled: true, path: "/debug/pprof/heap", token: testAdminToken, wantStatus: http.StatusOK},
+		{name: "cmdline enabled", enabled: true, path: "/debug/pprof/cmdline", token: testAdminToken, wantStatus: http.StatusOK},
+		{name: "enabled without token", enabled: true, path: "/debug/pprof/", wantStatus: http.StatusUnauthorized},
+		{name: "index disabled", enabled: false, path: "/debug/pprof/", token: testAdminToken, wantStatus: http.StatusNotFound},
+		{name: "cmdline disabled", enabled: false, path: "/debug/pprof/cmdline", token: testAdminToken, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{AdminToken: testAdminToken, EnablePprof: tt.enabled})
+
+			req := adminRequest(http.MethodGet, tt.path, nil)
+			if tt.token == "" {
+				req.Header.Del("Authorization")
+			}
+			if rec := serve(s, req); rec.Code != tt.wantStatus {
+				t.Errorf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCacheReloadHandler(t *testing.T) {
+	db := testDatabase(t)
+	seeded := []string{"reload-1", "reload-2", "reload-3"}
+	for _, uid := range seeded {
+		storeTestOrder(t, db, ordertest.Order(uid))
+	}
+
+	tests := []struct {
+		name       string
+		cached     []string // orders in the cache before the reload
+		method     string
+		wantStatus int
+	}{
+		{name: "cold cache", method: http.MethodPost, wantStatus: http.StatusOK},
+		{name: "stale entry", cached: []string{"reload-1", "reload-stale"}, method: http.MethodPost, wantStatus: http.StatusOK},
+		{name: "wrong method", cached: []string{"reload-stale"}, method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+			for _, uid := range tt.cached {
+				s.Cache.Set(ordertest.Order(uid), cache.DefaultTTL)
+			}
+
+			rec := serve(s, adminRequest(tt.method, "/admin/cache/reload", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if n := s.Cache.Len(); n != len(tt.cached) {
+					t.Errorf("refused request changed the cache to %d entries", n)
+				}
+				return
+			}
+
+			var resp struct {
+				Loaded int `json:"loaded"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.Loaded != s.Cache.Len() {
+				t.Errorf("reported %d loaded orders, cache holds %d", resp.Loaded, s.Cache.Len())
+			}
+			for _, uid := range seeded {
+				if _, found := s.Cache.Peek(uid); !found {
+					t.Errorf("seeded order %s not in the reloaded cache", uid)
+				}
+			}
+			if _, found := s.Cache.Peek("reload-stale"); found {
+				t.Error("order missing from the DB survived the reload")
+			}
+		})
+	}
+}
+
+func TestCacheFlushHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		orders     int
+		token      string
+		wantStatus int
+	}{
+		{name: "flushes entries", orders: 3, token: testAdminToken, wantStatus: http.StatusOK},
+		{name: "empty cache", orders: 0, token: testAdminToken, wantStatus: http.StatusOK},
+		{name: "no token", orders: 2, wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", orders: 2, token: "guess", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{AdminToken: testAdminToken})
+			var uids []string
+			for i := range tt.orders {
+				order := ordertest.Order(fmt.Sprintf("flush-%d", i))
+				s.Cache.Set(order, cache.DefaultTTL)
+				uids = append(uids, order.OrderUID)
+			}
+
+			req := adminRequest(http.MethodPost, "/admin/cache/flush", nil)
+			req.Header.Del("Authorization")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := serve(s, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if s.Cache.Len() != tt.orders {
+					t.Errorf("refused request left %d entries, want %d", s.Cache.Len(), tt.orders)
+				}
+				return
+			}
+
+			var resp struct {
+				Flushed int `json:"flushed"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.Flushed != tt.orders {
+				t.Errorf("flushed = %d, want %d", resp.Flushed, tt.orders)
+			}
+			for _, uid := range uids {
+				if _, found := s.Cache.Get(uid); found {
+					t.Errorf("order %s still cached", uid)
+				}
+			}
+		})
+	}
+}
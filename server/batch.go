@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/model"
+)
+
+// batchOrdersPath is where several orders can be fetched at once
+const batchOrdersPath = "/orders/batch"
+
+// maxBatchUIDs caps the number of orders fetched by a single batch request
+const maxBatchUIDs = 100
+
+// batchOrdersHandler handles POST /orders/batch {"order_uids": [...]}: returns
+// a map of UID to order, served from the cache with the misses loaded from the
+// DB in one query. Repeated UIDs are looked up once; UIDs without an order,
+// including cached ones whose items are gone from the DB, are left out
+func (s *Server) batchOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OrderUIDs []string `json:"order_uids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.OrderUIDs) == 0 {
+		http.Error(w, `Expected {"order_uids": ["..."]}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.OrderUIDs) > maxBatchUIDs {
+		http.Error(w, "Too many order UIDs", http.StatusBadRequest)
+		return
+	}
+
+	orders := make(map[string]model.Order, len(req.OrderUIDs))
+	seen := make(map[string]bool, len(req.OrderUIDs))
+	var misses []string
+	for _, uid := range req.OrderUIDs {
+		if !model.ValidOrderUID(uid) {
+			http.Error(w, "Invalid order ID "+uid, http.StatusBadRequest)
+			return
+		}
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+
+		order, found := s.Cache.Get(uid)
+		if !found {
+			misses = append(misses, uid)
+			continue
+		}
+		if s.Cache.LazyItems() {
+			items, err := s.orderItems(r.Context(), uid, nil)
+			if errors.Is(err, model.ErrOrderNotFound) {
+				// Deleted from the DB behind the cache's back
+				slog.Info("Cached order no longer in DB", "order_uid", uid)
+				s.Cache.Delete(uid)
+				continue
+			}
+			if err != nil {
+				slog.Error("Failed to load order items", "order_uid", uid, "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			order.Items = items
+		}
+		orders[uid] = order
+	}
+
+	if len(misses) > 0 {
+		stored, err := s.Database.GetOrders(r.Context(), misses)
+		if err != nil {
+			slog.Error("Failed to load orders", "count", len(misses), "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, order := range stored {
+			s.Cache.Set(order, cache.DefaultTTL)
+			if s.Cache.LazyItems() {
+				s.Cache.SetItems(order.OrderUID, order.Items)
+			}
+			orders[order.OrderUID] = order
+		}
+	}
+
+	for uid, order := range orders {
+		orders[uid] = s.orderView(r, order)
+	}
+	s.sendJSON(w, orders)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"orders-service/cache"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// batchRequest returns a batch lookup request for uids
+func batchRequest(t *testing.T, uids []string) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(map[string][]string{"order_uids": uids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewRequest(http.MethodPost, batchOrdersPath, strings.NewReader(string(body)))
+}
+
+func TestBatchOrdersHandler(t *testing.T) {
+	db := testDatabase(t)
+	cached := ordertest.Order("batch-cached")
+	stored := ordertest.Order("batch-stored")
+	storeTestOrder(t, db, stored)
+	_ = db.DeleteOrder(context.Background(), "batch-missing")
+
+	tests := []struct {
+		name string
+		uids []string
+		want []string
+	}{
+		{name: "cached only", uids: []string{cached.OrderUID}, want: []string{cached.OrderUID}},
+		{name: "stored only", uids: []string{stored.OrderUID}, want: []string{stored.OrderUID}},
+		{name: "missing only", uids: []string{"batch-missing"}},
+		{name: "mixed", uids: []string{cached.OrderUID, stored.OrderUID, "batch-missing"},
+			want: []string{cached.OrderUID, stored.OrderUID}},
+		{name: "repeated", uids: []string{stored.OrderUID, stored.OrderUID}, want: []string{stored.OrderUID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, db, Options{})
+			s.Cache.Set(cached, cache.DefaultTTL)
+
+			rec := serve(s, batchRequest(t, tt.uids))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			var orders map[string]model.Order
+			if err := json.NewDecoder(rec.Body).Decode(&orders); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			var got []string
+			for uid, order := range orders {
+				if order.OrderUID != uid {
+					t.Errorf("order %s keyed as %s", order.OrderUID, uid)
+				}
+				got = append(got, uid)
+			}
+			sort.Strings(got)
+			sort.Strings(tt.want)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("orders = %v, want %v", got, tt.want)
+			}
+			for _, uid := range tt.want {
+				if _, found := s.Cache.Peek(uid); !found {
+					t.Errorf("order %s not cached after the lookup", uid)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchOrdersHandlerRequest(t *testing.T) {
+	tooMany := make([]string, maxBatchUIDs+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("batch-%d", i)
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{name: "not JSON", req: httptest.NewRequest(http.MethodPost, batchOrdersPath, strings.NewReader("uids"))},
+		{name: "no UIDs", req: batchRequest(t, nil)},
+		{name: "too many UIDs", req: batchRequest(t, tooMany)},
+		{name: "invalid UID", req: batchRequest(t, []string{"batch-ok", "not/valid"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{})
+			if rec := serve(s, tt.req); rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+		})
+	}
+}
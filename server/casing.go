@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// camelCaseJSON re-encodes data with its object keys converted from
+// snake_case to camelCase, e.g. order_uid to orderUid
+func camelCaseJSON(data interface{}) (interface{}, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber() // keep large integers such as chrt_id exact
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return camelKeys(v), nil
+}
+
+// camelKeys converts the keys of all objects nested in v
+func camelKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[snakeToCamel(k)] = camelKeys(val)
+		}
+		return out
+	case []interface{}:
+		for i, val := range v {
+			v[i] = camelKeys(val)
+		}
+		return v
+	}
+	return v
+}
+
+// snakeToCamel converts a snake_case key to camelCase
+func snakeToCamel(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
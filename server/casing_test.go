@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnakeToCamel(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "order_uid", want: "orderUid"},
+		{in: "chrt_id", want: "chrtId"},
+		{in: "date_created", want: "dateCreated"},
+		{in: "locale", want: "locale"},
+		{in: "internal_signature", want: "internalSignature"},
+		{in: "a_b_c", want: "aBC"},
+		{in: "trailing_", want: "trailing"},
+		{in: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := snakeToCamel(tt.in); got != tt.want {
+			t.Errorf("snakeToCamel(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJSONKeyCasing(t *testing.T) {
+	order := ordertest.Order("key-casing")
+	tests := []struct {
+		name      string
+		camelCase bool
+		path      string
+		want      []string
+		dontWant  []string
+	}{
+		{
+			name:     "order snake case by default",
+			path:     "/order/" + order.OrderUID,
+			want:     []string{`"order_uid":`, `"track_number":`, `"date_created":`, `"chrt_id":9934930`},
+			dontWant: []string{`"orderUid":`, `"chrtId":`},
+		},
+		{
+			name: "order camel case", camelCase: true,
+			path:     "/order/" + order.OrderUID,
+			want:     []string{`"orderUid":`, `"trackNumber":`, `"dateCreated":`, `"chrtId":9934930`},
+			dontWant: []string{`"order_uid":`, `"chrt_id":`},
+		},
+		{
+			name:     "items snake case by default",
+			path:     "/order/" + order.OrderUID + "/items",
+			want:     []string{`"chrt_id":9934930`, `"total_price":317`, `"nm_id":2389212`},
+			dontWant: []string{`"chrtId":`},
+		},
+		{
+			name: "items camel case", camelCase: true,
+			path:     "/order/" + order.OrderUID + "/items",
+			want:     []string{`"chrtId":9934930`, `"totalPrice":317`, `"nmId":2389212`},
+			dontWant: []string{`"chrt_id":`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Lazily cached items let the items endpoint answer without a DB
+			c := cache.New(filepath.Join(t.TempDir(), "cache.gob"), cache.Options{LazyItems: true, ItemsTTL: time.Minute})
+			c.Set(order, cache.DefaultTTL)
+			c.SetItems(order.OrderUID, order.Items)
+			s := newTestServer(t, c, nil, Options{CamelCase: tt.camelCase})
+
+			rec := serveGet(t, s, tt.path)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			body := rec.Body.String()
+			for _, key := range tt.want {
+				if !strings.Contains(body, key) {
+					t.Errorf("body lacks %s: %s", key, body)
+				}
+			}
+			for _, key := range tt.dontWant {
+				if strings.Contains(body, key) {
+					t.Errorf("body contains %s: %s", key, body)
+				}
+			}
+		})
+	}
+}
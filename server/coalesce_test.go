@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"orders-service/ordertest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoalescedCacheMisses(t *testing.T) {
+	order := ordertest.Order("coalesce")
+
+	for _, n := range []int{2, 10, 50} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			db := testDatabase(t)
+			storeTestOrder(t, db, order)
+			// Slow loads make the concurrent requests overlap
+			db.Delay(50 * time.Millisecond)
+			s := newTestServer(t, nil, db, Options{CoalesceMisses: true})
+
+			var wg sync.WaitGroup
+			codes := make([]int, n)
+			for i := range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					codes[i] = serveGet(t, s, "/order/"+order.OrderUID).Code
+				}()
+			}
+			wg.Wait()
+
+			for i, code := range codes {
+				if code != http.StatusOK {
+					t.Errorf("request %d status = %d, want 200", i, code)
+				}
+			}
+			if got := db.Calls("GetOrder"); got != 1 {
+				t.Errorf("%d concurrent misses made %d loads, want 1", n, got)
+			}
+		})
+	}
+}
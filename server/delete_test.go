@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"strings"
+	"testing"
+)
+
+func TestDeleteOrderHandler(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name       string
+		stored     bool
+		cached     bool
+		token      string
+		wantStatus int
+		wantGet    int
+	}{
+		{name: "stored and cached", stored: true, cached: true, token: testAdminToken,
+			wantStatus: http.StatusNoContent, wantGet: http.StatusNotFound},
+		{name: "stored only", stored: true, token: testAdminToken,
+			wantStatus: http.StatusNoContent, wantGet: http.StatusNotFound},
+		{name: "missing", token: testAdminToken,
+			wantStatus: http.StatusNotFound, wantGet: http.StatusNotFound},
+		{name: "not admin", stored: true, cached: true, token: "wrong",
+			wantStatus: http.StatusUnauthorized, wantGet: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("delete-" + strings.ReplaceAll(tt.name, " ", "-"))
+			if tt.stored {
+				storeTestOrder(t, db, order)
+			} else {
+				_ = db.DeleteOrder(context.Background(), order.OrderUID)
+			}
+			s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+			if tt.cached {
+				s.Cache.Set(order, cache.DefaultTTL)
+			}
+
+			req := adminRequest(http.MethodDelete, "/order/"+order.OrderUID, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if rec := serve(s, req); rec.Code != tt.wantStatus {
+				t.Fatalf("DELETE status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec := serveGet(t, s, "/order/"+order.OrderUID); rec.Code != tt.wantGet {
+				t.Errorf("GET status = %d, want %d", rec.Code, tt.wantGet)
+			}
+			if _, found := s.Cache.Peek(order.OrderUID); found && tt.wantStatus == http.StatusNoContent {
+				t.Error("deleted order is still cached")
+			}
+		})
+	}
+}
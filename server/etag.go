@@ -0,0 +1,66 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"orders-service/model"
+	"strings"
+)
+
+// orderETag returns the entity tag of an order, a hash of its JSON, so it
+// changes with any of its fields. It identifies the stored order rather than
+// a representation of it: labels and key case don't change it. The order is
+// normalized first, so the same order read from the cache and from the DB
+// gets the same tag
+func orderETag(order model.Order) string {
+	order.DateCreated = order.DateCreated.UTC()
+	if len(order.Items) == 0 {
+		order.Items = nil
+	}
+	data, err := json.Marshal(order)
+	if err != nil {
+		// An order always encodes; an empty tag just never matches
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`"%x"`, sum[:16])
+}
+
+// etagMatches reports whether header, the value of an If-Match or
+// If-None-Match header, is "*" or lists etag. Weak tags (W/"...") only
+// match with weak comparison, which If-None-Match uses
+func etagMatches(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if after, found := strings.CutPrefix(tag, "W/"); found {
+			if !weak {
+				continue
+			}
+			tag = after
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the order's ETag on the response and replies 304 Not
+// Modified when If-None-Match lists it; it reports whether it replied
+func notModified(w http.ResponseWriter, r *http.Request, order model.Order) bool {
+	etag := orderETag(order)
+	w.Header().Set("ETag", etag)
+	if !etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: "*", want: true},
+		{header: `"abc"`, want: true},
+		{header: `"other", "abc"`, want: true},
+		{header: `"other"`, want: false},
+		{header: `W/"abc"`, weak: true, want: true},
+		{header: `W/"abc"`, want: false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"abc"`, tt.weak); got != tt.want {
+			t.Errorf("etagMatches(%q, weak %v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
+
+func TestOrderNotModified(t *testing.T) {
+	order := ordertest.Order("etag-get")
+	changed := ordertest.Order(order.OrderUID)
+	changed.Delivery.City = "Haifa"
+
+	tests := []struct {
+		name        string
+		cached      bool
+		lazyItems   bool
+		ifNoneMatch func(etag string) string
+		wantStatus  int
+	}{
+		{name: "no condition", wantStatus: http.StatusOK},
+		{name: "matching tag from the DB", ifNoneMatch: func(etag string) string { return etag }, wantStatus: http.StatusNotModified},
+		{name: "matching tag from the cache", cached: true, ifNoneMatch: func(etag string) string { return etag }, wantStatus: http.StatusNotModified},
+		{name: "matching tag with lazy items", cached: true, lazyItems: true, ifNoneMatch: func(etag string) string { return etag }, wantStatus: http.StatusNotModified},
+		{name: "weak matching tag", ifNoneMatch: func(etag string) string { return "W/" + etag }, wantStatus: http.StatusNotModified},
+		{name: "tag of another version", ifNoneMatch: func(string) string { return orderETag(changed) }, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDatabase(t)
+			storeTestOrder(t, db, order)
+			stored, err := db.GetOrder(context.Background(), order.OrderUID)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			etag := orderETag(stored)
+			var opts cache.Options
+			if tt.lazyItems {
+				opts = cache.Options{LazyItems: true, ItemsTTL: time.Minute}
+			}
+			c := cache.New(filepath.Join(t.TempDir(), "cache.gob"), opts)
+			s := newTestServer(t, c, db, Options{})
+			if tt.cached {
+				c.Set(stored, cache.DefaultTTL)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/order/"+order.OrderUID, nil)
+			if tt.ifNoneMatch != nil {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch(etag))
+			}
+			rec := serve(s, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %s, want %s", got, etag)
+			}
+			if tt.wantStatus == http.StatusNotModified && rec.Body.Len() > 0 {
+				t.Errorf("304 response has a body: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderPreconditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     bool
+		header     string
+		value      func(etag string) string
+		wantStatus int
+		wantCity   string // stored delivery city afterwards, "" when no order is stored
+	}{
+		{name: "if-match current", stored: true, header: "If-Match", value: func(etag string) string { return etag },
+			wantStatus: http.StatusOK, wantCity: "Haifa"},
+		{name: "if-match any", stored: true, header: "If-Match", value: func(string) string { return "*" },
+			wantStatus: http.StatusOK, wantCity: "Haifa"},
+		{name: "if-match stale", stored: true, header: "If-Match", value: func(string) string { return `"stale"` },
+			wantStatus: http.StatusPreconditionFailed, wantCity: "Kiryat Mozkin"},
+		{name: "if-match weak", stored: true, header: "If-Match", value: func(etag string) string { return "W/" + etag },
+			wantStatus: http.StatusPreconditionFailed, wantCity: "Kiryat Mozkin"},
+		{name: "if-match missing order", header: "If-Match", value: func(string) string { return "*" },
+			wantStatus: http.StatusPreconditionFailed},
+		{name: "create if absent", header: "If-None-Match", value: func(string) string { return "*" },
+			wantStatus: http.StatusOK, wantCity: "Haifa"},
+		{name: "create if absent conflict", stored: true, header: "If-None-Match", value: func(string) string { return "*" },
+			wantStatus: http.StatusPreconditionFailed, wantCity: "Kiryat Mozkin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDatabase(t)
+			order := ordertest.Order("etag-" + strings.ReplaceAll(tt.name, " ", "-"))
+			etag := ""
+			if tt.stored {
+				storeTestOrder(t, db, order)
+				stored, err := db.GetOrder(context.Background(), order.OrderUID)
+				if err != nil {
+					t.Fatalf("GetOrder: %v", err)
+				}
+				etag = orderETag(stored)
+			}
+			s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+
+			updated := ordertest.Order(order.OrderUID)
+			updated.Delivery.City = "Haifa"
+			body, err := json.Marshal(updated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := adminRequest(http.MethodPut, "/order/"+order.OrderUID, strings.NewReader(string(body)))
+			req.Header.Set(tt.header, tt.value(etag))
+			rec := serve(s, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			stored, err := db.GetOrder(context.Background(), order.OrderUID)
+			switch {
+			case tt.wantCity == "":
+				if err == nil {
+					t.Error("order stored despite the failed precondition")
+				}
+				return
+			case err != nil:
+				t.Fatalf("GetOrder: %v", err)
+			case stored.Delivery.City != tt.wantCity:
+				t.Errorf("stored city = %q, want %q", stored.Delivery.City, tt.wantCity)
+			}
+			if tt.wantStatus == http.StatusOK && rec.Header().Get("ETag") != orderETag(stored) {
+				t.Errorf("ETag = %s, want the one of the stored order %s", rec.Header().Get("ETag"), orderETag(stored))
+			}
+		})
+	}
+}
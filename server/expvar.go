@@ -0,0 +1,47 @@
+package server
+
+import (
+	"expvar"
+	"log/slog"
+	"orders-service/cache"
+	"orders-service/metrics"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	publishOnce sync.Once
+	// expvarCache is the cache of the server that registered expvar last;
+	// variables can only be published once per process
+	expvarCache atomic.Pointer[cache.Cache]
+)
+
+// registerExpvar publishes cache and processing stats through the standard
+// expvar package and serves them on /debug/vars behind admin auth, like
+// pprof, for environments without a Prometheus scraper
+func (s *Server) registerExpvar() {
+	expvarCache.Store(s.Cache)
+	publishOnce.Do(func() {
+		expvar.Publish("cache", expvar.Func(func() interface{} {
+			c := expvarCache.Load()
+			stats := c.Stats()
+			return map[string]interface{}{
+				"entries":         stats.Entries,
+				"estimated_bytes": c.EstimatedBytes(),
+				"hits":            stats.Hits,
+				"misses":          stats.Misses,
+				"evictions":       stats.Evictions,
+				"expirations":     stats.Expirations,
+			}
+		}))
+		expvar.Publish("processing", expvar.Func(func() interface{} {
+			values, err := metrics.Snapshot("orders_")
+			if err != nil {
+				slog.Error("Failed to gather metrics for expvar", "error", err)
+			}
+			return values
+		}))
+	})
+
+	s.mux.HandleFunc("/debug/vars", s.requireAdmin(expvar.Handler().ServeHTTP))
+}
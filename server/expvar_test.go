@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"testing"
+)
+
+func TestExpvarStats(t *testing.T) {
+	s := newTestServer(t, nil, nil, Options{AdminToken: testAdminToken, EnableExpvar: true})
+	s.Cache.Set(ordertest.Order("expvar-1"), cache.DefaultTTL)
+	s.Cache.Set(ordertest.Order("expvar-2"), cache.DefaultTTL)
+	s.Cache.Get("expvar-1")
+	s.Cache.Get("expvar-missing")
+
+	var vars struct {
+		Cache      map[string]float64 `json:"cache"`
+		Processing map[string]float64 `json:"processing"`
+		Memstats   json.RawMessage    `json:"memstats"`
+	}
+	rec := serve(s, adminRequest(http.MethodGet, "/debug/vars", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("decoding /debug/vars: %v", err)
+	}
+
+	checks := []struct {
+		name string
+		ok   bool
+	}{
+		{name: "cache.entries is 2", ok: vars.Cache["entries"] == 2},
+		{name: "cache.hits counted", ok: vars.Cache["hits"] >= 1},
+		{name: "cache.misses counted", ok: vars.Cache["misses"] >= 1},
+		{name: "cache.estimated_bytes positive", ok: vars.Cache["estimated_bytes"] > 0},
+		{name: "cache.evictions present", ok: hasKey(vars.Cache, "evictions")},
+		{name: "cache.expirations present", ok: hasKey(vars.Cache, "expirations")},
+		{name: "processing.orders_persisted_total present", ok: hasKey(vars.Processing, "orders_persisted_total")},
+		{name: "processing.orders_kafka_messages_consumed_total present", ok: hasKey(vars.Processing, "orders_kafka_messages_consumed_total")},
+		{name: "standard memstats kept", ok: len(vars.Memstats) > 0},
+	}
+	for _, c := range checks {
+		if !c.ok {
+			t.Errorf("%s: cache %v, processing %v", c.name, vars.Cache, vars.Processing)
+		}
+	}
+}
+
+func TestExpvarAccess(t *testing.T) {
+	enabled := newTestServer(t, nil, nil, Options{AdminToken: testAdminToken, EnableExpvar: true})
+	disabled := newTestServer(t, nil, nil, Options{AdminToken: testAdminToken})
+
+	tests := []struct {
+		name       string
+		server     *Server
+		token      string
+		wantStatus int
+	}{
+		{name: "admin", server: enabled, token: testAdminToken, wantStatus: http.StatusOK},
+		{name: "no token", server: enabled, wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", server: enabled, token: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "disabled", server: disabled, token: testAdminToken, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := adminRequest(http.MethodGet, "/debug/vars", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if rec := serve(tt.server, req); rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func hasKey(m map[string]float64, key string) bool {
+	_, ok := m[key]
+	return ok
+}
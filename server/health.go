@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// pageCheckTimeout bounds the backend checks made when rendering the index page
+const pageCheckTimeout = time.Second
+
+// defaultHealthTimeout bounds the DB ping of the probes when
+// Options.HealthTimeout is not set
+const defaultHealthTimeout = 2 * time.Second
+
+// PageStatus is passed to the index template so it can warn users when
+// the backing stores are unavailable
+type PageStatus struct {
+	Degraded bool
+	Problems []string
+}
+
+// ReadinessChecker reports whether a dependency is fit to receive traffic
+type ReadinessChecker interface {
+	Ready() error
+}
+
+// healthHandler handles GET /healthz: reports 503 unless the database answers
+// a ping within the health timeout
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	status, healthy := s.checkStores(r.Context())
+	s.sendStatus(w, status, healthy)
+}
+
+// readyHandler handles GET /readyz: like /healthz, and additionally reports
+// 503 until the Kafka consumer has connected and while it is unhealthy
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	status, ready := s.checkStores(r.Context())
+
+	status["consumer"] = "ok"
+	if s.Consumer != nil {
+		if err := s.Consumer.Ready(); err != nil {
+			status["consumer"] = err.Error()
+			ready = false
+		}
+	}
+
+	s.sendStatus(w, status, ready)
+}
+
+// checkStores reports the state of the cache and the database
+func (s *Server) checkStores(ctx context.Context) (map[string]string, bool) {
+	status := map[string]string{"db": "ok", "cache": "ok"}
+	healthy := true
+
+	if s.Cache == nil {
+		status["cache"] = "unavailable"
+		healthy = false
+	}
+
+	if s.Database == nil {
+		status["db"] = "unavailable"
+		return status, false
+	}
+
+	timeout := s.opts.HealthTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := s.Database.Ping(ctx); err != nil {
+		slog.Warn("Health check: database ping failed", "error", err)
+		status["db"] = err.Error()
+		healthy = false
+	}
+
+	return status, healthy
+}
+
+// sendStatus sends a probe result, with 503 when unhealthy
+func (s *Server) sendStatus(w http.ResponseWriter, status map[string]string, healthy bool) {
+	if !healthy {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	s.sendJSON(w, status)
+}
+
+// pageStatus checks the cache and database, collecting user-facing problems
+func (s *Server) pageStatus(ctx context.Context) PageStatus {
+	var status PageStatus
+	if s.Cache == nil {
+		status.Problems = append(status.Problems, "Кэш заказов недоступен")
+	}
+	if s.Database == nil {
+		status.Problems = append(status.Problems, "База данных недоступна")
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, pageCheckTimeout)
+		defer cancel()
+		if err := s.Database.Ping(ctx); err != nil {
+			slog.Warn("Index page: database unavailable", "error", err)
+			status.Problems = append(status.Problems, "База данных недоступна")
+		}
+	}
+	status.Degraded = len(status.Problems) > 0
+	return status
+}
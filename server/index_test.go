@@ -0,0 +1,66 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"orders-service/databasetest"
+	"strings"
+	"testing"
+)
+
+// unreachableDatabase returns a database that refuses every query
+func unreachableDatabase(t *testing.T) *databasetest.DB {
+	t.Helper()
+	db := databasetest.New()
+	db.Down(databasetest.ErrUnavailable)
+	return db
+}
+
+func TestIndexPageDegraded(t *testing.T) {
+	templates, err := template.ParseFiles("../templates/index.html")
+	if err != nil {
+		t.Fatalf("parsing templates: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		db           func(t *testing.T) *databasetest.DB
+		noCache      bool
+		wantProblems []string
+	}{
+		{name: "healthy", db: testDatabase},
+		{name: "database unreachable", db: unreachableDatabase, wantProblems: []string{"База данных недоступна"}},
+		{name: "no database", wantProblems: []string{"База данных недоступна"}},
+		{name: "no cache", db: unreachableDatabase, noCache: true, wantProblems: []string{"Кэш заказов недоступен", "База данных недоступна"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var db Store
+			if tt.db != nil {
+				db = tt.db(t)
+			}
+			s := newTestServer(t, nil, db, Options{})
+			s.templates = templates
+			if tt.noCache {
+				s.Cache = nil
+			}
+
+			rec := serveGet(t, s, "/")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			body := rec.Body.String()
+			if !strings.Contains(body, `id="orderID"`) {
+				t.Error("page lacks the order search form")
+			}
+			if got := strings.Contains(body, `class="banner"`); got != (len(tt.wantProblems) > 0) {
+				t.Errorf("banner shown = %v, want %v", got, len(tt.wantProblems) > 0)
+			}
+			for _, problem := range tt.wantProblems {
+				if !strings.Contains(body, "<li>"+problem+"</li>") {
+					t.Errorf("banner does not list %q", problem)
+				}
+			}
+		})
+	}
+}
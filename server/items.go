@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"orders-service/model"
+	"strconv"
+)
+
+// itemsHandler handles GET /order/{id}/items: returns the order's items with
+// all their fields, optionally only those with ?status=
+func (s *Server) itemsHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderUID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var status *int
+	if v := r.URL.Query().Get("status"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		status = &n
+	}
+
+	items, err := s.orderItems(r.Context(), orderID, status)
+	if errors.Is(err, model.ErrOrderNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to retrieve items", "order_uid", orderID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, items)
+}
+
+// orderItems returns the order's items, optionally only those with the given
+// status; with lazy item caching they are served from and added to the cache
+func (s *Server) orderItems(ctx context.Context, orderID string, status *int) ([]model.Item, error) {
+	if !s.Cache.LazyItems() {
+		return s.Database.Items(ctx, orderID, status)
+	}
+
+	items, found := s.Cache.GetItems(orderID)
+	if !found {
+		var err error
+		items, err = s.Database.Items(ctx, orderID, nil)
+		if err != nil {
+			return nil, err
+		}
+		s.Cache.SetItems(orderID, items)
+		slog.Info("Order items loaded from DB and added to cache", "order_uid", orderID)
+	}
+
+	if status == nil {
+		return items, nil
+	}
+	filtered := make([]model.Item, 0, len(items))
+	for _, item := range items {
+		if item.Status == *status {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// multiStatusOrder returns an order with two items of status 202 and one of
+// status 200
+func multiStatusOrder(uid string) model.Order {
+	order := ordertest.Order(uid)
+	item := order.Items[0]
+	order.Items = nil
+	for i, status := range []int{202, 200, 202} {
+		item.ChrtID = 9934930 + i
+		item.RID = fmt.Sprintf("ab4219087a764ae0btest%d", i)
+		item.Status = status
+		order.Items = append(order.Items, item)
+	}
+	return order
+}
+
+func TestItemsHandlerStatusFilter(t *testing.T) {
+	db := testDatabase(t)
+	order := multiStatusOrder("items-status")
+	storeTestOrder(t, db, order)
+
+	tests := []struct {
+		name      string
+		query     string
+		status    int // status every returned item must have, 0 for any
+		wantCount int
+		wantCode  int
+	}{
+		{name: "unfiltered", wantCount: 3, wantCode: http.StatusOK},
+		{name: "status 202", query: "?status=202", status: 202, wantCount: 2, wantCode: http.StatusOK},
+		{name: "status 200", query: "?status=200", status: 200, wantCount: 1, wantCode: http.StatusOK},
+		{name: "no match", query: "?status=404", status: 404, wantCount: 0, wantCode: http.StatusOK},
+		{name: "not numeric", query: "?status=done", wantCode: http.StatusBadRequest},
+	}
+	for _, lazy := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.name
+			if lazy {
+				name = "lazy items/" + name
+			}
+			t.Run(name, func(t *testing.T) {
+				c := cache.New(filepath.Join(t.TempDir(), "cache.gob"), cache.Options{LazyItems: lazy, ItemsTTL: time.Minute})
+				s := newTestServer(t, c, db, Options{})
+
+				rec := serveGet(t, s, "/order/"+order.OrderUID+"/items"+tt.query)
+				if rec.Code != tt.wantCode {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+				}
+				if tt.wantCode != http.StatusOK {
+					return
+				}
+				var items []model.Item
+				if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+					t.Fatalf("decoding items: %v", err)
+				}
+				if items == nil {
+					t.Error("items encoded as null, want an array")
+				}
+				if len(items) != tt.wantCount {
+					t.Fatalf("got %d items, want %d", len(items), tt.wantCount)
+				}
+				for _, item := range items {
+					if tt.status != 0 && item.Status != tt.status {
+						t.Errorf("item %d has status %d, want %d", item.ChrtID, item.Status, tt.status)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestLazyItemsLoadedOnDemand(t *testing.T) {
+	db := testDatabase(t)
+	order := multiStatusOrder("lazy-on-demand")
+	storeTestOrder(t, db, order)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "order endpoint", path: "/order/" + order.OrderUID},
+		{name: "items endpoint", path: "/order/" + order.OrderUID + "/items"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache.New(filepath.Join(t.TempDir(), "cache.gob"), cache.Options{LazyItems: true, ItemsTTL: time.Minute})
+			s := newTestServer(t, c, db, Options{})
+			// Only the header is cached, as after a restart
+			c.Set(order, cache.DefaultTTL)
+			if cached, _ := c.Peek(order.OrderUID); cached.Items != nil {
+				t.Fatal("lazy cache kept the order's items")
+			}
+
+			rec := serveGet(t, s, tt.path)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			items, found := c.GetItems(order.OrderUID)
+			if !found {
+				t.Fatal("items were not cached after the request")
+			}
+			if len(items) != len(order.Items) {
+				t.Errorf("cached %d items, want %d", len(items), len(order.Items))
+			}
+			if cached, _ := c.Peek(order.OrderUID); cached.Items != nil {
+				t.Error("items were added to the cached order")
+			}
+			if !strings.Contains(rec.Body.String(), `"chrt_id":9934932`) {
+				t.Errorf("response lacks the lazily loaded items: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestItemFieldsRoundTrip(t *testing.T) {
+	item := model.Item{
+		ChrtID:      9934931,
+		TrackNumber: "WBILMTESTTRACK",
+		Price:       453,
+		RID:         "ab4219087a764ae0bround",
+		Name:        "Mascaras",
+		Sale:        30,
+		Size:        "XL",
+		TotalPrice:  317,
+		NmID:        2389213,
+		Brand:       "Vivienne Sabo",
+		Status:      204,
+	}
+
+	tests := []struct {
+		name   string
+		stored bool // loaded from the DB on a cache miss rather than cached
+		opts   cache.Options
+	}{
+		{name: "cached"},
+		{name: "loaded from the database", stored: true},
+		{name: "lazy items", stored: true, opts: cache.Options{LazyItems: true, ItemsTTL: time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("round-trip-" + strings.ReplaceAll(tt.name, " ", "-"))
+			order.Items = []model.Item{item}
+			db := testDatabase(t)
+			if tt.stored {
+				storeTestOrder(t, db, order)
+			}
+			c := cache.New(filepath.Join(t.TempDir(), "cache.gob"), tt.opts)
+			s := newTestServer(t, c, db, Options{})
+			if !tt.stored {
+				c.Set(order, cache.DefaultTTL)
+			}
+
+			// The second request is served from the cache the first one filled
+			for _, pass := range []string{"first", "second"} {
+				rec := serveGet(t, s, "/order/"+order.OrderUID)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("%s request: status = %d, want 200", pass, rec.Code)
+				}
+				var got model.Order
+				if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+					t.Fatalf("%s request: decoding order: %v", pass, err)
+				}
+				if len(got.Items) != 1 || got.Items[0] != item {
+					t.Errorf("%s request: items = %+v, want [%+v]", pass, got.Items, item)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"orders-service/i18n"
+	"orders-service/model"
+	"strconv"
+)
+
+// localizedResponse wraps order data with field labels in the negotiated locale
+type localizedResponse struct {
+	Locale string            `json:"locale"`
+	Labels map[string]string `json:"labels"`
+	Order  interface{}       `json:"order"`
+}
+
+// sendOrder sends the order's view for the caller as JSON; with ?labels=true
+// it is wrapped together with localized field labels for the client's or the
+// order's locale
+func (s *Server) sendOrder(w http.ResponseWriter, r *http.Request, order model.Order) {
+	data := s.orderView(r, order)
+	if want, _ := strconv.ParseBool(r.URL.Query().Get("labels")); !want {
+		s.sendJSON(w, data)
+		return
+	}
+
+	locale := i18n.Negotiate(r.Header.Get("Accept-Language"), order.Locale)
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+	s.sendJSON(w, localizedResponse{
+		Locale: locale,
+		Labels: i18n.Labels(locale),
+		Order:  data,
+	})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"testing"
+)
+
+func TestLocalizedOrderLabels(t *testing.T) {
+	tests := []struct {
+		name           string
+		orderLocale    string
+		acceptLanguage string
+		wantLocale     string
+		wantStatus     string
+	}{
+		{name: "english order", orderLocale: "en", wantLocale: "en", wantStatus: "Status"},
+		{name: "russian order", orderLocale: "ru", wantLocale: "ru", wantStatus: "Статус"},
+		{name: "russian client", orderLocale: "en", acceptLanguage: "ru-RU,ru;q=0.9", wantLocale: "ru", wantStatus: "Статус"},
+		{name: "unsupported falls back", orderLocale: "de", acceptLanguage: "fr", wantLocale: "en", wantStatus: "Status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{})
+			order := ordertest.Order("localized")
+			order.Locale = tt.orderLocale
+			s.Cache.Set(order, cache.DefaultTTL)
+
+			req := httptest.NewRequest(http.MethodGet, "/order/"+order.OrderUID+"?labels=true", nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rec := serve(s, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Language"); got != tt.wantLocale {
+				t.Errorf("Content-Language = %q, want %q", got, tt.wantLocale)
+			}
+
+			var resp struct {
+				Locale string            `json:"locale"`
+				Labels map[string]string `json:"labels"`
+				Order  struct {
+					OrderUID string `json:"order_uid"`
+				} `json:"order"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.Locale != tt.wantLocale || resp.Labels["status"] != tt.wantStatus {
+				t.Errorf("locale %q with status label %q, want %q with %q", resp.Locale, resp.Labels["status"], tt.wantLocale, tt.wantStatus)
+			}
+			if resp.Order.OrderUID != order.OrderUID {
+				t.Errorf("wrapped order UID = %q, want %q", resp.Order.OrderUID, order.OrderUID)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"orders-service/cache"
+	"orders-service/databasetest"
+	"orders-service/handler"
+	"orders-service/ordertest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		dbDown bool
+		value  func(t *testing.T, uid string) []byte
+		want   []string
+	}{
+		{name: "undecodable", value: func(*testing.T, string) []byte { return []byte("{") },
+			want: []string{"orders_kafka_messages_consumed_total", "orders_unmarshal_errors_total"}},
+		{name: "database down", dbDown: true, value: orderJSON,
+			want: []string{"orders_kafka_messages_consumed_total", "orders_db_errors_total"}},
+		{name: "stored", value: orderJSON,
+			want: []string{"orders_kafka_messages_consumed_total", "orders_persisted_total", "orders_make_order_duration_seconds"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDatabase(t)
+			if tt.dbDown {
+				db.Down(databasetest.ErrUnavailable)
+			}
+			uid := "metrics-" + strings.ReplaceAll(tt.name, " ", "-")
+			c := cache.New(filepath.Join(t.TempDir(), "cache.gob"), cache.Options{})
+			s := newTestServer(t, c, db, Options{})
+
+			h := handler.New(db, c, handler.Options{})
+			_ = h.HandleOrder(context.Background(), kafka.Message{Key: []byte(uid), Value: tt.value(t, uid)})
+
+			rec := serveGet(t, s, "/metrics")
+			for _, name := range tt.want {
+				if !strings.Contains(rec.Body.String(), "\n"+name) {
+					t.Errorf("scrape does not contain %s", name)
+				}
+			}
+		})
+	}
+}
+
+// orderJSON returns a valid order with the given UID as JSON
+func orderJSON(t *testing.T, uid string) []byte {
+	t.Helper()
+	value, err := json.Marshal(ordertest.Order(uid))
+	if err != nil {
+		t.Fatalf("encoding order: %v", err)
+	}
+	return value
+}
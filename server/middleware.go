@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"net/http"
+	"orders-service/maintenance"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// traceRequests starts a server span for every request, continuing the
+// caller's trace when the request carries one
+func traceRequests(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.request")
+}
+
+// nameSpan renames the request span after the route that served it, e.g.
+// "GET /order/{id}/items"; it must wrap the mux directly to see the pattern
+func nameSpan(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if r.Pattern == "" {
+			return
+		}
+		name := r.Pattern
+		if !strings.Contains(name, " ") {
+			name = r.Method + " " + name
+		}
+		trace.SpanFromContext(r.Context()).SetName(name)
+	})
+}
+
+// allowCORS lets browsers on the allowed origins ("*" for any) call the API,
+// answering preflight requests itself. Without allowed origins no CORS
+// headers are set, so browsers keep requests same-origin
+func allowCORS(origins []string, next http.Handler) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+
+	allowed := func(origin string) bool {
+		for _, o := range origins {
+			if o == "*" || o == origin {
+				return true
+			}
+		}
+		return false
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if allowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
+		}
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Preflight
+		if allowed(origin) {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept-Language, "+RequestIDHeader)
+			w.Header().Set("Access-Control-Max-Age", "600")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// limitConcurrency caps the number of requests served at once, answering
+// 503 instead of queueing once the limit is reached
+func limitConcurrency(limit int, next http.Handler) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+
+	sem := make(chan struct{}, limit)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server is busy", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// limitRate caps order lookups (/order/..., /orders...) at perSecond requests
+// per second for the whole instance, answering 429 once the token bucket of
+// size burst is empty; burst defaults to perSecond rounded up
+func limitRate(perSecond float64, burst int, next http.Handler) http.Handler {
+	if perSecond <= 0 {
+		return next
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(perSecond))
+	}
+
+	limiter := rate.NewLimiter(rate.Limit(perSecond), burst)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/order") && !limiter.Allow() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// refuseWritesWhenReadOnly answers 503 to mutating requests while read-only
+// mode is on; admin endpoints stay reachable so the mode can be switched off
+func refuseWritesWhenReadOnly(sw *maintenance.Switch, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			// The batch lookup is a read despite being a POST
+			if sw.ReadOnly() && !strings.HasPrefix(r.URL.Path, "/admin/") && r.URL.Path != batchOrdersPath {
+				w.Header().Set("Retry-After", "60")
+				http.Error(w, "Service is in read-only mode", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withTimeout cancels the request context after d so a wedged DB connection
+// can't hold a request forever; admin and debug endpoints, which may
+// legitimately run long (reloads, profiles), are exempt
+func withTimeout(d time.Duration, next http.Handler) http.Handler {
+	if d <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/admin/") || strings.HasPrefix(r.URL.Path, "/debug/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDHeader carries the ID correlating a request with its log line;
+// a client-supplied ID is kept, otherwise one is generated
+const RequestIDHeader = "X-Request-ID"
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// logRequests logs every request with its ID, status and duration
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		slog.Info("HTTP request",
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+// newRequestID returns a random 16-character hex ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
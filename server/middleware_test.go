@@ -0,0 +1,213 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"orders-service/cache"
+	"orders-service/maintenance"
+	"orders-service/ordertest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		slow     int // requests held in the handler
+		wantBusy bool
+	}{
+		{name: "below limit", limit: 3, slow: 2, wantBusy: false},
+		{name: "at limit", limit: 2, slow: 2, wantBusy: true},
+		{name: "single slot", limit: 1, slow: 1, wantBusy: true},
+		{name: "no limit", limit: 0, slow: 5, wantBusy: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entered := make(chan struct{})
+			release := make(chan struct{})
+			handler := limitConcurrency(tt.limit, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow" {
+					entered <- struct{}{}
+					<-release
+				}
+			}))
+
+			var wg sync.WaitGroup
+			for range tt.slow {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+				}()
+				<-entered
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+			wantStatus := http.StatusOK
+			if tt.wantBusy {
+				wantStatus = http.StatusServiceUnavailable
+			}
+			if rec.Code != wantStatus {
+				t.Errorf("status with %d slow requests = %d, want %d", tt.slow, rec.Code, wantStatus)
+			}
+			if tt.wantBusy && rec.Header().Get("Retry-After") == "" {
+				t.Error("busy response has no Retry-After")
+			}
+
+			close(release)
+			wg.Wait()
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("status after the slow requests finished = %d, want 200", rec.Code)
+			}
+		})
+	}
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	sw := maintenance.New(true)
+	s := newTestServer(t, nil, nil, Options{AdminToken: testAdminToken})
+	s.Maintenance = sw
+	s.handler = refuseWritesWhenReadOnly(sw, s.mux)
+	order := ordertest.Order("read-only")
+	s.Cache.Set(order, cache.DefaultTTL)
+
+	patch := func() *http.Request {
+		req := adminRequest(http.MethodPatch, "/order/"+order.OrderUID, strings.NewReader(`[]`))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+	steps := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{name: "read served", req: httptest.NewRequest(http.MethodGet, "/order/"+order.OrderUID, nil), wantStatus: http.StatusOK},
+		{name: "delete refused", req: adminRequest(http.MethodDelete, "/order/"+order.OrderUID, nil), wantStatus: http.StatusServiceUnavailable},
+		{name: "replace refused", req: adminRequest(http.MethodPut, "/order/"+order.OrderUID, strings.NewReader(`{}`)), wantStatus: http.StatusServiceUnavailable},
+		{name: "patch refused", req: patch(), wantStatus: http.StatusServiceUnavailable},
+		{name: "batch lookup served", req: httptest.NewRequest(http.MethodPost, batchOrdersPath, strings.NewReader(`{"order_uids":["read-only"]}`)), wantStatus: http.StatusOK},
+		{name: "mode reported", req: adminRequest(http.MethodGet, "/admin/read-only", nil), wantStatus: http.StatusOK},
+		{name: "mode switched off", req: adminRequest(http.MethodPost, "/admin/read-only", strings.NewReader(`{"read_only":false}`)), wantStatus: http.StatusOK},
+		// Past the middleware, the handler rejects the content type itself
+		{name: "patch reaches handler", req: patch(), wantStatus: http.StatusUnsupportedMediaType},
+		{name: "read still served", req: httptest.NewRequest(http.MethodGet, "/order/"+order.OrderUID, nil), wantStatus: http.StatusOK},
+	}
+	for _, step := range steps {
+		rec := serve(s, step.req)
+		if rec.Code != step.wantStatus {
+			t.Errorf("%s: %s %s status = %d, want %d: %s", step.name, step.req.Method, step.req.URL.Path, rec.Code, step.wantStatus, rec.Body)
+		}
+	}
+	if sw.ReadOnly() {
+		t.Error("read-only mode still on after switching it off")
+	}
+}
+
+func TestLimitRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		perSecond float64
+		burst     int
+		path      string
+		requests  int
+		wantOK    int
+	}{
+		{name: "burst then limited", perSecond: 1, burst: 5, path: "/order/rate", requests: 20, wantOK: 5},
+		{name: "default burst", perSecond: 2.5, path: "/order/rate", requests: 10, wantOK: 3},
+		{name: "order listing", perSecond: 1, burst: 2, path: "/orders", requests: 10, wantOK: 2},
+		{name: "other paths exempt", perSecond: 1, burst: 1, path: "/healthz", requests: 10, wantOK: 10},
+		{name: "no limit", perSecond: 0, path: "/order/rate", requests: 50, wantOK: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := limitRate(tt.perSecond, tt.burst, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			ok := 0
+			for range tt.requests {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+				switch rec.Code {
+				case http.StatusOK:
+					ok++
+				case http.StatusTooManyRequests:
+					if rec.Header().Get("Retry-After") == "" {
+						t.Error("limited response has no Retry-After")
+					}
+				default:
+					t.Fatalf("status = %d, want 200 or 429", rec.Code)
+				}
+			}
+			if ok != tt.wantOK {
+				t.Errorf("%d of %d requests served, want %d", ok, tt.requests, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAllowCORS(t *testing.T) {
+	const front = "https://shop.example.com"
+	tests := []struct {
+		name        string
+		origins     []string
+		method      string
+		origin      string
+		preflight   bool // carries Access-Control-Request-Method
+		wantStatus  int
+		wantOrigin  string
+		wantMethods bool
+		wantNext    bool
+	}{
+		{name: "preflight allowed", origins: []string{front}, method: http.MethodOptions, origin: front, preflight: true,
+			wantStatus: http.StatusNoContent, wantOrigin: front, wantMethods: true},
+		{name: "preflight any origin", origins: []string{"*"}, method: http.MethodOptions, origin: front, preflight: true,
+			wantStatus: http.StatusNoContent, wantOrigin: front, wantMethods: true},
+		{name: "preflight other origin", origins: []string{front}, method: http.MethodOptions, origin: "https://evil.example.com", preflight: true,
+			wantStatus: http.StatusNoContent},
+		{name: "simple request", origins: []string{front}, method: http.MethodGet, origin: front,
+			wantStatus: http.StatusOK, wantOrigin: front, wantNext: true},
+		{name: "plain OPTIONS", origins: []string{front}, method: http.MethodOptions, origin: front,
+			wantStatus: http.StatusOK, wantOrigin: front, wantNext: true},
+		{name: "same origin", origins: []string{front}, method: http.MethodGet,
+			wantStatus: http.StatusOK, wantNext: true},
+		{name: "unset", method: http.MethodOptions, origin: front, preflight: true,
+			wantStatus: http.StatusOK, wantNext: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := allowCORS(tt.origins, http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+
+			req := httptest.NewRequest(tt.method, "/order/cors", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			methods := rec.Header().Get("Access-Control-Allow-Methods")
+			if (methods != "") != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want set %v", methods, tt.wantMethods)
+			}
+			if tt.wantMethods && !strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "Content-Type") {
+				t.Errorf("Access-Control-Allow-Headers = %q, want Content-Type allowed", rec.Header().Get("Access-Control-Allow-Headers"))
+			}
+			if called != tt.wantNext {
+				t.Errorf("next handler called = %v, want %v", called, tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/databasetest"
+	"orders-service/ordertest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrderNotFoundVersusDatabaseError(t *testing.T) {
+	tests := []struct {
+		name       string
+		db         func(t *testing.T) *databasetest.DB
+		path       string
+		cachedLazy bool // the order is cached without its items
+		wantStatus int
+	}{
+		{name: "order missing", db: testDatabase, wantStatus: http.StatusNotFound},
+		{name: "order database down", db: unreachableDatabase, wantStatus: http.StatusInternalServerError},
+		{name: "items missing", db: testDatabase, path: "/items", wantStatus: http.StatusNotFound},
+		{name: "items database down", db: unreachableDatabase, path: "/items", wantStatus: http.StatusInternalServerError},
+		{name: "cached order gone", db: testDatabase, cachedLazy: true, wantStatus: http.StatusNotFound},
+		{name: "cached order database down", db: unreachableDatabase, cachedLazy: true, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.db(t)
+			order := ordertest.Order("not-found-" + strings.ReplaceAll(tt.name, " ", "-"))
+			_ = db.DeleteOrder(context.Background(), order.OrderUID)
+			c := cache.New(filepath.Join(t.TempDir(), "cache.gob"), cache.Options{LazyItems: true, ItemsTTL: time.Minute})
+			s := newTestServer(t, c, db, Options{})
+			if tt.cachedLazy {
+				c.Set(order, cache.DefaultTTL)
+			}
+
+			rec := serveGet(t, s, "/order/"+order.OrderUID+tt.path)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			_, cached := c.Peek(order.OrderUID)
+			if wantCached := tt.cachedLazy && tt.wantStatus != http.StatusNotFound; cached != wantCached {
+				t.Errorf("order cached = %v, want %v", cached, wantCached)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"orders-service/database"
+	"orders-service/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultListLimit and maxListLimit are the default and largest page sizes of GET /orders
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// orderPage is a page of GET /orders along with the number of matching orders
+type orderPage struct {
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+	Items  []model.Order `json:"items"`
+}
+
+// ordersListHandler handles GET /orders: returns a page of the newest orders
+// (?limit=, ?offset=), optionally only those created within ?since= (a
+// duration relative to now, e.g. 24h or 7d), of ?customer_id= or shipped by
+// ?delivery_service=
+func (s *Server) ordersListHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultListLimit)
+	if err != nil || limit < 1 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxListLimit)
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	total, err := s.Database.CountOrders(r.Context(), filter)
+	if err != nil {
+		slog.Error("Failed to count orders", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	orders, err := s.Database.ListOrders(r.Context(), filter, limit, offset)
+	if err != nil {
+		slog.Error("Failed to list orders", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range orders {
+		orders[i] = s.orderView(r, orders[i])
+	}
+	s.sendJSON(w, orderPage{Total: total, Limit: limit, Offset: offset, Items: orders})
+}
+
+// deleteCustomerOrdersHandler handles DELETE /orders?customer_id=: deletes
+// all orders of the customer, e.g. for GDPR erasure requests, and evicts
+// them from the cache
+func (s *Server) deleteCustomerOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	customerID := r.URL.Query().Get("customer_id")
+	if customerID == "" {
+		http.Error(w, "customer_id is required", http.StatusBadRequest)
+		return
+	}
+
+	uids, err := s.Database.DeleteByCustomer(r.Context(), customerID)
+	if err != nil {
+		slog.Error("Failed to delete customer orders", "customer_id", customerID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for _, uid := range uids {
+		s.Cache.Delete(uid)
+	}
+
+	slog.Info("Customer orders deleted", "customer_id", customerID, "count", len(uids))
+	s.sendJSON(w, struct {
+		Deleted int `json:"deleted"`
+	}{
+		Deleted: len(uids),
+	})
+}
+
+// queryInt parses the query parameter key as an integer, returning def when it is absent
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// parseOrderFilter builds a filter from the query string, resolving relative
+// times against now
+func parseOrderFilter(r *http.Request, now time.Time) (database.OrderFilter, error) {
+	filter := database.OrderFilter{
+		CustomerID:      r.URL.Query().Get("customer_id"),
+		DeliveryService: r.URL.Query().Get("delivery_service"),
+	}
+
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := parseRelativeDuration(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+		filter.Since = now.Add(-d)
+	}
+
+	return filter, nil
+}
+
+// parseRelativeDuration parses a positive Go duration, additionally accepting
+// whole days such as "7d" which time.ParseDuration doesn't support
+func parseRelativeDuration(v string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a duration", v)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return 0, fmt.Errorf("%q is not a duration", v)
+		}
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("%q must be positive", v)
+	}
+	return d, nil
+}
+
+// shardStatsHandler handles GET /stats/shards: returns order counts per
+// shardkey and oof_shard
+func (s *Server) shardStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.Database.ShardStats(r.Context())
+	if err != nil {
+		slog.Error("Failed to compute shard stats", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, stats)
+}
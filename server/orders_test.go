@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOrderFilterSince(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query     string
+		wantSince time.Time
+		wantErr   bool
+	}{
+		{query: "", wantSince: time.Time{}},
+		{query: "since=24h", wantSince: now.Add(-24 * time.Hour)},
+		{query: "since=90m", wantSince: now.Add(-90 * time.Minute)},
+		{query: "since=1h30m", wantSince: now.Add(-90 * time.Minute)},
+		{query: "since=7d", wantSince: now.AddDate(0, 0, -7)},
+		{query: "since=0s", wantErr: true},
+		{query: "since=-1h", wantErr: true},
+		{query: "since=-2d", wantErr: true},
+		{query: "since=yesterday", wantErr: true},
+		{query: "since=1.5d", wantErr: true},
+		{query: "since=2024-03-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/orders?"+tt.query, nil)
+			filter, err := parseOrderFilter(r, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOrderFilter error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !filter.Since.Equal(tt.wantSince) {
+				t.Errorf("since = %v, want %v", filter.Since, tt.wantSince)
+			}
+		})
+	}
+}
+
+func TestOrdersListHandler(t *testing.T) {
+	db := testDatabase(t)
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, o := range []struct{ uid, customer, service string }{
+		{uid: "list-a", customer: "list-alice", service: "list-meest"},
+		{uid: "list-b", customer: "list-alice", service: "list-dhl"},
+		{uid: "list-c", customer: "list-bob", service: "list-meest"},
+	} {
+		order := ordertest.Order(o.uid)
+		order.CustomerID = o.customer
+		order.DeliveryService = o.service
+		order.DateCreated = created.Add(time.Duration(i) * time.Hour)
+		storeTestOrder(t, db, order)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantTotal  int
+		wantLimit  int
+		wantOffset int
+		wantUIDs   []string
+	}{
+		{name: "customer", query: "customer_id=list-alice",
+			wantTotal: 2, wantLimit: defaultListLimit, wantUIDs: []string{"list-b", "list-a"}},
+		{name: "delivery service", query: "delivery_service=list-meest",
+			wantTotal: 2, wantLimit: defaultListLimit, wantUIDs: []string{"list-c", "list-a"}},
+		{name: "customer and delivery service", query: "customer_id=list-alice&delivery_service=list-meest",
+			wantTotal: 1, wantLimit: defaultListLimit, wantUIDs: []string{"list-a"}},
+		{name: "no match", query: "customer_id=list-bob&delivery_service=list-dhl",
+			wantLimit: defaultListLimit, wantUIDs: []string{}},
+		{name: "first page", query: "customer_id=list-alice&limit=1",
+			wantTotal: 2, wantLimit: 1, wantUIDs: []string{"list-b"}},
+		{name: "second page", query: "customer_id=list-alice&limit=1&offset=1",
+			wantTotal: 2, wantLimit: 1, wantOffset: 1, wantUIDs: []string{"list-a"}},
+		{name: "limit capped", query: "customer_id=list-bob&limit=1000",
+			wantTotal: 1, wantLimit: maxListLimit, wantUIDs: []string{"list-c"}},
+		{name: "injection", query: "customer_id=" + url.QueryEscape("list-alice' OR '1'='1"),
+			wantLimit: defaultListLimit, wantUIDs: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, db, Options{})
+			rec := serveGet(t, s, "/orders?"+tt.query)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			var page orderPage
+			if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+				t.Fatalf("decoding page: %v", err)
+			}
+			if page.Total != tt.wantTotal || page.Limit != tt.wantLimit || page.Offset != tt.wantOffset {
+				t.Errorf("total, limit, offset = %d, %d, %d, want %d, %d, %d",
+					page.Total, page.Limit, page.Offset, tt.wantTotal, tt.wantLimit, tt.wantOffset)
+			}
+			uids := []string{}
+			for _, order := range page.Items {
+				uids = append(uids, order.OrderUID)
+			}
+			if !reflect.DeepEqual(uids, tt.wantUIDs) {
+				t.Errorf("orders = %v, want %v", uids, tt.wantUIDs)
+			}
+		})
+	}
+}
+
+func TestOrdersListHandlerQuery(t *testing.T) {
+	tests := []string{
+		"limit=0",
+		"limit=-5",
+		"limit=ten",
+		"offset=-1",
+		"offset=first",
+		"since=yesterday",
+	}
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{})
+			if rec := serveGet(t, s, "/orders?"+query); rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+		})
+	}
+}
+
+func TestDeleteCustomerOrdersHandler(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name        string
+		query       string
+		token       string
+		wantStatus  int
+		wantDeleted int
+	}{
+		{name: "customer with orders", query: "?customer_id=gdpr-alice", token: testAdminToken,
+			wantStatus: http.StatusOK, wantDeleted: 3},
+		{name: "customer without orders", query: "?customer_id=gdpr-nobody", token: testAdminToken,
+			wantStatus: http.StatusOK},
+		{name: "no customer", token: testAdminToken, wantStatus: http.StatusBadRequest},
+		{name: "not admin", query: "?customer_id=gdpr-alice", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+			var alice []string
+			for i, customer := range []string{"gdpr-alice", "gdpr-alice", "gdpr-bob", "gdpr-alice"} {
+				order := ordertest.Order(fmt.Sprintf("gdpr-%d", i))
+				order.CustomerID = customer
+				storeTestOrder(t, db, order)
+				s.Cache.Set(order, cache.DefaultTTL)
+				if customer == "gdpr-alice" {
+					alice = append(alice, order.OrderUID)
+				}
+			}
+
+			req := adminRequest(http.MethodDelete, "/orders"+tt.query, nil)
+			if tt.token == "" {
+				req.Header.Del("Authorization")
+			}
+			rec := serve(s, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusOK {
+				var resp struct {
+					Deleted int `json:"deleted"`
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				if resp.Deleted != tt.wantDeleted {
+					t.Errorf("deleted = %d, want %d", resp.Deleted, tt.wantDeleted)
+				}
+			}
+
+			for _, uid := range append(alice, "gdpr-2") {
+				gone := tt.wantDeleted > 0 && uid != "gdpr-2"
+				exists, err := db.OrderExists(context.Background(), uid)
+				if err != nil {
+					t.Fatalf("OrderExists: %v", err)
+				}
+				if exists == gone {
+					t.Errorf("order %s stored = %v, want %v", uid, exists, !gone)
+				}
+				if _, cached := s.Cache.Peek(uid); cached == gone {
+					t.Errorf("order %s cached = %v, want %v", uid, cached, !gone)
+				}
+			}
+		})
+	}
+}
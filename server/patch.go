@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/database"
+	"orders-service/model"
+)
+
+// patchError is a patch that cannot be applied to the stored order, or whose
+// result is not a valid order
+type patchError struct{ err error }
+
+func (e patchError) Error() string { return e.err.Error() }
+func (e patchError) Unwrap() error { return e.err }
+
+// patchOrderHandler handles PATCH /order/{id} with an RFC 6902 JSON Patch:
+// the patch is applied to the stored order, the result is validated and
+// stored, and the patch is recorded in the order's audit trail
+func (s *Server) patchOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderUID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != jsonPatchType {
+		http.Error(w, "Expected Content-Type "+jsonPatchType, http.StatusUnsupportedMediaType)
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	order, err := s.Database.PatchOrder(r.Context(), orderID, patch, func(order model.Order) (model.Order, error) {
+		return patchOrder(order, patch, s.validateOrder)
+	})
+	var perr patchError
+	switch {
+	case errors.Is(err, model.ErrOrderNotFound):
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errInvalidPatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.As(err, &perr):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		slog.Error("Failed to patch order", "order_uid", orderID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Order patched", "order_uid", orderID)
+	s.Cache.SetKeepTTL(order, cache.DefaultTTL)
+	w.Header().Set("ETag", orderETag(order))
+	s.sendOrder(w, r, order)
+}
+
+// patchOrder applies patch to the order's JSON and decodes the result, which
+// must still pass validate and have the same UID and status; the status only
+// changes through PATCH /order/{id}/status
+func patchOrder(order model.Order, patch []byte, validate func(model.Order) error) (model.Order, error) {
+	doc, err := json.Marshal(order)
+	if err != nil {
+		return model.Order{}, err
+	}
+	doc, err = applyPatch(doc, patch)
+	if errors.Is(err, errInvalidPatch) {
+		return model.Order{}, err
+	}
+	if err != nil {
+		return model.Order{}, patchError{err}
+	}
+
+	var patched model.Order
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patched); err != nil {
+		return model.Order{}, patchError{err}
+	}
+	switch {
+	case patched.OrderUID != order.OrderUID:
+		return model.Order{}, patchError{errors.New("order_uid cannot be changed")}
+	case patched.Status != order.Status:
+		return model.Order{}, patchError{errors.New("status changes through PATCH /order/{id}/status")}
+	}
+	if err := validate(patched); err != nil {
+		return model.Order{}, patchError{err}
+	}
+	return patched, nil
+}
+
+// auditHandler handles GET /order/{id}/audit: lists the recorded changes of
+// the order, oldest first
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderUID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	entries, err := s.Database.OrderAudit(r.Context(), orderID)
+	if err != nil {
+		slog.Error("Failed to load audit trail", "order_uid", orderID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []database.AuditEntry{}
+	}
+	s.sendJSON(w, entries)
+}
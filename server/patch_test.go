@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/database"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatchOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		patch     string
+		check     func(model.Order) bool
+		wantErr   error // errInvalidPatch, or nil for patchError
+		wantValid bool
+	}{
+		{
+			name:      "replace delivery city",
+			patch:     `[{"op":"replace","path":"/delivery/city","value":"Haifa"}]`,
+			check:     func(o model.Order) bool { return o.Delivery.City == "Haifa" },
+			wantValid: true,
+		},
+		{
+			name:      "remove optional region",
+			patch:     `[{"op":"remove","path":"/delivery/region"}]`,
+			check:     func(o model.Order) bool { return o.Delivery.Region == "" && o.Delivery.City != "" },
+			wantValid: true,
+		},
+		{
+			name:      "test then replace",
+			patch:     `[{"op":"test","path":"/payment/amount","value":1817},{"op":"replace","path":"/payment/amount","value":2000}]`,
+			check:     func(o model.Order) bool { return o.Payment.Amount == 2000 },
+			wantValid: true,
+		},
+		{
+			name:  "append item",
+			patch: `[{"op":"copy","from":"/items/0","path":"/items/-"},{"op":"replace","path":"/items/1/name","value":"Lipstick"}]`,
+			check: func(o model.Order) bool {
+				return len(o.Items) == 2 && o.Items[0].Name == "Mascaras" && o.Items[1].Name == "Lipstick"
+			},
+			wantValid: true,
+		},
+		{name: "failed test", patch: `[{"op":"test","path":"/delivery/city","value":"Haifa"}]`},
+		{name: "missing member", patch: `[{"op":"remove","path":"/delivery/floor"}]`},
+		{name: "unknown field", patch: `[{"op":"add","path":"/delivery/floor","value":3}]`},
+		{name: "remove required field", patch: `[{"op":"remove","path":"/customer_id"}]`},
+		{name: "remove last item", patch: `[{"op":"remove","path":"/items/0"}]`},
+		{name: "remove payment", patch: `[{"op":"remove","path":"/payment"}]`},
+		{name: "change UID", patch: `[{"op":"replace","path":"/order_uid","value":"other"}]`},
+		{name: "change status", patch: `[{"op":"replace","path":"/status","value":"shipped"}]`},
+		{name: "not an array", patch: `{"op":"remove","path":"/locale"}`, wantErr: errInvalidPatch},
+		{name: "unknown op", patch: `[{"op":"merge","path":"/locale","value":"ru"}]`, wantErr: errInvalidPatch},
+		{name: "missing value", patch: `[{"op":"replace","path":"/locale"}]`, wantErr: errInvalidPatch},
+		{name: "relative path", patch: `[{"op":"remove","path":"locale"}]`, wantErr: errInvalidPatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("patch-unit")
+			patched, err := patchOrder(order, []byte(tt.patch), model.Order.Validate)
+			if tt.wantValid {
+				if err != nil {
+					t.Fatalf("patchOrder: %v", err)
+				}
+				if !tt.check(patched) {
+					t.Errorf("patch not applied: %+v", patched)
+				}
+				return
+			}
+
+			var perr patchError
+			switch {
+			case err == nil:
+				t.Fatal("patchOrder succeeded, want an error")
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			case tt.wantErr == nil && !errors.As(err, &perr):
+				t.Errorf("error = %v (%T), want a patchError", err, err)
+			}
+		})
+	}
+}
+
+func TestPatchOrderHandlerRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		token       string
+		wantStatus  int
+	}{
+		{name: "plain JSON", path: "/order/patch-1", contentType: "application/json", token: testAdminToken, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "no content type", path: "/order/patch-1", token: testAdminToken, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "invalid UID", path: "/order/bad%20uid", contentType: jsonPatchType, token: testAdminToken, wantStatus: http.StatusBadRequest},
+		{name: "no token", path: "/order/patch-1", contentType: jsonPatchType, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{AdminToken: testAdminToken})
+			req := adminRequest(http.MethodPatch, tt.path, strings.NewReader(`[]`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.token == "" {
+				req.Header.Del("Authorization")
+			}
+			if rec := serve(s, req); rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestPatchOrderHandler(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name       string
+		uid        string
+		patch      string
+		wantStatus int
+		check      func(model.Order) bool
+	}{
+		{
+			name:       "replace delivery city",
+			uid:        "patch-city",
+			patch:      `[{"op":"replace","path":"/delivery/city","value":"Haifa"}]`,
+			wantStatus: http.StatusOK,
+			check:      func(o model.Order) bool { return o.Delivery.City == "Haifa" },
+		},
+		{
+			name:       "remove optional region",
+			uid:        "patch-region",
+			patch:      `[{"op":"remove","path":"/delivery/region"}]`,
+			wantStatus: http.StatusOK,
+			check:      func(o model.Order) bool { return o.Delivery.Region == "" },
+		},
+		{name: "invalid result", uid: "patch-invalid", patch: `[{"op":"remove","path":"/customer_id"}]`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "malformed patch", uid: "patch-malformed", patch: `{}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			order := ordertest.Order(tt.uid)
+			storeTestOrder(t, db, order)
+			s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+			s.Cache.Set(order, cache.DefaultTTL)
+			// The trail outlives deleted orders, so earlier runs may have left entries
+			before, err := db.OrderAudit(ctx, tt.uid)
+			if err != nil {
+				t.Fatalf("OrderAudit: %v", err)
+			}
+
+			req := adminRequest(http.MethodPatch, "/order/"+tt.uid, strings.NewReader(tt.patch))
+			req.Header.Set("Content-Type", jsonPatchType)
+			rec := serve(s, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			stored, err := db.GetOrder(ctx, tt.uid)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			audit, err := db.OrderAudit(ctx, tt.uid)
+			if err != nil {
+				t.Fatalf("OrderAudit: %v", err)
+			}
+			audit = audit[len(before):]
+			if tt.check == nil {
+				if stored.Diff(order) != nil {
+					t.Errorf("rejected patch changed the stored order: %v", stored.Diff(order))
+				}
+				if len(audit) != 0 {
+					t.Errorf("rejected patch recorded %d audit entries", len(audit))
+				}
+				return
+			}
+
+			if !tt.check(stored) {
+				t.Errorf("stored order not patched: %+v", stored)
+			}
+			if cached, _ := s.Cache.Peek(tt.uid); !tt.check(cached) {
+				t.Errorf("cached order not patched: %+v", cached)
+			}
+			if len(audit) != 1 || audit[0].Action != database.AuditPatch {
+				t.Fatalf("audit trail = %+v, want one patch entry", audit)
+			}
+			var want, got any
+			if err := json.Unmarshal([]byte(tt.patch), &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(audit[0].Change, &got); err != nil {
+				t.Fatalf("decoding audited change: %v", err)
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("audited change = %s, want %s", audit[0].Change, tt.patch)
+			}
+		})
+	}
+}
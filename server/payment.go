@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"orders-service/model"
+	"strings"
+)
+
+// paymentHandler handles GET /order/{id}/payment: returns the order's payment
+// record, with transaction identifiers masked unless the caller is an admin
+func (s *Server) paymentHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderUID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	payment, err := s.Database.GetPayment(r.Context(), orderID)
+	if errors.Is(err, model.ErrPaymentNotFound) {
+		http.Error(w, "Payment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to retrieve payment", "order_uid", orderID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !s.isAdmin(r) {
+		payment = maskPayment(payment)
+	}
+	s.sendJSON(w, payment)
+}
+
+// orderView returns the order as shown to the caller: unless the caller is an
+// admin, its payment is masked like GET /order/{id}/payment masks it. Every
+// response carrying orders goes through it
+func (s *Server) orderView(r *http.Request, order model.Order) model.Order {
+	if !s.isAdmin(r) {
+		order.Payment = maskPayment(order.Payment)
+	}
+	return order
+}
+
+// maskPayment hides all but the last four characters of identifiers that
+// could be used to look up the transaction with the payment provider
+func maskPayment(p model.Payment) model.Payment {
+	p.Transaction = maskString(p.Transaction)
+	p.RequestID = maskString(p.RequestID)
+	return p
+}
+
+func maskString(v string) string {
+	const visible = 4
+	if len(v) <= visible {
+		return strings.Repeat("*", len(v))
+	}
+	return strings.Repeat("*", len(v)-visible) + v[len(v)-visible:]
+}
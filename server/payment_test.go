@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"orders-service/cache"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"testing"
+)
+
+func TestMaskString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "", want: ""},
+		{in: "abc", want: "***"},
+		{in: "abcd", want: "****"},
+		{in: "abcde", want: "*bcde"},
+		{in: "b563feb7b2b84b6test", want: "***************test"},
+	}
+	for _, tt := range tests {
+		if got := maskString(tt.in); got != tt.want {
+			t.Errorf("maskString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPaymentHandler(t *testing.T) {
+	db := testDatabase(t)
+
+	withPayment := ordertest.Order("payment-present")
+	withPayment.Payment.RequestID = "req-12345678"
+	withoutPayment := ordertest.Order("payment-missing")
+	withoutPayment.Payment = model.Payment{}
+	storeTestOrder(t, db, withPayment)
+	storeTestOrder(t, db, withoutPayment)
+
+	tests := []struct {
+		name        string
+		uid         string
+		admin       bool
+		wantStatus  int
+		wantPayment model.Payment
+	}{
+		{name: "admin sees identifiers", uid: withPayment.OrderUID, admin: true, wantStatus: http.StatusOK,
+			wantPayment: withPayment.Payment},
+		{name: "masked for others", uid: withPayment.OrderUID, wantStatus: http.StatusOK,
+			wantPayment: maskPayment(withPayment.Payment)},
+		{name: "missing payment", uid: withoutPayment.OrderUID, wantStatus: http.StatusNotFound},
+		{name: "missing order", uid: "payment-no-such-order", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+			req := adminRequest(http.MethodGet, "/order/"+tt.uid+"/payment", nil)
+			if !tt.admin {
+				req.Header.Del("Authorization")
+			}
+			rec := serve(s, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got model.Payment
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding payment: %v", err)
+			}
+			if got != tt.wantPayment {
+				t.Errorf("payment = %+v, want %+v", got, tt.wantPayment)
+			}
+		})
+	}
+}
+
+func TestOrderResponsesMaskPayment(t *testing.T) {
+	order := ordertest.Order("mask-order")
+	order.CustomerID = "mask-customer"
+	order.Payment.Transaction = "mask-transaction-1234"
+	order.Payment.RequestID = "req-12345678"
+
+	decodeOrder := func(t *testing.T, body []byte) []model.Payment {
+		var got model.Order
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("decoding order: %v", err)
+		}
+		return []model.Payment{got.Payment}
+	}
+	tests := []struct {
+		name     string
+		path     string
+		cached   bool
+		batch    bool
+		payments func(t *testing.T, body []byte) []model.Payment
+	}{
+		{name: "order from the DB", path: "/order/" + order.OrderUID, payments: decodeOrder},
+		{name: "order from the cache", path: "/order/" + order.OrderUID, cached: true, payments: decodeOrder},
+		{name: "order with labels", path: "/order/" + order.OrderUID + "?labels=true",
+			payments: func(t *testing.T, body []byte) []model.Payment {
+				var got struct{ Order model.Order }
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				return []model.Payment{got.Order.Payment}
+			}},
+		{name: "order list", path: "/orders?customer_id=" + order.CustomerID,
+			payments: func(t *testing.T, body []byte) []model.Payment {
+				var got orderPage
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				var payments []model.Payment
+				for _, order := range got.Items {
+					payments = append(payments, order.Payment)
+				}
+				return payments
+			}},
+		{name: "batch", batch: true,
+			payments: func(t *testing.T, body []byte) []model.Payment {
+				var got map[string]model.Order
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				var payments []model.Payment
+				for _, order := range got {
+					payments = append(payments, order.Payment)
+				}
+				return payments
+			}},
+		{name: "transaction", path: "/transaction/" + order.Payment.Transaction, payments: decodeOrder},
+	}
+	for _, tt := range tests {
+		for _, admin := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s admin %v", tt.name, admin), func(t *testing.T) {
+				db := testDatabase(t)
+				storeTestOrder(t, db, order)
+				s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+				if tt.cached {
+					s.Cache.Set(order, cache.DefaultTTL)
+				}
+
+				var req *http.Request
+				if tt.batch {
+					req = batchRequest(t, []string{order.OrderUID})
+				} else {
+					req = httptest.NewRequest(http.MethodGet, tt.path, nil)
+				}
+				if admin {
+					req.Header.Set("Authorization", "Bearer "+testAdminToken)
+				}
+				rec := serve(s, req)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+				}
+
+				want := maskPayment(order.Payment)
+				if admin {
+					want = order.Payment
+				}
+				payments := tt.payments(t, rec.Body.Bytes())
+				if len(payments) != 1 {
+					t.Fatalf("response holds %d orders, want 1", len(payments))
+				}
+				if payments[0] != want {
+					t.Errorf("payment = %+v, want %+v", payments[0], want)
+				}
+			})
+		}
+	}
+
+	// Masking a response must leave the cached order intact
+	db := testDatabase(t)
+	storeTestOrder(t, db, order)
+	s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+	serveGet(t, s, "/order/"+order.OrderUID)
+	if cached, found := s.Cache.Peek(order.OrderUID); !found || cached.Payment != order.Payment {
+		t.Errorf("cached payment = %+v, want the unmasked %+v", cached.Payment, order.Payment)
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"orders-service/databasetest"
+	"orders-service/ordertest"
+	"testing"
+)
+
+func TestOrderReadRetriesTransientErrors(t *testing.T) {
+	order := ordertest.Order("retry-read")
+
+	tests := []struct {
+		name       string
+		failures   int // reads failing before the DB is reachable
+		attempts   int
+		wantStatus int
+		wantReads  int
+	}{
+		{name: "recovers after a blip", failures: 2, attempts: 3, wantStatus: http.StatusOK, wantReads: 3},
+		{name: "no outage", attempts: 3, wantStatus: http.StatusOK, wantReads: 1},
+		{name: "outage outlasting the attempts", failures: 3, attempts: 3, wantStatus: http.StatusInternalServerError, wantReads: 3},
+		{name: "retries disabled", failures: 1, attempts: 1, wantStatus: http.StatusInternalServerError, wantReads: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := databasetest.New(order)
+			for range tt.failures {
+				db.FailNext("GetOrder", databasetest.ErrUnavailable)
+			}
+
+			s := newTestServer(t, nil, db, Options{ReadAttempts: tt.attempts})
+			if rec := serveGet(t, s, "/order/"+order.OrderUID); rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := db.Calls("GetOrder"); got != tt.wantReads {
+				t.Errorf("%d reads, want %d", got, tt.wantReads)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// searchLimit caps the number of results returned by GET /api/search
+	searchLimit = 10
+	// maxSearchQuery bounds the length of a search query
+	maxSearchQuery = 64
+)
+
+// searchResult is the summary of an order shown in the search autocomplete
+type searchResult struct {
+	OrderUID    string    `json:"order_uid"`
+	TrackNumber string    `json:"track_number"`
+	CustomerID  string    `json:"customer_id"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+// searchHandler handles GET /api/search?q=: returns the newest orders whose
+// UID starts with q or whose track number or customer id equals q
+func (s *Server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" || len(q) > maxSearchQuery {
+		http.Error(w, "Invalid search query", http.StatusBadRequest)
+		return
+	}
+
+	orders, err := s.Database.SearchOrders(r.Context(), q, searchLimit)
+	if err != nil {
+		slog.Error("Failed to search orders", "query", q, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]searchResult, 0, len(orders))
+	for _, order := range orders {
+		results = append(results, searchResult{
+			OrderUID:    order.OrderUID,
+			TrackNumber: order.TrackNumber,
+			CustomerID:  order.CustomerID,
+			DateCreated: order.DateCreated,
+		})
+	}
+	s.sendJSON(w, results)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"orders-service/ordertest"
+	"strings"
+	"testing"
+)
+
+func TestSearchHandler(t *testing.T) {
+	db := testDatabase(t)
+	for i := range searchLimit + 2 {
+		order := ordertest.Order(fmt.Sprintf("search-handler-%02d", i))
+		order.CustomerID = "search-handler-customer"
+		storeTestOrder(t, db, order)
+	}
+
+	tests := []struct {
+		name      string
+		q         string
+		wantCount int
+	}{
+		{name: "UID prefix capped", q: "search-handler-", wantCount: searchLimit},
+		{name: "single UID", q: "search-handler-03", wantCount: 1},
+		{name: "customer id capped", q: "search-handler-customer", wantCount: searchLimit},
+		{name: "no match", q: "search-handler-none", wantCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, db, Options{})
+			rec := serveGet(t, s, "/api/search?q="+url.QueryEscape(tt.q))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			var results []searchResult
+			if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+				t.Fatalf("decoding results: %v", err)
+			}
+			if results == nil || len(results) != tt.wantCount {
+				t.Errorf("got %d results (%v), want %d", len(results), results, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestSearchHandlerQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "missing", path: "/api/search"},
+		{name: "empty", path: "/api/search?q="},
+		{name: "too long", path: "/api/search?q=" + strings.Repeat("a", maxSearchQuery+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{})
+			if rec := serveGet(t, s, tt.path); rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+		})
+	}
+}
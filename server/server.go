@@ -1,46 +1,215 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"html/template"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"orders-service/cache"
 	"orders-service/database"
+	"orders-service/maintenance"
 	"orders-service/model"
+	"os"
 	"path/filepath"
-	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// readRetryDelay is the initial backoff between DB read attempts
+	readRetryDelay = 50 * time.Millisecond
+	// sharedLoadTimeout bounds a coalesced DB load when RequestTimeout is unset
+	sharedLoadTimeout = 5 * time.Second
 )
 
+// Store is the part of *database.Database the server uses
+type Store interface {
+	Ping(ctx context.Context) error
+	MakeOrder(ctx context.Context, order model.Order) error
+	GetOrder(ctx context.Context, uid string) (model.Order, error)
+	GetOrders(ctx context.Context, uids []string) ([]model.Order, error)
+	GetOrderByTransaction(ctx context.Context, txn string) (model.Order, error)
+	GetPayment(ctx context.Context, uid string) (model.Payment, error)
+	Items(ctx context.Context, uid string, status *int) ([]model.Item, error)
+	ListOrders(ctx context.Context, filter database.OrderFilter, limit, offset int) ([]model.Order, error)
+	CountOrders(ctx context.Context, filter database.OrderFilter) (int, error)
+	SearchOrders(ctx context.Context, q string, limit int) ([]model.Order, error)
+	ShardStats(ctx context.Context) ([]model.ShardCount, error)
+	StreamAllOrders(ctx context.Context, fn func(model.Order) error) error
+	UpdateOrder(ctx context.Context, order model.Order) error
+	UpdateStatus(ctx context.Context, uid, status string) error
+	PatchOrder(ctx context.Context, uid string, patch json.RawMessage,
+		apply func(model.Order) (model.Order, error)) (model.Order, error)
+	OrderAudit(ctx context.Context, uid string) ([]database.AuditEntry, error)
+	DeleteOrder(ctx context.Context, uid string) error
+	DeleteByCustomer(ctx context.Context, customerID string) ([]string, error)
+}
+
 type Server struct {
-	Cache     *cache.Cache
-	Database  *database.Database
-	templates *template.Template
+	Cache       *cache.Cache
+	Database    Store
+	Consumer    ReadinessChecker // optional, reported by /readyz
+	Maintenance *maintenance.Switch
+	templates   *template.Template
+	mux         *http.ServeMux
+	handler     http.Handler
+	http        *http.Server
+	loads       singleflight.Group
+	warmer      *missWarmer // nil when disabled
+	opts        Options
+}
+
+// Options controls optional server behavior
+type Options struct {
+	// AdminToken is the bearer token required by /admin/ endpoints;
+	// admin endpoints are disabled when it is empty
+	AdminToken string
+	// EscapeHTML makes JSON responses escape &, < and > as \u0026 etc.
+	// for clients that embed them in HTML unsanitized
+	EscapeHTML bool
+	// EnablePprof exposes net/http/pprof under /debug/pprof/ for admins
+	EnablePprof bool
+	// MaxConcurrent caps in-flight requests, rejecting the excess with 503;
+	// 0 means unlimited
+	MaxConcurrent int
+	// CoalesceMisses makes concurrent cache misses for the same order share
+	// a single DB query
+	CoalesceMisses bool
+	// EnableExpvar serves cache and processing stats on /debug/vars to admins
+	EnableExpvar bool
+	// ReadAttempts is the number of tries for DB reads failing with transient
+	// errors on a cache miss; values below 2 disable retries
+	ReadAttempts int
+	// CamelCase emits camelCase JSON keys (orderUid) instead of the default
+	// snake_case ones (order_uid)
+	CamelCase bool
+	// RequestTimeout bounds the request context, and with it the DB queries
+	// made for a request; admin and debug endpoints are exempt. 0 disables it
+	RequestTimeout time.Duration
+	// HealthTimeout bounds the DB ping of /healthz and /readyz
+	HealthTimeout time.Duration
+	// RateLimit caps order lookups per second across all clients, with
+	// bursts of up to RateBurst requests; 0 disables the limit
+	RateLimit float64
+	RateBurst int
+	// CORSOrigins lists the origins browsers may call the API from ("*" for
+	// any); empty keeps the API same-origin
+	CORSOrigins []string
+	// Warmer batch-loads recent orders into the cache on miss spikes
+	Warmer WarmerOptions
+	// AllowPartial makes PUT and PATCH accept orders missing delivery or
+	// payment, as the ingest does unless PARTIAL_ORDER_POLICY rejects them
+	AllowPartial bool
 }
 
 // New creates a new HTTP server with access to cache and database
-func New(cache *cache.Cache, db *database.Database) *Server {
+func New(cache *cache.Cache, db Store, sw *maintenance.Switch, opts Options) *Server {
 	// Load templates from the templates directory
 	templates, err := template.ParseFiles(filepath.Join("templates/index.html"))
 	if err != nil {
-		log.Fatal("Failed to load template: ", err)
+		slog.Error("Failed to load template", "error", err)
+		os.Exit(1)
 	}
 
-	return &Server{
-		Cache:     cache,
-		Database:  db,
-		templates: templates,
+	s := &Server{
+		Cache:       cache,
+		Database:    db,
+		Maintenance: sw,
+		templates:   templates,
+		mux:         http.NewServeMux(),
+		opts:        opts,
+	}
+	if opts.Warmer.Threshold > 0 {
+		s.warmer = newMissWarmer(cache, db, opts.Warmer)
+	}
+	s.routes()
+	s.handler = traceRequests(logRequests(allowCORS(opts.CORSOrigins,
+		limitRate(opts.RateLimit, opts.RateBurst,
+			limitConcurrency(opts.MaxConcurrent,
+				refuseWritesWhenReadOnly(s.Maintenance,
+					withTimeout(opts.RequestTimeout, nameSpan(s.mux))))))))
+	s.http = &http.Server{Handler: s}
+
+	return s
+}
+
+// routes registers all handlers on the server's own mux
+func (s *Server) routes() {
+	s.mux.HandleFunc("/", s.indexHandler)
+	s.mux.HandleFunc("/order/", s.orderAPIHandler)
+	s.mux.HandleFunc("DELETE /order/{id}", s.requireAdmin(s.deleteOrderHandler))
+	s.mux.HandleFunc("PUT /order/{id}", s.requireAdmin(s.updateOrderHandler))
+	s.mux.HandleFunc("PATCH /order/{id}", s.requireAdmin(s.patchOrderHandler))
+	s.mux.HandleFunc("PATCH /order/{id}/status", s.requireAdmin(s.statusHandler))
+	s.mux.HandleFunc("GET /order/{id}/audit", s.requireAdmin(s.auditHandler))
+	s.mux.HandleFunc("GET /order/{id}/payment", s.paymentHandler)
+	s.mux.HandleFunc("GET /order/{id}/items", s.itemsHandler)
+	s.mux.HandleFunc("GET /transaction/{txn}", s.transactionHandler)
+	s.mux.HandleFunc("GET /orders", s.ordersListHandler)
+	s.mux.HandleFunc("DELETE /orders", s.requireAdmin(s.deleteCustomerOrdersHandler))
+	s.mux.HandleFunc("POST "+batchOrdersPath, s.batchOrdersHandler)
+	s.mux.HandleFunc("GET /stats/shards", s.shardStatsHandler)
+	s.mux.HandleFunc("GET /api/search", s.searchHandler)
+	s.mux.HandleFunc("GET /healthz", s.healthHandler)
+	s.mux.HandleFunc("GET /readyz", s.readyHandler)
+	s.mux.HandleFunc("GET /cache/stats", s.cacheStatsHandler)
+	s.mux.Handle("GET /metrics", promhttp.Handler())
+	s.mux.HandleFunc("/admin/cache/save", s.requireAdmin(s.cacheSaveHandler))
+	s.mux.HandleFunc("/admin/cache/reload", s.requireAdmin(s.cacheReloadHandler))
+	s.mux.HandleFunc("POST /admin/cache/flush", s.requireAdmin(s.cacheFlushHandler))
+	s.mux.HandleFunc("/admin/read-only", s.requireAdmin(s.readOnlyHandler))
+	s.mux.HandleFunc("/admin/verify", s.requireAdmin(s.verifyHandler))
+
+	if s.opts.EnablePprof {
+		s.registerPprof()
+	}
+	if s.opts.EnableExpvar {
+		s.registerExpvar()
 	}
 }
 
-// Start launches the HTTP server on the specified address
+// cacheStatsHandler handles GET /cache/stats: returns the cache hit, miss,
+// eviction and expiration counters
+func (s *Server) cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	s.sendJSON(w, s.Cache.Stats())
+}
+
+// parseOrderUID validates an order UID taken from the request path, replying
+// 400 for malformed ones so that only well-formed UIDs can end in a 404
+func parseOrderUID(w http.ResponseWriter, uid string) (string, bool) {
+	if !model.ValidOrderUID(uid) {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return "", false
+	}
+	return uid, true
+}
+
+// ServeHTTP dispatches requests through the middleware chain to the server's mux
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Start launches the HTTP server on the specified address and blocks until
+// it fails or is shut down
 func (s *Server) Start(addr string) {
-	// Route handlers
-	http.HandleFunc("/", s.indexHandler)
-	http.HandleFunc("/order/", s.orderAPIHandler)
+	s.http.Addr = addr
+	slog.Info("HTTP server started", "addr", addr)
+	if err := s.http.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("HTTP server failed", "addr", addr, "error", err)
+		os.Exit(1)
+	}
+}
 
-	log.Printf("HTTP server started on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+// Shutdown stops accepting connections and waits for in-flight requests to
+// complete until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
 }
 
 // indexHandler serves the main HTML page
@@ -49,89 +218,263 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	s.renderTemplate(w, "index.html", nil)
+	s.renderTemplate(w, "index.html", s.pageStatus(r.Context()))
 }
 
-// orderAPIHandler handles GET /order/{id}: returns order from cache or DB
+// orderAPIHandler handles GET /order/{id}: returns order from cache or DB,
+// with its ETag; 304 Not Modified when If-None-Match lists the ETag
 func (s *Server) orderAPIHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "GET" {
-        http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
-        return
-    }
-
-    // Extract order_id from /order/123
-    path := r.URL.Path
-    re := regexp.MustCompile(`^/order/([a-zA-Z0-9\-]+)$`)
-    matches := re.FindStringSubmatch(path)
-
-    if len(matches) < 2 {
-        http.Error(w, "Invalid order ID", http.StatusBadRequest)
-        return
-    }
-    orderID := matches[1]
-
-    log.Printf("HTTP: requested order %s", orderID)
-
-    // 1. Check cache
-    if order, found := s.Cache.Get(orderID); found {
-        log.Printf("Order %s found in cache", orderID)
-        s.sendJSON(w, order)
-        return
-    }
-
-    // 2. If not in cache, query database
-    items, err := s.Database.ItemsInfo(orderID)
-    if err != nil {
-        log.Printf("Error retrieving items: %v", err)
-        http.Error(w, "Order not found", http.StatusNotFound)
-        return
-    }
-    if len(items) == 0 {
-        log.Printf("No items found for order %s", orderID)
-        http.Error(w, "Order not found", http.StatusNotFound)
-        return
-    }
-
-    log.Printf("Found %d items for order %s", len(items), orderID)
-
-    // Construct simplified response
-    response := struct {
-        OrderUID string         `json:"order_uid"`
-        Items    []ItemResponse `json:"items"`
-    }{
-        OrderUID: orderID,
-        Items:    make([]ItemResponse, 0, len(items)),
-    }
-
-    for _, item := range items {
-        response.Items = append(response.Items, ItemResponse{
-            Name:       item.Name,
-            Price:      item.Price,
-            Size:       item.Size,
-            TotalPrice: item.TotalPrice,
-            Brand:      item.Brand,
-        })
-    }
-
-    // Cache the response
-    s.Cache.Set(orderToModel(response), cache.DefaultTTL)
-    log.Printf("Order %s loaded from DB and added to cache", orderID)
-
-    s.sendJSON(w, response)
-}
-
-type ItemResponse struct {
-	Name       string `json:"name"`
-	Price      int    `json:"price"`
-	Size       string `json:"size"`
-	TotalPrice int    `json:"total_price"`
-	Brand      string `json:"brand"`
+	if r.Method != "GET" {
+		http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract order_id from /order/123
+	orderID, ok := parseOrderUID(w, strings.TrimPrefix(r.URL.Path, "/order/"))
+	if !ok {
+		return
+	}
+
+	slog.Debug("Order requested", "order_uid", orderID)
+
+	// 1. Check cache
+	if order, found := s.Cache.Get(orderID); found {
+		slog.Debug("Order found in cache", "order_uid", orderID)
+		if s.Cache.LazyItems() {
+			items, err := s.orderItems(r.Context(), orderID, nil)
+			if errors.Is(err, model.ErrOrderNotFound) {
+				// Deleted from the DB behind the cache's back
+				slog.Info("Cached order no longer in DB", "order_uid", orderID)
+				s.Cache.Delete(orderID)
+				http.Error(w, "Order not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				slog.Error("Failed to retrieve items", "order_uid", orderID, "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			order.Items = items
+		}
+		if notModified(w, r, order) {
+			return
+		}
+		s.sendOrder(w, r, order)
+		return
+	}
+
+	// 2. If not in cache, query database
+	s.warmer.recordMiss()
+	order, err := s.loadOrder(r.Context(), orderID)
+	if errors.Is(err, model.ErrOrderNotFound) {
+		slog.Info("Order not found", "order_uid", orderID)
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to retrieve order", "order_uid", orderID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Debug("Order found in DB", "order_uid", orderID, "items", len(order.Items))
+
+	// Cache the order
+	s.Cache.Set(order, cache.DefaultTTL)
+	if s.Cache.LazyItems() {
+		s.Cache.SetItems(orderID, order.Items)
+	}
+	slog.Info("Order loaded from DB and added to cache", "order_uid", orderID)
+
+	if notModified(w, r, order) {
+		return
+	}
+	s.sendOrder(w, r, order)
+}
+
+// deleteOrderHandler handles DELETE /order/{id}: removes the order from the
+// database and the cache
+func (s *Server) deleteOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderUID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	err := s.Database.DeleteOrder(r.Context(), orderID)
+	if errors.Is(err, model.ErrOrderNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to delete order", "order_uid", orderID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.Cache.Delete(orderID)
+	slog.Info("Order deleted", "order_uid", orderID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateOrderHandler handles PUT /order/{id}: overwrites the stored order with
+// the one in the body and refreshes the cache. With If-Match the order is only
+// overwritten while its ETag is listed, and with If-None-Match: * it is only
+// created, if it doesn't exist yet; otherwise 412 Precondition Failed.
+// The ETag check and the write are separate queries, so a write landing
+// between them goes unnoticed
+func (s *Server) updateOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderUID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var order model.Order
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		http.Error(w, "Invalid order JSON", http.StatusBadRequest)
+		return
+	}
+	if order.OrderUID == "" {
+		order.OrderUID = orderID
+	}
+	if order.OrderUID != orderID {
+		http.Error(w, "order_uid does not match the URL", http.StatusBadRequest)
+		return
+	}
+	if err := s.validateOrder(order); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	create := r.Header.Get("If-None-Match") == "*"
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !create {
+		current, err := s.Database.GetOrder(r.Context(), orderID)
+		if err != nil && !errors.Is(err, model.ErrOrderNotFound) {
+			slog.Error("Failed to retrieve order", "order_uid", orderID, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || !etagMatches(ifMatch, orderETag(current), false) {
+			http.Error(w, "Order has changed", http.StatusPreconditionFailed)
+			return
+		}
+	}
+
+	var err error
+	if create {
+		err = s.Database.MakeOrder(r.Context(), order)
+	} else {
+		err = s.Database.UpdateOrder(r.Context(), order)
+	}
+	switch {
+	case errors.Is(err, model.ErrOrderExists):
+		http.Error(w, "Order already exists", http.StatusPreconditionFailed)
+		return
+	case errors.Is(err, model.ErrOrderNotFound):
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	case err != nil:
+		slog.Error("Failed to update order", "order_uid", orderID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if create {
+		slog.Info("Order created", "order_uid", orderID)
+	} else {
+		slog.Info("Order updated", "order_uid", orderID)
+	}
+
+	// Reread the order: the stored status is kept rather than the one in the body
+	order, err = s.Database.GetOrder(r.Context(), orderID)
+	if err != nil {
+		slog.Error("Failed to reload updated order", "order_uid", orderID, "error", err)
+		s.Cache.Delete(orderID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.Cache.Set(order, cache.DefaultTTL)
+	w.Header().Set("ETag", orderETag(order))
+	s.sendOrder(w, r, order)
+}
+
+// validateOrder checks an order written through the API the way the ingest
+// checks orders from Kafka: partial orders pass only with AllowPartial
+func (s *Server) validateOrder(order model.Order) error {
+	if s.opts.AllowPartial {
+		return order.ValidatePartial()
+	}
+	return order.Validate()
+}
+
+// loadOrder queries the full order, sharing a single DB query between
+// concurrent cache misses for the same order when coalescing is enabled.
+// The shared query runs detached from the request that started it, so that
+// request going away doesn't fail the others waiting on it
+func (s *Server) loadOrder(ctx context.Context, orderID string) (model.Order, error) {
+	if !s.opts.CoalesceMisses {
+		return s.queryOrder(ctx, orderID)
+	}
+
+	ch := s.loads.DoChan(orderID, func() (interface{}, error) {
+		timeout := s.opts.RequestTimeout
+		if timeout <= 0 {
+			timeout = sharedLoadTimeout
+		}
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+		return s.queryOrder(loadCtx, orderID)
+	})
+
+	var res singleflight.Result
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		return model.Order{}, ctx.Err()
+	}
+	if res.Shared {
+		slog.Debug("DB load shared between concurrent requests", "order_uid", orderID)
+	}
+	if res.Err != nil {
+		return model.Order{}, res.Err
+	}
+	return res.Val.(model.Order), nil
+}
+
+// queryOrder reads the order, retrying transient DB errors so that
+// momentary blips don't surface as client errors
+func (s *Server) queryOrder(ctx context.Context, orderID string) (model.Order, error) {
+	var order model.Order
+	err := database.Retry(ctx, s.opts.ReadAttempts, readRetryDelay, func() error {
+		var err error
+		order, err = s.Database.GetOrder(ctx, orderID)
+		return err
+	})
+	return order, err
 }
 
 // sendJSON serializes and sends a JSON response with proper headers
 func (s *Server) sendJSON(w http.ResponseWriter, data interface{}) {
+	if s.opts.CamelCase {
+		converted, err := camelCaseJSON(data)
+		if err != nil {
+			slog.Error("JSON encoding failed", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		data = converted
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	if err := s.newEncoder(w).Encode(data); err != nil {
+		slog.Error("JSON encoding failed", "error", err)
+	}
+}
+
+// newEncoder returns a JSON encoder honoring the server's HTML escaping setting
+func (s *Server) newEncoder(w io.Writer) *json.Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(s.opts.EscapeHTML)
+	return enc
 }
 
 // renderTemplate executes an HTML template
@@ -139,27 +482,6 @@ func (s *Server) renderTemplate(w http.ResponseWriter, tmpl string, data interfa
 	err := s.templates.ExecuteTemplate(w, tmpl, data)
 	if err != nil {
 		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
-		log.Printf("Template rendering error: %v", err)
-	}
-}
-
-// orderToModel converts a simplified JSON response back into a model.Order for caching
-func orderToModel(r struct {
-	OrderUID string         `json:"order_uid"`
-	Items    []ItemResponse `json:"items"`
-}) model.Order {
-	items := make([]model.Item, len(r.Items))
-	for i, it := range r.Items {
-		items[i] = model.Item{
-			Name:       it.Name,
-			Price:      it.Price,
-			Size:       it.Size,
-			TotalPrice: it.TotalPrice,
-			Brand:      it.Brand,
-		}
-	}
-	return model.Order{
-		OrderUID: r.OrderUID,
-		Items:    items,
+		slog.Error("Template rendering failed", "template", tmpl, "error", err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"orders-service/cache"
+	"orders-service/databasetest"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer builds a server around c and db without the middleware
+// chain or the HTML templates; db may be nil for handlers that don't use it
+func newTestServer(t *testing.T, c *cache.Cache, db Store, opts Options) *Server {
+	t.Helper()
+	if c == nil {
+		c = cache.New(filepath.Join(t.TempDir(), "cache.gob"), cache.Options{})
+	}
+	t.Cleanup(c.Stop)
+
+	s := &Server{
+		Cache:    c,
+		Database: db,
+		mux:      http.NewServeMux(),
+		opts:     opts,
+	}
+	s.routes()
+	s.handler = s.mux
+	return s
+}
+
+// testDatabase returns an empty in-memory database
+func testDatabase(t *testing.T) *databasetest.DB {
+	t.Helper()
+	return databasetest.New()
+}
+
+// storeTestOrder stores order in db
+func storeTestOrder(t *testing.T, db *databasetest.DB, order model.Order) {
+	t.Helper()
+	db.Store(order)
+}
+
+// serveGet serves a GET request for path and returns the recorded response
+func serveGet(t *testing.T, s *Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// testAdminToken is the admin token of servers built by the tests
+const testAdminToken = "test-admin-token"
+
+// serve serves req and returns the recorded response
+func serve(s *Server, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+// adminRequest returns a request carrying testAdminToken
+func adminRequest(method, path string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func TestOrderResponsesIdentical(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name  string
+		cache cache.Options
+		opts  Options
+	}{
+		{name: "default"},
+		{name: "lazy items", cache: cache.Options{LazyItems: true, ItemsTTL: time.Minute}},
+		{name: "camel case", opts: Options{CamelCase: true}},
+		{name: "coalesced", opts: Options{CoalesceMisses: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("identical-" + strings.ReplaceAll(tt.name, " ", "-"))
+			storeTestOrder(t, db, order)
+			c := cache.New(filepath.Join(t.TempDir(), "cache.gob"), tt.cache)
+			s := newTestServer(t, c, db, tt.opts)
+
+			miss := serveGet(t, s, "/order/"+order.OrderUID)
+			hit := serveGet(t, s, "/order/"+order.OrderUID)
+			if miss.Code != http.StatusOK || hit.Code != http.StatusOK {
+				t.Fatalf("status = %d, %d, want 200 twice", miss.Code, hit.Code)
+			}
+			if _, found := c.Peek(order.OrderUID); !found {
+				t.Fatal("order was not cached by the first request")
+			}
+			if miss.Body.String() != hit.Body.String() {
+				t.Errorf("responses differ:\nmiss: %s\nhit:  %s", miss.Body, hit.Body)
+			}
+		})
+	}
+}
+
+func TestCachedOrderResponseMatchesOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		order model.Order
+		query string
+	}{
+		{name: "full order", order: ordertest.Order("cached-full")},
+		{name: "partial order", order: func() model.Order {
+			order := ordertest.Order("cached-partial")
+			order.Delivery = model.Delivery{}
+			order.Payment = model.Payment{}
+			return order
+		}()},
+		{name: "with labels", order: ordertest.Order("cached-labels"), query: "?labels=true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{})
+			path := "/order/" + tt.order.OrderUID + tt.query
+
+			want := httptest.NewRecorder()
+			s.sendOrder(want, httptest.NewRequest(http.MethodGet, path, nil), tt.order)
+
+			s.Cache.Set(tt.order, cache.DefaultTTL)
+			first := serveGet(t, s, path)
+			second := serveGet(t, s, path)
+			if first.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", first.Code)
+			}
+			if first.Body.String() != want.Body.String() {
+				t.Errorf("cached response differs from the order:\ngot:  %s\nwant: %s", first.Body, want.Body)
+			}
+			if first.Body.String() != second.Body.String() {
+				t.Errorf("responses differ:\nfirst:  %s\nsecond: %s", first.Body, second.Body)
+			}
+		})
+	}
+}
+
+func TestOrderJSONEscapeHTML(t *testing.T) {
+	tests := []struct {
+		name       string
+		escapeHTML bool
+		want       string
+	}{
+		{name: "escaping off", escapeHTML: false, want: `"address":"Ploshad Mira 15 & <Lenina> 2"`},
+		{name: "escaping on", escapeHTML: true, want: `"address":"Ploshad Mira 15 \u0026 \u003cLenina\u003e 2"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{EscapeHTML: tt.escapeHTML})
+			order := ordertest.Order("escape-html")
+			order.Delivery.Address = "Ploshad Mira 15 & <Lenina> 2"
+			s.Cache.Set(order, cache.DefaultTTL)
+
+			rec := serveGet(t, s, "/order/"+order.OrderUID)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("body %s does not contain %s", rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheStatsHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		hits int
+		miss int
+		want cache.CacheStats
+	}{
+		{name: "unused", want: cache.CacheStats{Entries: 1}},
+		{name: "hits and misses", hits: 3, miss: 2, want: cache.CacheStats{Hits: 3, Misses: 2, Entries: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{})
+			order := ordertest.Order("stats-handler")
+			s.Cache.Set(order, cache.DefaultTTL)
+			for range tt.hits {
+				s.Cache.Get(order.OrderUID)
+			}
+			for range tt.miss {
+				s.Cache.Get("stats-handler-missing")
+			}
+
+			rec := serveGet(t, s, "/cache/stats")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			var got cache.CacheStats
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decoding stats: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("stats = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	const handlerDelay = 200 * time.Millisecond
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		wantErr   error
+		wantDrain bool
+	}{
+		{name: "drained", timeout: 5 * time.Second, wantDrain: true},
+		{name: "timeout", timeout: 20 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{})
+			started := make(chan struct{})
+			s.mux.HandleFunc("GET /test/slow", func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(handlerDelay)
+				io.WriteString(w, "done")
+			})
+			s.http = &http.Server{Handler: s}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("listening: %v", err)
+			}
+			served := make(chan error, 1)
+			go func() { served <- s.http.Serve(ln) }()
+
+			type response struct {
+				body string
+				err  error
+			}
+			responses := make(chan response, 1)
+			go func() {
+				resp, err := http.Get("http://" + ln.Addr().String() + "/test/slow")
+				if err != nil {
+					responses <- response{err: err}
+					return
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				responses <- response{body: string(body), err: err}
+			}()
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			begin := time.Now()
+			err = s.Shutdown(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Shutdown = %v, want %v", err, tt.wantErr)
+			}
+			if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+				t.Errorf("Serve = %v, want http.ErrServerClosed", err)
+			}
+			if _, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second); err == nil {
+				t.Error("server still accepts connections after Shutdown")
+			}
+
+			resp := <-responses
+			if !tt.wantDrain {
+				return
+			}
+			if elapsed := time.Since(begin); elapsed < handlerDelay/2 {
+				t.Errorf("Shutdown returned after %v, before the request finished", elapsed)
+			}
+			if resp.err != nil || resp.body != "done" {
+				t.Errorf("in-flight request got %q, %v, want it completed", resp.body, resp.err)
+			}
+		})
+	}
+}
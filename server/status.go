@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"orders-service/model"
+)
+
+// statusHandler handles PATCH /order/{id}/status {"status": "..."}: moves the
+// order to a new status if its current one allows it
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderUID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !model.ValidStatus(req.Status) {
+		http.Error(w, `Expected {"status": "created|paid|shipped|delivered|cancelled"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := s.Database.UpdateStatus(r.Context(), orderID, req.Status)
+	switch {
+	case errors.Is(err, model.ErrOrderNotFound):
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	case errors.Is(err, model.ErrInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("Failed to update order status", "order_uid", orderID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.Cache.Update(orderID, func(order *model.Order) {
+		order.Status = req.Status
+	})
+	slog.Info("Order status updated", "order_uid", orderID, "status", req.Status)
+	s.sendJSON(w, map[string]string{"order_uid": orderID, "status": req.Status})
+}
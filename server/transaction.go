@@ -0,0 +1,34 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"orders-service/model"
+)
+
+// transactionHandler handles GET /transaction/{txn}: returns the order paid by
+// the given payment transaction
+func (s *Server) transactionHandler(w http.ResponseWriter, r *http.Request) {
+	txn := r.PathValue("txn")
+	// Transaction IDs share the order UID format
+	if !model.ValidOrderUID(txn) {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	slog.Debug("Order requested by transaction", "transaction", txn)
+
+	order, err := s.Database.GetOrderByTransaction(r.Context(), txn)
+	if errors.Is(err, model.ErrOrderNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to retrieve order by transaction", "transaction", txn, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, s.orderView(r, order))
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"testing"
+)
+
+func TestTransactionHandler(t *testing.T) {
+	db := testDatabase(t)
+	order := ordertest.Order("txn-order")
+	order.Payment.Transaction = "txn-billing-42"
+	storeTestOrder(t, db, order)
+
+	tests := []struct {
+		name       string
+		txn        string
+		wantStatus int
+	}{
+		{name: "found", txn: "txn-billing-42", wantStatus: http.StatusOK},
+		{name: "missing", txn: "txn-no-such-payment", wantStatus: http.StatusNotFound},
+		{name: "order UID is not a transaction", txn: "txn-order", wantStatus: http.StatusNotFound},
+		{name: "invalid", txn: "bad%20txn", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, db, Options{})
+			rec := serveGet(t, s, "/transaction/"+tt.txn)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got model.Order
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding order: %v", err)
+			}
+			if got.OrderUID != order.OrderUID || len(got.Items) != len(order.Items) {
+				t.Errorf("got order %s with %d items, want %s with %d", got.OrderUID, len(got.Items), order.OrderUID, len(order.Items))
+			}
+		})
+	}
+}
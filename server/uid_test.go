@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"orders-service/model"
+	"strings"
+	"testing"
+)
+
+func TestOrderUIDClassification(t *testing.T) {
+	tests := []struct {
+		name     string
+		uid      string
+		wantCode int
+	}{
+		{name: "empty", uid: "", wantCode: http.StatusBadRequest},
+		{name: "over length", uid: strings.Repeat("a", model.MaxOrderUIDLength+1), wantCode: http.StatusBadRequest},
+		{name: "illegal characters", uid: "bad_uid", wantCode: http.StatusBadRequest},
+		{name: "encoded space", uid: "bad%20uid", wantCode: http.StatusBadRequest},
+		{name: "valid missing", uid: "uid-classification-missing", wantCode: http.StatusNotFound},
+	}
+	for _, suffix := range []string{"", "/items", "/payment"} {
+		for _, tt := range tests {
+			if tt.uid == "" && suffix != "" {
+				continue // the mux redirects the empty segment of /order//items
+			}
+			t.Run(strings.TrimPrefix(suffix+"/", "/")+tt.name, func(t *testing.T) {
+				var s *Server
+				if tt.wantCode == http.StatusNotFound {
+					s = newTestServer(t, nil, testDatabase(t), Options{})
+				} else {
+					// Malformed UIDs are refused before any lookup
+					s = newTestServer(t, nil, nil, Options{})
+				}
+
+				rec := serveGet(t, s, "/order/"+tt.uid+suffix)
+				if rec.Code != tt.wantCode {
+					t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"strings"
+	"testing"
+)
+
+func TestUpdateOrderHandler(t *testing.T) {
+	db := testDatabase(t)
+
+	tests := []struct {
+		name       string
+		stored     bool
+		omitUID    bool
+		bodyUID    string
+		wantStatus int
+	}{
+		{name: "existing", stored: true, wantStatus: http.StatusOK},
+		{name: "uid from the URL", stored: true, omitUID: true, wantStatus: http.StatusOK},
+		{name: "missing", wantStatus: http.StatusNotFound},
+		{name: "uid mismatch", stored: true, bodyUID: "update-other", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := ordertest.Order("update-" + strings.ReplaceAll(tt.name, " ", "-"))
+			if tt.stored {
+				storeTestOrder(t, db, order)
+			} else {
+				_ = db.DeleteOrder(context.Background(), order.OrderUID)
+			}
+			s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+			s.Cache.Set(order, cache.DefaultTTL)
+
+			updated := ordertest.Order(order.OrderUID)
+			updated.Delivery.City = "Haifa"
+			if tt.omitUID {
+				updated.OrderUID = ""
+			} else if tt.bodyUID != "" {
+				updated.OrderUID = tt.bodyUID
+			}
+			body, err := json.Marshal(updated)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := serve(s, adminRequest(http.MethodPut, "/order/"+order.OrderUID, strings.NewReader(string(body))))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			cached, found := s.Cache.Peek(order.OrderUID)
+			switch {
+			case tt.wantStatus != http.StatusOK:
+				if found && cached.Delivery.City == "Haifa" {
+					t.Error("rejected update reached the cache")
+				}
+			case !found || cached.Delivery.City != "Haifa":
+				t.Error("cache not refreshed with the updated order")
+			default:
+				var got model.Order
+				if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				if got.Delivery.City != "Haifa" {
+					t.Errorf("response city = %q, want Haifa", got.Delivery.City)
+				}
+			}
+		})
+	}
+}
+
+func TestPartialOrderWrites(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowPartial bool
+		method       string
+		wantStatus   int
+	}{
+		{name: "put rejected", method: http.MethodPut, wantStatus: http.StatusBadRequest},
+		{name: "put allowed", allowPartial: true, method: http.MethodPut, wantStatus: http.StatusOK},
+		{name: "patch rejected", method: http.MethodPatch, wantStatus: http.StatusUnprocessableEntity},
+		{name: "patch allowed", allowPartial: true, method: http.MethodPatch, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDatabase(t)
+			order := ordertest.Order("partial-" + strings.ReplaceAll(tt.name, " ", "-"))
+			storeTestOrder(t, db, order)
+			s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken, AllowPartial: tt.allowPartial})
+
+			var req *http.Request
+			if tt.method == http.MethodPut {
+				partial := ordertest.Order(order.OrderUID)
+				partial.Payment = model.Payment{}
+				body, err := json.Marshal(partial)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req = adminRequest(http.MethodPut, "/order/"+order.OrderUID, strings.NewReader(string(body)))
+			} else {
+				req = adminRequest(http.MethodPatch, "/order/"+order.OrderUID, strings.NewReader(`[{"op":"remove","path":"/payment"}]`))
+				req.Header.Set("Content-Type", jsonPatchType)
+			}
+			rec := serve(s, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			stored, err := db.GetOrder(context.Background(), order.OrderUID)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if got := stored.Payment.IsZero(); got != tt.allowPartial {
+				t.Errorf("stored without payment = %v, want %v", got, tt.allowPartial)
+			}
+		})
+	}
+}
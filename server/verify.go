@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"orders-service/model"
+)
+
+// maxVerifyUIDs caps the number of orders checked by a single verify request
+const maxVerifyUIDs = 100
+
+// verifyResult reports how the cached and stored copies of an order compare
+type verifyResult struct {
+	OrderUID string   `json:"order_uid"`
+	InCache  bool     `json:"in_cache"`
+	InDB     bool     `json:"in_db"`
+	Match    bool     `json:"match"`
+	Diff     []string `json:"diff,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// verifyHandler handles POST /admin/verify {"uids": [...]}: reports for each
+// order whether it is cached, stored, and whether both copies are identical
+func (s *Server) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UIDs []string `json:"uids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.UIDs) == 0 {
+		http.Error(w, `Expected {"uids": ["..."]}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.UIDs) > maxVerifyUIDs {
+		http.Error(w, "Too many UIDs", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]verifyResult, 0, len(req.UIDs))
+	for _, uid := range req.UIDs {
+		results = append(results, s.verifyOrder(r, uid))
+	}
+	s.sendJSON(w, results)
+}
+
+// verifyOrder compares the cached and stored copies of a single order
+func (s *Server) verifyOrder(r *http.Request, uid string) verifyResult {
+	result := verifyResult{OrderUID: uid}
+	if !model.ValidOrderUID(uid) {
+		result.Error = "invalid order ID"
+		return result
+	}
+
+	cached, inCache := s.Cache.Peek(uid)
+	result.InCache = inCache
+
+	stored, err := s.Database.GetOrder(r.Context(), uid)
+	switch {
+	case errors.Is(err, model.ErrOrderNotFound):
+	case err != nil:
+		slog.Error("Verify: failed to load order", "order_uid", uid, "error", err)
+		result.Error = "failed to load order from DB"
+		return result
+	default:
+		result.InDB = true
+	}
+
+	if !result.InCache || !result.InDB {
+		return result
+	}
+	if s.Cache.LazyItems() {
+		// The cached copy carries no items to compare against
+		stored.Items = nil
+	}
+	result.Diff = cached.Diff(stored)
+	result.Match = len(result.Diff) == 0
+	return result
+}
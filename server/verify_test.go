@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"orders-service/cache"
+	"orders-service/ordertest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// verifyRequest returns an admin request to verify uids
+func verifyRequest(t *testing.T, uids []string) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(map[string][]string{"uids": uids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adminRequest(http.MethodPost, "/admin/verify", strings.NewReader(string(body)))
+}
+
+func TestVerifyHandler(t *testing.T) {
+	db := testDatabase(t)
+	s := newTestServer(t, nil, db, Options{AdminToken: testAdminToken})
+	ctx := context.Background()
+
+	for _, uid := range []string{"verify-in-sync", "verify-db-only", "verify-divergent"} {
+		storeTestOrder(t, db, ordertest.Order(uid))
+	}
+	for _, uid := range []string{"verify-in-sync", "verify-divergent"} {
+		stored, err := db.GetOrder(ctx, uid)
+		if err != nil {
+			t.Fatalf("GetOrder: %v", err)
+		}
+		if uid == "verify-divergent" {
+			stored.Delivery.City = "Haifa"
+			stored.Items[0].Price++
+		}
+		s.Cache.Set(stored, cache.DefaultTTL)
+	}
+	s.Cache.Set(ordertest.Order("verify-cache-only"), cache.DefaultTTL)
+
+	tests := []struct {
+		uid  string
+		want verifyResult
+	}{
+		{uid: "verify-in-sync", want: verifyResult{InCache: true, InDB: true, Match: true}},
+		{uid: "verify-cache-only", want: verifyResult{InCache: true}},
+		{uid: "verify-db-only", want: verifyResult{InDB: true}},
+		{uid: "verify-divergent", want: verifyResult{InCache: true, InDB: true, Diff: []string{"delivery.city", "items[0].price"}}},
+		{uid: "verify-missing", want: verifyResult{}},
+		{uid: "bad_uid", want: verifyResult{Error: "invalid order ID"}},
+	}
+	var uids []string
+	for _, tt := range tests {
+		uids = append(uids, tt.uid)
+	}
+
+	rec := serve(s, verifyRequest(t, uids))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var results []verifyResult
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(results) != len(tests) {
+		t.Fatalf("got %d results, want %d", len(results), len(tests))
+	}
+	for i, tt := range tests {
+		tt.want.OrderUID = tt.uid
+		if !reflect.DeepEqual(results[i], tt.want) {
+			t.Errorf("result for %s = %+v, want %+v", tt.uid, results[i], tt.want)
+		}
+	}
+}
+
+func TestVerifyHandlerRequest(t *testing.T) {
+	tooMany := make([]string, maxVerifyUIDs+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("verify-%d", i)
+	}
+
+	tests := []struct {
+		name       string
+		req        func(t *testing.T) *http.Request
+		wantStatus int
+	}{
+		{name: "wrong method", req: func(*testing.T) *http.Request {
+			return adminRequest(http.MethodGet, "/admin/verify", nil)
+		}, wantStatus: http.StatusMethodNotAllowed},
+		{name: "no token", req: func(t *testing.T) *http.Request {
+			req := verifyRequest(t, []string{"verify-1"})
+			req.Header.Del("Authorization")
+			return req
+		}, wantStatus: http.StatusUnauthorized},
+		{name: "malformed body", req: func(*testing.T) *http.Request {
+			return adminRequest(http.MethodPost, "/admin/verify", strings.NewReader("uids"))
+		}, wantStatus: http.StatusBadRequest},
+		{name: "no UIDs", req: func(t *testing.T) *http.Request {
+			return verifyRequest(t, nil)
+		}, wantStatus: http.StatusBadRequest},
+		{name: "too many UIDs", req: func(t *testing.T) *http.Request {
+			return verifyRequest(t, tooMany)
+		}, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, nil, Options{AdminToken: testAdminToken})
+			if rec := serve(s, tt.req(t)); rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"orders-service/cache"
+	"orders-service/database"
+	"orders-service/metrics"
+	"sync"
+	"time"
+)
+
+// warmTimeout bounds a single batch load of the miss warmer
+const warmTimeout = 30 * time.Second
+
+// WarmerOptions configures loading recent orders into the cache when cache
+// misses spike, e.g. after a restart with a cold cache
+type WarmerOptions struct {
+	// Threshold is the number of misses within Window that triggers a batch
+	// load; 0 disables the warmer
+	Threshold int
+	Window    time.Duration
+	// Batch is the number of most recent orders loaded per run
+	Batch int
+	// Cooldown is the minimum time between two runs
+	Cooldown time.Duration
+}
+
+// missWarmer counts cache misses in fixed windows and batch-loads recent
+// orders into the cache when a window exceeds the threshold
+type missWarmer struct {
+	opts  WarmerOptions
+	cache *cache.Cache
+	db    Store
+
+	mu          sync.Mutex
+	windowStart time.Time
+	misses      int
+	lastRun     time.Time
+	running     bool
+}
+
+func newMissWarmer(c *cache.Cache, db Store, opts WarmerOptions) *missWarmer {
+	return &missWarmer{opts: opts, cache: c, db: db}
+}
+
+// recordMiss counts a cache miss and starts a batch load in the background
+// if misses have spiked
+func (w *missWarmer) recordMiss() {
+	if w == nil {
+		return
+	}
+	if w.trigger(time.Now()) {
+		go w.warm()
+	}
+}
+
+// trigger counts a miss at now and reports whether a batch load should start
+func (w *missWarmer) trigger(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if now.Sub(w.windowStart) >= w.opts.Window {
+		w.windowStart = now
+		w.misses = 0
+	}
+	w.misses++
+
+	if w.misses < w.opts.Threshold || w.running || now.Sub(w.lastRun) < w.opts.Cooldown {
+		return false
+	}
+	w.running = true
+	w.lastRun = now
+	w.misses = 0
+	return true
+}
+
+// warm loads the most recent orders into the cache, keeping entries that are
+// already cached
+func (w *missWarmer) warm() {
+	defer func() {
+		w.mu.Lock()
+		w.running = false
+		w.mu.Unlock()
+	}()
+
+	metrics.CacheWarmerRuns.Inc()
+	slog.Info("Cache miss spike detected, loading recent orders", "limit", w.opts.Batch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), warmTimeout)
+	defer cancel()
+
+	orders, err := w.db.ListOrders(ctx, database.OrderFilter{}, w.opts.Batch, 0)
+	if err != nil {
+		slog.Error("Cache warmer failed to load orders", "error", err)
+		return
+	}
+
+	added := 0
+	for _, order := range orders {
+		if _, found := w.cache.Peek(order.OrderUID); found {
+			continue
+		}
+		w.cache.Set(order, cache.DefaultTTL)
+		added++
+	}
+	slog.Info("Cache warmer added recent orders", "added", added, "loaded", len(orders))
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"orders-service/metrics"
+	"orders-service/ordertest"
+	"testing"
+	"time"
+)
+
+func TestMissWarmerTrigger(t *testing.T) {
+	type miss struct {
+		at       time.Duration // since the first miss
+		finished bool          // the previous batch load finished before this miss
+		want     bool
+	}
+	tests := []struct {
+		name   string
+		opts   WarmerOptions
+		misses []miss
+	}{
+		{
+			name:   "spike",
+			opts:   WarmerOptions{Threshold: 3, Window: 10 * time.Second},
+			misses: []miss{{at: 0}, {at: time.Second}, {at: 2 * time.Second, want: true}},
+		},
+		{
+			name:   "misses spread over windows",
+			opts:   WarmerOptions{Threshold: 3, Window: 10 * time.Second},
+			misses: []miss{{at: 0}, {at: 6 * time.Second}, {at: 12 * time.Second}, {at: 24 * time.Second}},
+		},
+		{
+			name: "no overlapping runs",
+			opts: WarmerOptions{Threshold: 1, Window: 10 * time.Second},
+			misses: []miss{
+				{at: 0, want: true},
+				{at: time.Second},
+				{at: 2 * time.Second, finished: true, want: true},
+			},
+		},
+		{
+			name: "cooldown",
+			opts: WarmerOptions{Threshold: 2, Window: 10 * time.Second, Cooldown: time.Minute},
+			misses: []miss{
+				{at: 0}, {at: time.Second, want: true},
+				{at: 2 * time.Second, finished: true}, {at: 3 * time.Second},
+				{at: 61 * time.Second}, {at: 62 * time.Second, want: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newMissWarmer(nil, nil, tt.opts)
+			start := time.Now()
+			for i, m := range tt.misses {
+				if m.finished {
+					w.running = false
+				}
+				if got := w.trigger(start.Add(m.at)); got != m.want {
+					t.Errorf("miss %d at %v triggered = %v, want %v", i, m.at, got, m.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMissWarmerLoadsRecentOrders(t *testing.T) {
+	db := testDatabase(t)
+	var uids []string
+	for i := range 3 {
+		order := ordertest.Order(fmt.Sprintf("warmer-%d", i))
+		order.DateCreated = time.Now().UTC().Truncate(time.Second)
+		storeTestOrder(t, db, order)
+		uids = append(uids, order.OrderUID)
+	}
+
+	tests := []struct {
+		name     string
+		misses   int
+		wantWarm bool
+	}{
+		{name: "below threshold", misses: 4},
+		{name: "miss spike", misses: 5, wantWarm: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Warmer: WarmerOptions{Threshold: 5, Window: time.Minute, Batch: 100, Cooldown: time.Minute}}
+			s := newTestServer(t, nil, db, opts)
+			s.warmer = newMissWarmer(s.Cache, db, opts.Warmer)
+
+			before := metricValue(t, "cache_warmer_runs_total")
+			for i := range tt.misses {
+				if rec := serveGet(t, s, fmt.Sprintf("/order/warmer-missing-%d", i)); rec.Code != http.StatusNotFound {
+					t.Fatalf("status = %d, want 404", rec.Code)
+				}
+			}
+
+			if !tt.wantWarm {
+				time.Sleep(100 * time.Millisecond)
+				if runs := metricValue(t, "cache_warmer_runs_total") - before; runs != 0 {
+					t.Errorf("warmer ran %v times below the threshold", runs)
+				}
+				return
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for _, uid := range uids {
+				for {
+					if _, found := s.Cache.Peek(uid); found {
+						break
+					}
+					if time.Now().After(deadline) {
+						t.Fatalf("recent order %s not loaded by the warmer", uid)
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+			if runs := metricValue(t, "cache_warmer_runs_total") - before; runs != 1 {
+				t.Errorf("warmer ran %v times, want 1", runs)
+			}
+		})
+	}
+}
+
+// metricValue returns the current value of a counter or gauge
+func metricValue(t *testing.T, key string) float64 {
+	t.Helper()
+	values, err := metrics.Snapshot(key)
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	return values[key]
+}
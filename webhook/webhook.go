@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"orders-service/metrics"
+	"orders-service/model"
+	"time"
+)
+
+// SignatureHeader carries the hex-encoded HMAC-SHA256 of the request body
+const SignatureHeader = "X-Signature-SHA256"
+
+const (
+	maxAttempts  = 3
+	retryBackoff = 1 * time.Second
+)
+
+// Notifier POSTs stored orders to an outbound webhook from a background
+// worker, so a slow or failing endpoint never blocks the consumer
+type Notifier struct {
+	url    string
+	secret []byte
+	client *http.Client
+	queue  chan model.Order
+	done   chan struct{}
+	// ctx is cancelled by Close when the queue could not be drained in time
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New starts a notifier posting to url; payloads are signed when secret is
+// non-empty and at most queueSize orders wait for delivery
+func New(url, secret string, queueSize int) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan model.Order, queueSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	go n.worker()
+
+	return n
+}
+
+// Notify queues an order for delivery, dropping it if the queue is full
+func (n *Notifier) Notify(order model.Order) {
+	select {
+	case n.queue <- order:
+	default:
+		slog.Warn("Webhook queue full, dropping notification", "order_uid", order.OrderUID)
+		metrics.WebhookDeliveries.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Close stops accepting orders and waits for queued ones to be delivered
+// until ctx is done; the orders still undelivered then are dropped and
+// counted, and ctx's error is returned
+func (n *Notifier) Close(ctx context.Context) error {
+	close(n.queue)
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		<-n.done
+		return ctx.Err()
+	}
+}
+
+// worker delivers queued orders until the queue is closed, dropping the
+// rest once delivery is cancelled
+func (n *Notifier) worker() {
+	defer close(n.done)
+
+	dropped := 0
+	for order := range n.queue {
+		if n.ctx.Err() != nil {
+			dropped++
+			continue
+		}
+		if err := n.deliver(order); err != nil {
+			if n.ctx.Err() != nil {
+				dropped++
+				continue
+			}
+			slog.Error("Webhook delivery failed", "order_uid", order.OrderUID, "error", err)
+			metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+			continue
+		}
+		metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+	}
+	if dropped > 0 {
+		slog.Warn("Webhook stopped before delivering all notifications", "dropped", dropped)
+		metrics.WebhookDeliveries.WithLabelValues("dropped").Add(float64(dropped))
+	}
+}
+
+// deliver posts a single order, retrying with linear backoff until the
+// notifier is cancelled
+func (n *Notifier) deliver(order model.Order) error {
+	body, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to marshal order: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = n.post(body)
+		if err == nil || attempt == maxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		case <-n.ctx.Done():
+			return n.ctx.Err()
+		}
+	}
+}
+
+func (n *Notifier) post(body []byte) error {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(n.secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of body, as sent in SignatureHeader
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
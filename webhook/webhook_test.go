@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"orders-service/model"
+	"orders-service/ordertest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// delivery is a request received by the fake webhook endpoint
+type delivery struct {
+	body      []byte
+	signature string
+}
+
+// fakeEndpoint is a webhook endpoint answering failures times with 500
+// before accepting requests, recording every request it receives
+type fakeEndpoint struct {
+	failures int
+
+	mu         sync.Mutex
+	deliveries []delivery
+}
+
+func (e *fakeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.deliveries = append(e.deliveries, delivery{body: body, signature: r.Header.Get(SignatureHeader)})
+	if len(e.deliveries) <= e.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (e *fakeEndpoint) Deliveries() []delivery {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]delivery(nil), e.deliveries...)
+}
+
+func TestNotifierDelivers(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		failures int // failed attempts before the endpoint accepts
+	}{
+		{name: "signed", secret: "s3cret"},
+		{name: "unsigned"},
+		{name: "retried after failure", secret: "s3cret", failures: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := &fakeEndpoint{failures: tt.failures}
+			srv := httptest.NewServer(endpoint)
+			defer srv.Close()
+
+			order := ordertest.Order("webhook-order")
+			n := New(srv.URL, tt.secret, 10)
+			n.Notify(order)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := n.Close(ctx); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			deliveries := endpoint.Deliveries()
+			if len(deliveries) != tt.failures+1 {
+				t.Fatalf("endpoint received %d requests, want %d", len(deliveries), tt.failures+1)
+			}
+			last := deliveries[len(deliveries)-1]
+
+			var got model.Order
+			if err := json.Unmarshal(last.body, &got); err != nil {
+				t.Fatalf("decoding delivered order: %v", err)
+			}
+			if diffs := got.Diff(order); len(diffs) > 0 {
+				t.Errorf("delivered order differs in %v", diffs)
+			}
+
+			if tt.secret == "" {
+				if last.signature != "" {
+					t.Errorf("unsigned notifier sent signature %q", last.signature)
+				}
+				return
+			}
+			mac := hmac.New(sha256.New, []byte(tt.secret))
+			mac.Write(last.body)
+			signature, err := hex.DecodeString(last.signature)
+			if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+				t.Errorf("signature %q does not verify", last.signature)
+			}
+		})
+	}
+}
+
+func TestNotifierCloseDropsUndelivered(t *testing.T) {
+	// The endpoint never succeeds, so delivery keeps retrying until Close gives up
+	endpoint := &fakeEndpoint{failures: 1 << 30}
+	srv := httptest.NewServer(endpoint)
+	defer srv.Close()
+
+	n := New(srv.URL, "", 10)
+	n.Notify(ordertest.Order("webhook-first"))
+	n.Notify(ordertest.Order("webhook-second"))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := n.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Close took %v past its deadline", elapsed)
+	}
+}